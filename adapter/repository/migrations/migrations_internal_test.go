@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"context"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRunDoesNotLeakStopRequest(t *testing.T) {
+	m := &Migrator{migrate: &migrate.Migrate{GracefulStop: make(chan bool, 1)}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan error)
+	go func() {
+		finished <- m.run(ctx, "up", func() error {
+			// stop buffer is full when ctx gets cancelled
+			m.migrate.GracefulStop <- true
+			cancel()
+			time.Sleep(10 * time.Millisecond)
+			return migrate.ErrNoChange
+		})
+	}()
+	select {
+	case err := <-finished:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("run blocked on full stop buffer")
+	}
+
+	err := m.run(context.Background(), "up", func() error {
+		assert.Empty(t, m.migrate.GracefulStop)
+		return migrate.ErrNoChange
+	})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,340 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// IAMTokenRefreshInterval RDS IAM auth tokens are valid 15 minutes, we regenerate them well before expiry
+	IAMTokenRefreshInterval = 10 * time.Minute
+	// DefaultSecretRefreshInterval is max age of cached secret, secret is re-read afterwards to pick up rotated password
+	DefaultSecretRefreshInterval = 5 * time.Minute
+
+	pgErrCodeInvalidPassword = "28P01"
+	// maxInspectedMessageSize limits size of messages buffered by authErrorReader
+	maxInspectedMessageSize = 8 * 1024
+)
+
+// dbCredentials holds (possibly partial) connection settings overriding those from connection uri
+type dbCredentials struct {
+	User     string
+	Password string
+	Host     string
+	Port     uint16
+	Database string
+}
+
+// credentialsCache caches credentials returned by fetch function for refreshInterval
+type credentialsCache struct {
+	fetch           func(ctx context.Context) (*dbCredentials, error)
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	mu        sync.Mutex
+	cached    *dbCredentials
+	fetchedAt time.Time
+}
+
+func newCredentialsCache(refreshInterval time.Duration, fetch func(ctx context.Context) (*dbCredentials, error)) *credentialsCache {
+	return &credentialsCache{
+		fetch:           fetch,
+		refreshInterval: refreshInterval,
+		now:             time.Now,
+	}
+}
+
+// invalidate drops cached credentials (unless they were already replaced) so that next connection fetches fresh ones
+func (c *credentialsCache) invalidate(credentials *dbCredentials) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached == credentials {
+		c.cached = nil
+	}
+}
+
+func (c *credentialsCache) get(ctx context.Context) (*dbCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached != nil && c.now().Sub(c.fetchedAt) < c.refreshInterval {
+		return c.cached, nil
+	}
+
+	credentials, err := c.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.cached = credentials
+	c.fetchedAt = c.now()
+	return credentials, nil
+}
+
+// beforeConnect applies cached credentials on every new physical connection made by the pool,
+// credentials rejected by server (e.g. password rotated before refreshInterval passed) are invalidated
+func (c *credentialsCache) beforeConnect(ctx context.Context, cfg *pgx.ConnConfig) error {
+	credentials, err := c.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	buildFrontend := cfg.BuildFrontend
+	if buildFrontend == nil {
+		buildFrontend = func(r io.Reader, w io.Writer) *pgproto3.Frontend { return pgproto3.NewFrontend(r, w) }
+	}
+	cfg.BuildFrontend = func(r io.Reader, w io.Writer) *pgproto3.Frontend {
+		return buildFrontend(&authErrorReader{r: r, onAuthError: func() { c.invalidate(credentials) }}, w)
+	}
+
+	if credentials.User != "" {
+		cfg.User = credentials.User
+	}
+	cfg.Password = credentials.Password
+	host, port := cfg.Host, cfg.Port
+	if credentials.Host != "" {
+		host = credentials.Host
+	}
+	if credentials.Port != 0 {
+		port = credentials.Port
+	}
+	if host != cfg.Host || port != cfg.Port {
+		retarget(cfg, host, port)
+	}
+	if credentials.Database != "" {
+		cfg.Database = credentials.Database
+	}
+	return nil
+}
+
+// retarget points connection config to given host and port together with TLS server name (verify-full, SNI)
+// and fallbacks (e.g. non-TLS fallback of sslmode=prefer). Fallbacks to other hosts of multi-host uri are dropped,
+// credentials name single host.
+func retarget(cfg *pgx.ConnConfig, host string, port uint16) {
+	fallbacks := make([]*pgconn.FallbackConfig, 0, len(cfg.Fallbacks))
+	for _, fallback := range cfg.Fallbacks {
+		if fallback.Host == cfg.Host && fallback.Port == cfg.Port {
+			fallbacks = append(fallbacks, &pgconn.FallbackConfig{Host: host, Port: port, TLSConfig: withServerName(fallback.TLSConfig, host)})
+		}
+	}
+	cfg.Host, cfg.Port = host, port
+	cfg.TLSConfig = withServerName(cfg.TLSConfig, host)
+	cfg.Fallbacks = fallbacks
+}
+
+// withServerName returns copy of TLS config verifying (or indicating) given host, config without server name is kept
+func withServerName(tlsConfig *tls.Config, host string) *tls.Config {
+	if tlsConfig == nil || tlsConfig.ServerName == "" {
+		return tlsConfig
+	}
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ServerName = host
+	return tlsConfig
+}
+
+// authErrorReader inspects messages server sends before authentication completes and calls onAuthError
+// when server rejects password, pgxpool has no hook for failed connection attempts
+type authErrorReader struct {
+	r           io.Reader
+	onAuthError func()
+
+	buf  []byte
+	done bool
+}
+
+func (a *authErrorReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if !a.done && n > 0 {
+		a.buf = append(a.buf, p[:n]...)
+		a.inspect()
+	}
+	return n, err
+}
+
+// inspect parses buffered messages: type byte, int32 length (including itself) and body
+func (a *authErrorReader) inspect() {
+	for len(a.buf) >= 5 {
+		length := int(binary.BigEndian.Uint32(a.buf[1:5]))
+		if length < 4 || length > maxInspectedMessageSize {
+			a.stop()
+			return
+		}
+		if len(a.buf) < 1+length {
+			return
+		}
+
+		body := a.buf[5 : 1+length]
+		switch a.buf[0] {
+		case 'R':
+			// AuthenticationOk, otherwise authentication continues
+			if len(body) >= 4 && binary.BigEndian.Uint32(body) == 0 {
+				a.stop()
+				return
+			}
+		case 'E':
+			if errorResponseCode(body) == pgErrCodeInvalidPassword {
+				a.onAuthError()
+			}
+			a.stop()
+			return
+		}
+		a.buf = a.buf[1+length:]
+	}
+}
+
+func (a *authErrorReader) stop() {
+	a.done = true
+	a.buf = nil
+}
+
+// errorResponseCode returns SQLSTATE of ErrorResponse body made of fields: type byte followed by string terminated by 0
+func errorResponseCode(body []byte) string {
+	for len(body) > 1 {
+		fieldType := body[0]
+		end := bytes.IndexByte(body[1:], 0)
+		if end < 0 {
+			return ""
+		}
+		if fieldType == 'C' {
+			return string(body[1 : 1+end])
+		}
+		body = body[2+end:]
+	}
+	return ""
+}
+
+// NewPostgresDBWithIAMAuth creates new postgres connection authenticated by RDS IAM auth tokens instead of static password.
+// uri must not contain password, e.g. postgres://iam_user@mydb.xxx.eu-central-1.rds.amazonaws.com:5432/db?sslmode=require
+// Token is signed with credentials from default aws config (see aws.LoadAwsConfig) and regenerated before expiry
+// whenever pool opens new connection (already opened connections stay valid after token expiry).
+func NewPostgresDBWithIAMAuth(ctx context.Context, uri string, awsRegion string) (*DB, error) {
+	awsConfig, err := aws.LoadAwsConfig(ctx, awsRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s:%d", poolConfig.ConnConfig.Host, poolConfig.ConnConfig.Port)
+	dbUser := poolConfig.ConnConfig.User
+	cache := newCredentialsCache(IAMTokenRefreshInterval, func(ctx context.Context) (*dbCredentials, error) {
+		token, err := auth.BuildAuthToken(ctx, endpoint, awsRegion, dbUser, awsConfig.Credentials)
+		if err != nil {
+			return nil, fmt.Errorf("cannot build rds iam auth token: %w", err)
+		}
+		return &dbCredentials{Password: token}, nil
+	})
+
+	return newPostgresDBWithCredentials(ctx, poolConfig, cache)
+}
+
+// NewPostgresDBFromSecret creates new postgres connection using credentials stored in AWS Secrets Manager
+// in standard RDS secret format: {"username": "...", "password": "...", "host": "...", "port": 5432, "dbname": "..."}
+// Settings present in the secret override those from uri, uri may hold just options, e.g. postgres://?sslmode=require
+// Secret is re-read at most every refreshInterval (DefaultSecretRefreshInterval if zero) when pool opens new connection
+// so that rotated password is picked up without restart, it is re-read immediately after server rejects the password.
+func NewPostgresDBFromSecret(ctx context.Context, uri string, secretID string, awsRegion string, refreshInterval time.Duration) (*DB, error) {
+	client, err := aws.CreateSecretsManagerClient(ctx, awsRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if refreshInterval <= 0 {
+		refreshInterval = DefaultSecretRefreshInterval
+	}
+	cache := newCredentialsCache(refreshInterval, func(ctx context.Context) (*dbCredentials, error) {
+		out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws_sdk.String(secretID)})
+		if err != nil {
+			return nil, fmt.Errorf("cannot read database secret: %w", err)
+		}
+		return parseRdsSecret(aws_sdk.ToString(out.SecretString))
+	})
+
+	return newPostgresDBWithCredentials(ctx, poolConfig, cache)
+}
+
+func newPostgresDBWithCredentials(ctx context.Context, poolConfig *pgxpool.Config, cache *credentialsCache) (*DB, error) {
+	poolConfig.BeforeConnect = cache.beforeConnect
+
+	db, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &DB{
+		db,
+	}, nil
+}
+
+// rdsSecret represents secret created by RDS/Secrets Manager rotation lambdas, port is number or string
+type rdsSecret struct {
+	Username string          `json:"username"`
+	Password string          `json:"password"`
+	Host     string          `json:"host"`
+	Port     json.RawMessage `json:"port"`
+	DbName   string          `json:"dbname"`
+}
+
+func parseRdsSecret(secretString string) (*dbCredentials, error) {
+	var secret rdsSecret
+	if err := json.Unmarshal([]byte(secretString), &secret); err != nil {
+		return nil, fmt.Errorf("cannot parse database secret: %w", err)
+	}
+	if secret.Password == "" {
+		return nil, errors.New("database secret does not contain password")
+	}
+
+	credentials := &dbCredentials{
+		User:     secret.Username,
+		Password: secret.Password,
+		Host:     secret.Host,
+		Database: secret.DbName,
+	}
+
+	if len(secret.Port) > 0 {
+		port, err := strconv.ParseUint(string(trimQuotes(secret.Port)), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in database secret: %w", err)
+		}
+		credentials.Port = uint16(port)
+	}
+
+	return credentials, nil
+}
+
+func trimQuotes(b []byte) []byte {
+	if len(b) >= 2 && b[0] == '"' && b[len(b)-1] == '"' {
+		return b[1 : len(b)-1]
+	}
+	return b
+}
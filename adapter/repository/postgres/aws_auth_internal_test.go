@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestCredentialsCacheRefresh(t *testing.T) {
+	fetched := 0
+	cache := newCredentialsCache(10*time.Minute, func(ctx context.Context) (*dbCredentials, error) {
+		fetched++
+		return &dbCredentials{Password: "token"}, nil
+	})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cfg := &pgx.ConnConfig{}
+	assert.Nil(t, cache.beforeConnect(context.Background(), cfg))
+	assert.Nil(t, cache.beforeConnect(context.Background(), cfg))
+	assert.Equal(t, "token", cfg.Password)
+	assert.Equal(t, 1, fetched)
+
+	now = now.Add(11 * time.Minute)
+	assert.Nil(t, cache.beforeConnect(context.Background(), cfg))
+	assert.Equal(t, 2, fetched)
+}
+
+func TestCredentialsCacheInvalidatedByRejectedPassword(t *testing.T) {
+	fetched := 0
+	cache := newCredentialsCache(10*time.Minute, func(ctx context.Context) (*dbCredentials, error) {
+		fetched++
+		return &dbCredentials{Password: "rotated-away"}, nil
+	})
+
+	// server messages are read by frontend in small chunks
+	connect := func(messages ...pgproto3.BackendMessage) {
+		cfg := &pgx.ConnConfig{}
+		assert.Nil(t, cache.beforeConnect(context.Background(), cfg))
+		var stream []byte
+		for _, m := range messages {
+			stream = m.Encode(stream)
+		}
+		frontend := cfg.BuildFrontend(iotest.OneByteReader(bytes.NewReader(stream)), io.Discard)
+		for range messages {
+			_, err := frontend.Receive()
+			assert.Nil(t, err)
+		}
+	}
+
+	connect(&pgproto3.AuthenticationOk{}, &pgproto3.ErrorResponse{Severity: "ERROR", Code: "28P01"})
+	connect(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"SCRAM-SHA-256"}}, &pgproto3.ErrorResponse{Severity: "ERROR", Code: "42P01"})
+	assert.Nil(t, cache.beforeConnect(context.Background(), &pgx.ConnConfig{}))
+	assert.Equal(t, 1, fetched)
+
+	connect(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{"SCRAM-SHA-256"}}, &pgproto3.ErrorResponse{Severity: "FATAL", Code: "28P01", Message: "password authentication failed"})
+	assert.Nil(t, cache.beforeConnect(context.Background(), &pgx.ConnConfig{}))
+	assert.Equal(t, 2, fetched)
+}
+
+func TestCredentialsCacheRetargetsHost(t *testing.T) {
+	cache := newCredentialsCache(10*time.Minute, func(ctx context.Context) (*dbCredentials, error) {
+		return &dbCredentials{Password: "secret", Host: "new.rds.amazonaws.com"}, nil
+	})
+
+	cfg, err := pgx.ParseConfig("postgres://app@old.rds.amazonaws.com:5432,replica.rds.amazonaws.com:5433/db?sslmode=verify-full")
+	assert.Nil(t, err)
+	assert.Nil(t, cache.beforeConnect(context.Background(), cfg))
+	assert.Equal(t, "new.rds.amazonaws.com", cfg.Host)
+	assert.Equal(t, uint16(5432), cfg.Port)
+	assert.Equal(t, "new.rds.amazonaws.com", cfg.TLSConfig.ServerName)
+	assert.Empty(t, cfg.Fallbacks)
+
+	cfg, err = pgx.ParseConfig("postgres://app@old.rds.amazonaws.com:5432/db?sslmode=prefer")
+	assert.Nil(t, err)
+	tlsConfig := cfg.TLSConfig
+	assert.Nil(t, cache.beforeConnect(context.Background(), cfg))
+	assert.Equal(t, "new.rds.amazonaws.com", cfg.TLSConfig.ServerName)
+	assert.Equal(t, "old.rds.amazonaws.com", tlsConfig.ServerName)
+	// non-TLS fallback of sslmode=prefer
+	assert.Len(t, cfg.Fallbacks, 1)
+	assert.Equal(t, "new.rds.amazonaws.com", cfg.Fallbacks[0].Host)
+	assert.Nil(t, cfg.Fallbacks[0].TLSConfig)
+}
+
+func TestParseRdsSecret(t *testing.T) {
+	credentials, err := parseRdsSecret(`{"username":"app","password":"pwd","engine":"postgres","host":"db.local","port":5432,"dbname":"players"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, &dbCredentials{User: "app", Password: "pwd", Host: "db.local", Port: 5432, Database: "players"}, credentials)
+
+	credentials, err = parseRdsSecret(`{"username":"app","password":"pwd","port":"6432"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(6432), credentials.Port)
+
+	_, err = parseRdsSecret(`{"username":"app"}`)
+	assert.NotNil(t, err)
+}
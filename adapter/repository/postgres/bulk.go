@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"strings"
+)
+
+const (
+	// DefaultBulkChunkSize is max number of rows sent in single COPY
+	DefaultBulkChunkSize = 50_000
+)
+
+// Copier is implemented by *DB, *pgxpool.Pool, *pgx.Conn and pgx.Tx
+type Copier interface {
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// RowIterator returns next item, ok=false signals end of input. Used to stream inputs not fitting into memory.
+type RowIterator[T any] func() (item T, ok bool, err error)
+
+// SliceIterator turns slice into RowIterator
+func SliceIterator[T any](items []T) RowIterator[T] {
+	i := 0
+	return func() (T, bool, error) {
+		if i >= len(items) {
+			var empty T
+			return empty, false, nil
+		}
+		i++
+		return items[i-1], true, nil
+	}
+}
+
+// BulkInsert inserts items into table using COPY protocol, toRow must return values in columns order.
+// Items are sent in chunks of chunkSize rows (DefaultBulkChunkSize if zero). Pass pgx.Tx as copier
+// to insert all chunks atomically. Returns number of inserted rows.
+func BulkInsert[T any](ctx context.Context, c Copier, table string, columns []string, items []T, toRow func(T) []any, chunkSize int) (int64, error) {
+	return BulkInsertIter(ctx, c, table, columns, SliceIterator(items), toRow, chunkSize)
+}
+
+// BulkInsertIter is BulkInsert streaming items from iterator
+func BulkInsertIter[T any](ctx context.Context, c Copier, table string, columns []string, next RowIterator[T], toRow func(T) []any, chunkSize int) (int64, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultBulkChunkSize
+	}
+
+	var total int64
+	for {
+		src := &chunkSource[T]{next: next, toRow: toRow, limit: chunkSize}
+		copied, err := c.CopyFrom(ctx, tableIdentifier(table), columns, src)
+		total += copied
+		if err != nil {
+			return total, TranslateError(err)
+		}
+		if src.exhausted {
+			return total, nil
+		}
+	}
+}
+
+// chunkSource adapts RowIterator to pgx.CopyFromSource, providing at most limit rows
+type chunkSource[T any] struct {
+	next      RowIterator[T]
+	toRow     func(T) []any
+	limit     int
+	count     int
+	current   T
+	err       error
+	exhausted bool
+}
+
+func (s *chunkSource[T]) Next() bool {
+	if s.count >= s.limit || s.err != nil {
+		return false
+	}
+
+	item, ok, err := s.next()
+	if err != nil {
+		s.err = err
+		return false
+	}
+	if !ok {
+		s.exhausted = true
+		return false
+	}
+
+	s.current = item
+	s.count++
+	return true
+}
+
+func (s *chunkSource[T]) Values() ([]any, error) {
+	return s.toRow(s.current), nil
+}
+
+func (s *chunkSource[T]) Err() error {
+	return s.err
+}
+
+// UpsertOptions configures BulkUpsert
+type UpsertOptions struct {
+	Table   string
+	Columns []string
+	// ConflictColumns identify existing rows, there must be unique index on them
+	ConflictColumns []string
+	// UpdateColumns are updated on conflict, defaults to Columns without ConflictColumns.
+	// If there is nothing to update conflicting rows are left untouched (ON CONFLICT DO NOTHING).
+	UpdateColumns []string
+	// ChunkSize is max number of rows copied and merged in single step, DefaultBulkChunkSize if zero
+	ChunkSize int
+}
+
+// UpsertResult reports outcome of BulkUpsert
+type UpsertResult struct {
+	Inserted int64
+	Updated  int64
+}
+
+// BulkUpsert copies items into temporary table and merges them into target table with INSERT ... ON CONFLICT,
+// all in single transaction. Large inputs are processed in chunks (temporary table is truncated between chunks).
+// If input contains multiple items with same conflict key arbitrary one of them wins.
+func BulkUpsert[T any](ctx context.Context, db *DB, opts UpsertOptions, items []T, toRow func(T) []any) (UpsertResult, error) {
+	return BulkUpsertIter(ctx, db, opts, SliceIterator(items), toRow)
+}
+
+// BulkUpsertIter is BulkUpsert streaming items from iterator
+func BulkUpsertIter[T any](ctx context.Context, db *DB, opts UpsertOptions, next RowIterator[T], toRow func(T) []any) (UpsertResult, error) {
+	var result UpsertResult
+
+	mergeSql, err := upsertMergeSql(opts)
+	if err != nil {
+		return result, err
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultBulkChunkSize
+	}
+
+	tmpTable := upsertTmpTable(opts.Table)
+	err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, fmt.Sprintf("CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+			pgx.Identifier{tmpTable}.Sanitize(), joinIdentifiers(opts.Columns), tableIdentifier(opts.Table).Sanitize()))
+		if err != nil {
+			return err
+		}
+
+		for {
+			src := &chunkSource[T]{next: next, toRow: toRow, limit: chunkSize}
+			if _, err := tx.CopyFrom(ctx, pgx.Identifier{tmpTable}, opts.Columns, src); err != nil {
+				return err
+			}
+
+			var inserted, updated int64
+			if err := tx.QueryRow(ctx, mergeSql).Scan(&inserted, &updated); err != nil {
+				return err
+			}
+			result.Inserted += inserted
+			result.Updated += updated
+
+			if src.exhausted {
+				return nil
+			}
+			if _, err := tx.Exec(ctx, "TRUNCATE "+pgx.Identifier{tmpTable}.Sanitize()); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return UpsertResult{}, TranslateError(err)
+	}
+
+	return result, nil
+}
+
+// upsertMergeSql builds statement merging temporary table into target table and counting inserted/updated rows
+// (xmax = 0 holds for freshly inserted rows only)
+func upsertMergeSql(opts UpsertOptions) (string, error) {
+	if opts.Table == "" || len(opts.Columns) == 0 || len(opts.ConflictColumns) == 0 {
+		return "", errors.New("BulkUpsert: table, columns and conflict columns must be set")
+	}
+
+	updateColumns := opts.UpdateColumns
+	if updateColumns == nil {
+		conflict := make(map[string]bool, len(opts.ConflictColumns))
+		for _, c := range opts.ConflictColumns {
+			conflict[c] = true
+		}
+		for _, c := range opts.Columns {
+			if !conflict[c] {
+				updateColumns = append(updateColumns, c)
+			}
+		}
+	}
+
+	onConflict := "DO NOTHING"
+	if len(updateColumns) > 0 {
+		assignments := make([]string, 0, len(updateColumns))
+		for _, c := range updateColumns {
+			column := pgx.Identifier{c}.Sanitize()
+			assignments = append(assignments, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+		}
+		onConflict = "DO UPDATE SET " + strings.Join(assignments, ", ")
+	}
+
+	columns := joinIdentifiers(opts.Columns)
+	conflictColumns := joinIdentifiers(opts.ConflictColumns)
+	return fmt.Sprintf(`WITH upserted AS (
+	INSERT INTO %s (%s)
+	SELECT DISTINCT ON (%s) %s FROM %s
+	ON CONFLICT (%s) %s
+	RETURNING (xmax = 0) AS inserted
+)
+SELECT COUNT(*) FILTER (WHERE inserted), COUNT(*) FILTER (WHERE NOT inserted) FROM upserted`,
+		tableIdentifier(opts.Table).Sanitize(), columns,
+		conflictColumns, columns, pgx.Identifier{upsertTmpTable(opts.Table)}.Sanitize(),
+		conflictColumns, onConflict), nil
+}
+
+func joinIdentifiers(names []string) string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, pgx.Identifier{name}.Sanitize())
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// tableIdentifier supports schema qualified table names, e.g. 'stats.match_player'
+func tableIdentifier(table string) pgx.Identifier {
+	return strings.Split(table, ".")
+}
+
+func upsertTmpTable(table string) string {
+	return "bulk_upsert_" + strings.ReplaceAll(table, ".", "_")
+}
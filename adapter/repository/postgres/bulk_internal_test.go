@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type fakeCopier struct {
+	chunks [][][]any
+}
+
+func (c *fakeCopier) CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error) {
+	var chunk [][]any
+	for rowSrc.Next() {
+		values, _ := rowSrc.Values()
+		chunk = append(chunk, values)
+	}
+	c.chunks = append(c.chunks, chunk)
+	return int64(len(chunk)), rowSrc.Err()
+}
+
+type matchStat struct {
+	MatchID  int64
+	PlayerID int64
+	Goals    int
+}
+
+func TestBulkInsertChunks(t *testing.T) {
+	stats := make([]matchStat, 0, 5)
+	for i := 0; i < 5; i++ {
+		stats = append(stats, matchStat{MatchID: 1, PlayerID: int64(i), Goals: i})
+	}
+
+	copier := &fakeCopier{}
+	inserted, err := BulkInsert(context.Background(), copier, "match_stat", []string{"match_id", "player_id", "goals"}, stats,
+		func(s matchStat) []any { return []any{s.MatchID, s.PlayerID, s.Goals} }, 2)
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), inserted)
+	assert.Len(t, copier.chunks, 3)
+	assert.Equal(t, []any{int64(1), int64(4), 4}, copier.chunks[2][0])
+}
+
+func TestUpsertMergeSql(t *testing.T) {
+	sql, err := upsertMergeSql(UpsertOptions{
+		Table:           "stats.match_stat",
+		Columns:         []string{"match_id", "player_id", "goals"},
+		ConflictColumns: []string{"match_id", "player_id"},
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, sql, `INSERT INTO "stats"."match_stat" ("match_id", "player_id", "goals")`)
+	assert.Contains(t, sql, `SELECT DISTINCT ON ("match_id", "player_id") "match_id", "player_id", "goals" FROM "bulk_upsert_stats_match_stat"`)
+	assert.Contains(t, sql, `ON CONFLICT ("match_id", "player_id") DO UPDATE SET "goals" = EXCLUDED."goals"`)
+
+	sql, err = upsertMergeSql(UpsertOptions{
+		Table:           "match_stat",
+		Columns:         []string{"match_id", "player_id"},
+		ConflictColumns: []string{"match_id", "player_id"},
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, sql, "DO NOTHING")
+
+	_, err = upsertMergeSql(UpsertOptions{Table: "match_stat"})
+	assert.NotNil(t, err)
+}
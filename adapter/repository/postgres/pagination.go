@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/hrsupersport/hrnogomet-backend-kit/pagination"
+	"github.com/jackc/pgx/v5"
+	"strings"
+)
+
+// KeysetQuery wraps base query (which must use positional $1..$n arguments, not named ones) into
+//
+//	SELECT * FROM (<baseSql>) AS keyset_page WHERE (sort_cols) > (cursor) ORDER BY sort_cols LIMIT limit+1
+//
+// Sort columns must be present in base query output. When paging backward comparison and ordering are reversed,
+// rows must then be reversed back which is done by QueryKeysetPage. Returned args are base args followed by cursor values.
+func KeysetQuery(baseSql string, req *pagination.PageRequest, args ...any) (string, []any) {
+	backward := req.Backward()
+	var sb strings.Builder
+	sb.WriteString("SELECT * FROM (")
+	sb.WriteString(baseSql)
+	sb.WriteString(") AS keyset_page")
+
+	if req.Cursor != nil && len(req.Sort) > 0 {
+		firstParam := len(args) + 1
+		args = append(args, req.Cursor.Values...)
+		sb.WriteString(" WHERE ")
+		sb.WriteString(keysetCondition(req.Sort, firstParam, backward))
+	}
+
+	sb.WriteString(orderByClause(req.Sort, backward))
+	sb.WriteString(fmt.Sprintf(" LIMIT %d", req.Limit+1))
+
+	return sb.String(), args
+}
+
+// OffsetQuery appends ORDER BY, LIMIT limit+1 and OFFSET to base query, use together with pagination.NewOffsetPage
+func OffsetQuery(baseSql string, req *pagination.PageRequest) string {
+	return fmt.Sprintf("%s%s LIMIT %d OFFSET %d", baseSql, orderByClause(req.Sort, false), req.Limit+1, req.Offset)
+}
+
+// QueryKeysetPage runs query built by KeysetQuery and returns at most req.Limit rows in requested sort order
+// together with flag whether there are more rows in direction of pagination, see pagination.NewKeysetPage
+func QueryKeysetPage[T any](ctx context.Context, q Querier, baseSql string, req *pagination.PageRequest, args ...any) ([]T, bool, error) {
+	sql, allArgs := KeysetQuery(baseSql, req, args...)
+	items, err := QueryAll[T](ctx, q, sql, allArgs...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(items) > req.Limit
+	if hasMore {
+		items = items[:req.Limit]
+	}
+
+	if req.Backward() {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	return items, hasMore, nil
+}
+
+// keysetCondition builds condition selecting rows after (or before if backward) cursor.
+// If all sort fields have same direction row value comparison is used which can utilize composite index,
+// otherwise expanded form is generated: (a > $1) OR (a = $1 AND b < $2) OR ...
+func keysetCondition(sort []pagination.SortField, firstParam int, backward bool) string {
+	sameDirection := true
+	for _, s := range sort {
+		if s.Desc != sort[0].Desc {
+			sameDirection = false
+			break
+		}
+	}
+
+	if sameDirection {
+		columns := make([]string, 0, len(sort))
+		params := make([]string, 0, len(sort))
+		for i, s := range sort {
+			columns = append(columns, pgx.Identifier{s.Column}.Sanitize())
+			params = append(params, fmt.Sprintf("$%d", firstParam+i))
+		}
+		return fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), comparisonOperator(sort[0], backward), strings.Join(params, ", "))
+	}
+
+	alternatives := make([]string, 0, len(sort))
+	for i := range sort {
+		terms := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, fmt.Sprintf("%s = $%d", pgx.Identifier{sort[j].Column}.Sanitize(), firstParam+j))
+		}
+		terms = append(terms, fmt.Sprintf("%s %s $%d", pgx.Identifier{sort[i].Column}.Sanitize(), comparisonOperator(sort[i], backward), firstParam+i))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")"
+}
+
+func comparisonOperator(s pagination.SortField, backward bool) string {
+	if s.Desc != backward {
+		return "<"
+	}
+	return ">"
+}
+
+func orderByClause(sort []pagination.SortField, backward bool) string {
+	if len(sort) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(sort))
+	for _, s := range sort {
+		direction := "ASC"
+		if s.Desc != backward {
+			direction = "DESC"
+		}
+		parts = append(parts, pgx.Identifier{s.Column}.Sanitize()+" "+direction)
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,48 @@
+package postgres_test
+
+import (
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/hrsupersport/hrnogomet-backend-kit/pagination"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKeysetQueryFirstPage(t *testing.T) {
+	req := &pagination.PageRequest{Limit: 20, Sort: []pagination.SortField{{Column: "name"}, {Column: "id"}}}
+
+	sql, args := postgres.KeysetQuery("SELECT id, name FROM player WHERE club_id = $1", req, 7)
+
+	assert.Equal(t, `SELECT * FROM (SELECT id, name FROM player WHERE club_id = $1) AS keyset_page ORDER BY "name" ASC, "id" ASC LIMIT 21`, sql)
+	assert.Equal(t, []any{7}, args)
+}
+
+func TestKeysetQueryRowValueComparison(t *testing.T) {
+	req := &pagination.PageRequest{
+		Limit:  20,
+		Sort:   []pagination.SortField{{Column: "created_at", Desc: true}, {Column: "id", Desc: true}},
+		Cursor: &pagination.Cursor{Values: []any{"2024-01-01T00:00:00Z", int64(5)}},
+	}
+
+	sql, args := postgres.KeysetQuery("SELECT * FROM player WHERE club_id = $1", req, 7)
+
+	assert.Equal(t, `SELECT * FROM (SELECT * FROM player WHERE club_id = $1) AS keyset_page WHERE ("created_at", "id") < ($2, $3) ORDER BY "created_at" DESC, "id" DESC LIMIT 21`, sql)
+	assert.Equal(t, []any{7, "2024-01-01T00:00:00Z", int64(5)}, args)
+}
+
+func TestKeysetQueryMixedDirectionsBackward(t *testing.T) {
+	req := &pagination.PageRequest{
+		Limit:  10,
+		Sort:   []pagination.SortField{{Column: "name"}, {Column: "id", Desc: true}},
+		Cursor: &pagination.Cursor{Values: []any{"Luka", int64(5)}, Backward: true},
+	}
+
+	sql, _ := postgres.KeysetQuery("SELECT * FROM player", req)
+
+	assert.Equal(t, `SELECT * FROM (SELECT * FROM player) AS keyset_page WHERE (("name" < $1) OR ("name" = $1 AND "id" > $2)) ORDER BY "name" DESC, "id" ASC LIMIT 11`, sql)
+}
+
+func TestOffsetQuery(t *testing.T) {
+	req := &pagination.PageRequest{Limit: 10, Offset: 30, Sort: []pagination.SortField{{Column: "name"}}}
+
+	assert.Equal(t, `SELECT * FROM player ORDER BY "name" ASC LIMIT 11 OFFSET 30`, postgres.OffsetQuery("SELECT * FROM player", req))
+}
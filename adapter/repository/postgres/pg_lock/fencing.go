@@ -0,0 +1,48 @@
+package pg_lock
+
+import (
+	"context"
+	"fmt"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/hrsupersport/hrnogomet-backend-kit/lock"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// DefaultFencingTable is table remembering highest fencing token seen per resource
+	DefaultFencingTable = "fencing_tokens"
+)
+
+// FencingSchema returns DDL of fencing table (DefaultFencingTable if table is empty), include it in service migrations
+func FencingSchema(table string) string {
+	if table == "" {
+		table = DefaultFencingTable
+	}
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	resource TEXT PRIMARY KEY,
+	token BIGINT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);`, pgx.Identifier{table}.Sanitize())
+}
+
+// CheckFencingToken records token (see lock.FencedLock) of lock guarding given resource and fails with error
+// wrapping lock.ErrStaleFencingToken if newer holder already wrote to the resource. Call it in the same
+// transaction as the guarded writes, concurrent writers are serialized on the fencing row until commit.
+// Empty table means DefaultFencingTable.
+func CheckFencingToken(ctx context.Context, tx pgx.Tx, table string, resource string, token int64) error {
+	if table == "" {
+		table = DefaultFencingTable
+	}
+	identifier := pgx.Identifier{table}.Sanitize()
+
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (resource, token) VALUES ($1, $2)
+		ON CONFLICT (resource) DO UPDATE SET token = EXCLUDED.token, updated_at = now()
+		WHERE %s.token <= EXCLUDED.token`, identifier, identifier), resource, token)
+	if err != nil {
+		return postgres.TranslateError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: resource '%s' was written with token newer than %d", lock.ErrStaleFencingToken, resource, token)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package pg_lock
+
+/*
+Distributed lock using postgres advisory locks, alternative to dynamodb lock (see aws/dynamodb/dist_lock package)
+for services having postgres but no dynamodb table.
+
+Session locks are held by dedicated connection taken out of the pool for the whole time the lock is held,
+if that connection dies (process crash, network failure) postgres releases the lock automatically.
+Connection is pinged periodically and lock is reported as lost (see lock.Lock) once ping fails.
+Transaction locks are bound to the transaction and released on commit or rollback.
+Lock names are hashed into 64 bit advisory lock keys (see LockKey).
+*/
+
+import (
+	"context"
+	"fmt"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/hrsupersport/hrnogomet-backend-kit/lock"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRetryInterval is interval between attempts to get the lock while waiting for it
+	DefaultRetryInterval = 100 * time.Millisecond
+	// DefaultConnCheckInterval is interval between pings of connection holding session lock, failed ping means lock is lost
+	DefaultConnCheckInterval = 5 * time.Second
+)
+
+var (
+	_ lock.Locker = (*PostgresLocker)(nil)
+	_ lock.Lock   = (*distributedPostgresLock)(nil)
+)
+
+// PostgresLocker acquires session advisory locks
+type PostgresLocker struct {
+	db                *postgres.DB
+	connCheckInterval time.Duration
+}
+
+// NewPostgresLocker creates locker, connection holding each lock is pinged every connCheckInterval
+// (DefaultConnCheckInterval if zero) and lock is reported as lost once ping fails
+func NewPostgresLocker(db *postgres.DB, connCheckInterval time.Duration) *PostgresLocker {
+	if connCheckInterval <= 0 {
+		connCheckInterval = DefaultConnCheckInterval
+	}
+	return &PostgresLocker{
+		db:                db,
+		connCheckInterval: connCheckInterval,
+	}
+}
+
+// Acquire waits until lock is acquired or ctx is done
+func (l *PostgresLocker) Acquire(ctx context.Context, key string) (lock.Lock, error) {
+	if held, err := l.acquire(ctx, key, -1); err != nil {
+		return nil, err
+	} else {
+		return held, nil
+	}
+}
+
+// TryAcquire makes single attempt, error wrapping lock.ErrLockNotGranted is returned if lock is held by someone else
+func (l *PostgresLocker) TryAcquire(ctx context.Context, key string) (lock.Lock, error) {
+	if held, err := l.acquire(ctx, key, 0); err != nil {
+		return nil, err
+	} else {
+		return held, nil
+	}
+}
+
+type distributedPostgresLock struct {
+	*lock.LockState
+	lockName string
+	key      int64
+	// mu guards conn, pgx connection is not safe for concurrent use
+	mu   sync.Mutex
+	conn *pgxpool.Conn
+}
+
+// LockKey hashes lock name into advisory lock key (FNV-1a), same name always gives same key
+func LockKey(lockName string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(lockName))
+	return int64(h.Sum64())
+}
+
+// NewDistributedPostgresLock acquires session advisory lock, waiting at most waitTimeout for it
+// (zero waitTimeout makes single attempt only, see TryLock). Error wrapping lock.ErrLockNotGranted
+// is returned if lock is not acquired in time.
+func NewDistributedPostgresLock(ctx context.Context, db *postgres.DB, lockName string, waitTimeout time.Duration) (lock.DistributedLock, error) {
+	if held, err := NewPostgresLocker(db, 0).acquire(ctx, lockName, waitTimeout); err != nil {
+		return nil, err
+	} else {
+		return held, nil
+	}
+}
+
+// TryLock acquires session advisory lock if it is free, error wrapping lock.ErrLockNotGranted is returned otherwise
+func TryLock(ctx context.Context, db *postgres.DB, lockName string) (lock.DistributedLock, error) {
+	return NewDistributedPostgresLock(ctx, db, lockName, 0)
+}
+
+// acquire tries to get the lock until waitTimeout elapses, negative waitTimeout means waiting until ctx is done
+func (l *PostgresLocker) acquire(ctx context.Context, lockName string, waitTimeout time.Duration) (*distributedPostgresLock, error) {
+	conn, err := l.db.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := LockKey(lockName)
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		acquired, err := tryAdvisoryLock(ctx, conn.Conn(), "pg_try_advisory_lock", key)
+		if err != nil {
+			conn.Release()
+			return nil, err
+		}
+		if acquired {
+			held := &distributedPostgresLock{
+				LockState: lock.NewLockState(ctx),
+				lockName:  lockName,
+				key:       key,
+				conn:      conn,
+			}
+			go held.watchConn(l.connCheckInterval)
+			return held, nil
+		}
+
+		retryInterval := DefaultRetryInterval
+		if waitTimeout >= 0 {
+			if !time.Now().Before(deadline) {
+				conn.Release()
+				return nil, fmt.Errorf("%w: lock '%s' is held by another session", lock.ErrLockNotGranted, lockName)
+			}
+			retryInterval = min(retryInterval, time.Until(deadline))
+		}
+
+		select {
+		case <-ctx.Done():
+			conn.Release()
+			return nil, ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (l *distributedPostgresLock) Key() string {
+	return l.lockName
+}
+
+// Release releases the lock and returns connection to the pool
+func (l *distributedPostgresLock) Release(ctx context.Context) error {
+	l.MarkReleased()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+	conn := l.conn
+	l.conn = nil
+
+	var released bool
+	if err := conn.QueryRow(ctx, "SELECT pg_advisory_unlock($1)", l.key).Scan(&released); err != nil {
+		// connection is broken (lock is released by postgres then) or state is unknown, never return it to the pool
+		_ = conn.Conn().Close(context.Background())
+		conn.Release()
+		return err
+	}
+	conn.Release()
+
+	if !released {
+		return fmt.Errorf("Release: lock '%s' was not held", l.lockName)
+	}
+	return nil
+}
+
+// ReleaseLock releases the lock and returns connection to the pool
+func (l *distributedPostgresLock) ReleaseLock() error {
+	return l.Release(context.Background())
+}
+
+// watchConn pings connection holding the lock, postgres releases session locks of dead connections
+func (l *distributedPostgresLock) watchConn(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.Context().Done():
+			return
+		case <-ticker.C:
+			if err := l.ping(interval); err != nil {
+				log.Warn().Err(err).Str("key", l.lockName).Msg("postgres lock: connection holding the lock is broken, lock is lost")
+				l.MarkLost()
+				return
+			}
+		}
+	}
+}
+
+func (l *distributedPostgresLock) ping(timeout time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		return nil
+	}
+
+	// not bound to lock context, cancelled query would break the connection and fail subsequent Release
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return l.conn.Ping(ctx)
+}
+
+// LockInTransaction acquires transaction advisory lock, waiting for it until ctx is done.
+// Lock is released automatically when tx is committed or rolled back.
+func LockInTransaction(ctx context.Context, tx pgx.Tx, lockName string) error {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", LockKey(lockName))
+	return err
+}
+
+// TryLockInTransaction acquires transaction advisory lock if it is free, error wrapping lock.ErrLockNotGranted
+// is returned otherwise. Lock is released automatically when tx is committed or rolled back.
+func TryLockInTransaction(ctx context.Context, tx pgx.Tx, lockName string) error {
+	acquired, err := tryAdvisoryLock(ctx, tx, "pg_try_advisory_xact_lock", LockKey(lockName))
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return fmt.Errorf("%w: lock '%s' is held by another session", lock.ErrLockNotGranted, lockName)
+	}
+	return nil
+}
+
+func tryAdvisoryLock(ctx context.Context, q postgres.Querier, function string, key int64) (bool, error) {
+	var acquired bool
+	if err := q.QueryRow(ctx, "SELECT "+function+"($1)", key).Scan(&acquired); err != nil {
+		return false, err
+	}
+	return acquired, nil
+}
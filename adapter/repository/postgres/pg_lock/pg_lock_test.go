@@ -0,0 +1,119 @@
+package pg_lock_test
+
+import (
+	"context"
+	"errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres/pg_lock"
+	"github.com/hrsupersport/hrnogomet-backend-kit/lock"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLockKey(t *testing.T) {
+	assert.Equal(t, pg_lock.LockKey("foo"), pg_lock.LockKey("foo"))
+	assert.NotEqual(t, pg_lock.LockKey("foo"), pg_lock.LockKey("bar"))
+}
+
+func TstDistributedLockWithPostgresHappyPath(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pg := test.SetupPostgresDB(ctx, "user", "test", "testdb")
+	defer pg.TeardownPostgresDB()
+
+	db, err := postgres.NewPostgresDBFromUri(ctx, pg.URI)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	held, err := pg_lock.NewDistributedPostgresLock(ctx, db, "foo", time.Second)
+	assert.Nil(t, err)
+
+	// lock is held, other session gives up after timeout
+	_, err = pg_lock.NewDistributedPostgresLock(ctx, db, "foo", 300*time.Millisecond)
+	assert.True(t, errors.Is(err, lock.ErrLockNotGranted))
+
+	err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		return pg_lock.TryLockInTransaction(ctx, tx, "foo")
+	})
+	assert.True(t, errors.Is(err, lock.ErrLockNotGranted))
+
+	// waiting session gets the lock once it is released
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		assert.Nil(t, held.ReleaseLock())
+	}()
+	second, err := pg_lock.NewDistributedPostgresLock(ctx, db, "foo", 5*time.Second)
+	assert.Nil(t, err)
+	assert.Nil(t, second.ReleaseLock())
+
+	held, err = pg_lock.TryLock(ctx, db, "foo")
+	assert.Nil(t, err)
+	assert.Nil(t, held.ReleaseLock())
+}
+
+func TstPostgresLockerReportsLostLock(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pg := test.SetupPostgresDB(ctx, "user", "test", "testdb")
+	defer pg.TeardownPostgresDB()
+
+	db, err := postgres.NewPostgresDBFromUri(ctx, pg.URI)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	locker := pg_lock.NewPostgresLocker(db, 200*time.Millisecond)
+	held, err := locker.Acquire(ctx, "foo")
+	assert.Nil(t, err)
+
+	_, err = locker.TryAcquire(ctx, "foo")
+	assert.True(t, errors.Is(err, lock.ErrLockNotGranted))
+
+	// kill session holding the lock
+	_, err = db.Exec(ctx, "SELECT pg_terminate_backend(pid) FROM pg_locks WHERE locktype = 'advisory' AND pid <> pg_backend_pid()")
+	assert.Nil(t, err)
+
+	select {
+	case <-held.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock loss not reported")
+	}
+	assert.NotNil(t, held.Context().Err())
+
+	second, err := locker.TryAcquire(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Nil(t, second.Release(ctx))
+}
+
+func TstCheckFencingTokenRejectsStaleHolder(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pg := test.SetupPostgresDB(ctx, "user", "test", "testdb")
+	defer pg.TeardownPostgresDB()
+
+	db, err := postgres.NewPostgresDBFromUri(ctx, pg.URI)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(ctx, pg_lock.FencingSchema(""))
+	assert.Nil(t, err)
+
+	check := func(token int64) error {
+		return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+			return pg_lock.CheckFencingToken(ctx, tx, "", "standings", token)
+		})
+	}
+
+	assert.Nil(t, check(1))
+	assert.Nil(t, check(2))
+	assert.Nil(t, check(2))
+	assert.True(t, errors.Is(check(1), lock.ErrStaleFencingToken))
+}
@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	service_errors "github.com/hrsupersport/hrnogomet-backend-kit/errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// postgres error codes translated by TranslateError
+// see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgErrCodeUniqueViolation         = "23505"
+	pgErrCodeForeignKeyViolation     = "23503"
+	pgErrCodeNotNullViolation        = "23502"
+	pgErrCodeCheckViolation          = "23514"
+	pgErrCodeInvalidTextRepresention = "22P02"
+	pgErrCodeStringDataRightTrunc    = "22001"
+)
+
+// NamedArgs can be passed as the only query argument to use @name placeholders instead of $1, $2, ...
+// e.g. QueryOne[Player](ctx, db, "SELECT * FROM player WHERE id = @id", NamedArgs{"id": 1})
+type NamedArgs = pgx.NamedArgs
+
+// Querier is common subset of *DB, *pgxpool.Pool, *pgx.Conn and pgx.Tx so that
+// helpers below can be used both outside and inside of transaction
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// QueryOne runs query and scans first returned row into struct T matching columns to fields by name
+// (field name or `db` tag). ServiceErrorNotFound is returned if query returns no rows.
+func QueryOne[T any](ctx context.Context, q Querier, sql string, args ...any) (T, error) {
+	var empty T
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return empty, TranslateError(err)
+	}
+
+	if item, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[T]); err != nil {
+		return empty, TranslateError(err)
+	} else {
+		return item, nil
+	}
+}
+
+// QueryAll runs query and scans all returned rows into slice of structs T matching columns to fields by name.
+// Empty (non nil) slice is returned if query returns no rows.
+func QueryAll[T any](ctx context.Context, q Querier, sql string, args ...any) ([]T, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, TranslateError(err)
+	}
+
+	items, err := pgx.CollectRows(rows, pgx.RowToStructByName[T])
+	if err != nil {
+		return nil, TranslateError(err)
+	}
+
+	if items == nil {
+		items = []T{}
+	}
+	return items, nil
+}
+
+// Exec runs statement not returning any rows (UPDATE, DELETE, ...) and returns number of affected rows
+func Exec(ctx context.Context, q Querier, sql string, args ...any) (int64, error) {
+	if tag, err := q.Exec(ctx, sql, args...); err != nil {
+		return 0, TranslateError(err)
+	} else {
+		return tag.RowsAffected(), nil
+	}
+}
+
+// InsertReturning runs INSERT (or UPDATE) statement with RETURNING clause and scans returned row into struct T,
+// e.g. InsertReturning[Player](ctx, tx, "INSERT INTO player (name) VALUES (@name) RETURNING *", NamedArgs{"name": "Luka"})
+func InsertReturning[T any](ctx context.Context, q Querier, sql string, args ...any) (T, error) {
+	return QueryOne[T](ctx, q, sql, args...)
+}
+
+// TranslateError translates pgx/postgres errors into protocol agnostic service errors (see errors package)
+// so that repositories return consistent errors which are then translated into REST API errors by handlers:
+//   - no rows => ServiceErrorNotFound
+//   - unique constraint violation => ServiceErrorConflict
+//   - foreign key, not null or check constraint violation, invalid input => ServiceErrorBadRequest
+//   - anything else => ServiceErrorInternalServerError
+func TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return service_errors.NewServiceErrorNotFound(err, "")
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgErrCodeUniqueViolation:
+			return service_errors.NewServiceErrorConflict(err, "")
+		case pgErrCodeForeignKeyViolation,
+			pgErrCodeNotNullViolation,
+			pgErrCodeCheckViolation,
+			pgErrCodeInvalidTextRepresention,
+			pgErrCodeStringDataRightTrunc:
+			return service_errors.NewServiceErrorBadRequest(err, "")
+		}
+	}
+
+	return service_errors.NewServiceErrorInternalServerError(err, "")
+}
@@ -0,0 +1,103 @@
+package postgres_test
+
+import (
+	"context"
+	errorHelper "errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	service_errors "github.com/hrsupersport/hrnogomet-backend-kit/errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rotisserie/eris"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTranslateErrorNil(t *testing.T) {
+	assert.Nil(t, postgres.TranslateError(nil))
+}
+
+func TestTranslateErrorNoRows(t *testing.T) {
+	err := postgres.TranslateError(pgx.ErrNoRows)
+
+	var target *service_errors.ServiceErrorNotFound
+	assert.True(t, eris.As(err, &target))
+}
+
+func TestTranslateErrorUniqueViolation(t *testing.T) {
+	err := postgres.TranslateError(&pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"})
+
+	var target *service_errors.ServiceErrorConflict
+	assert.True(t, eris.As(err, &target))
+}
+
+func TestTranslateErrorForeignKeyViolation(t *testing.T) {
+	err := postgres.TranslateError(&pgconn.PgError{Code: "23503", Message: "violates foreign key constraint"})
+
+	var target *service_errors.ServiceErrorBadRequest
+	assert.True(t, eris.As(err, &target))
+}
+
+func TestTranslateErrorOther(t *testing.T) {
+	err := postgres.TranslateError(errorHelper.New("connection reset"))
+
+	var target *service_errors.ServiceErrorInternalServerError
+	assert.True(t, eris.As(err, &target))
+}
+
+type player struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func TstQueryHelpers(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pg := test.SetupPostgresDB(ctx, "user", "test", "testdb")
+	defer pg.TeardownPostgresDB()
+
+	db, err := postgres.NewPostgresDBFromUri(ctx, pg.URI)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	_, err = postgres.Exec(ctx, db, "CREATE TABLE player (id BIGSERIAL PRIMARY KEY, name TEXT NOT NULL UNIQUE)")
+	assert.Nil(t, err)
+
+	players, err := postgres.QueryAll[player](ctx, db, "SELECT * FROM player")
+	assert.Nil(t, err)
+	assert.NotNil(t, players)
+	assert.Empty(t, players)
+
+	inserted, err := postgres.InsertReturning[player](ctx, db, "INSERT INTO player (name) VALUES (@name) RETURNING *", postgres.NamedArgs{"name": "Luka"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Luka", inserted.Name)
+	_, err = postgres.InsertReturning[player](ctx, db, "INSERT INTO player (name) VALUES ($1) RETURNING *", "Ivan")
+	assert.Nil(t, err)
+
+	_, err = postgres.InsertReturning[player](ctx, db, "INSERT INTO player (name) VALUES ($1) RETURNING *", "Luka")
+	var conflict *service_errors.ServiceErrorConflict
+	assert.True(t, eris.As(err, &conflict))
+
+	found, err := postgres.QueryOne[player](ctx, db, "SELECT * FROM player WHERE id = $1", inserted.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, inserted, found)
+
+	_, err = postgres.QueryOne[player](ctx, db, "SELECT * FROM player WHERE id = $1", -1)
+	var notFound *service_errors.ServiceErrorNotFound
+	assert.True(t, eris.As(err, &notFound))
+
+	players, err = postgres.QueryAll[player](ctx, db, "SELECT * FROM player ORDER BY id")
+	assert.Nil(t, err)
+	assert.Len(t, players, 2)
+	assert.Equal(t, "Ivan", players[1].Name)
+
+	affected, err := postgres.Exec(ctx, db, "UPDATE player SET name = upper(name)")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), affected)
+	affected, err = postgres.Exec(ctx, db, "DELETE FROM player WHERE id = $1", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), affected)
+}
@@ -0,0 +1,253 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultHealthCheckInterval = 5 * time.Second
+	DefaultMaxReplicationLag   = 10 * time.Second
+	// DefaultReplicationLagQuery works for standard postgres streaming replication (returns 0 on primary and on replica
+	// which is streaming WAL and replayed all of it, time since last replayed transaction grows while primary is idle).
+	// Replica whose WAL receiver is not streaming reports time since last replayed transaction. Status of WAL receiver
+	// is visible to roles with pg_read_all_stats only, running receiver is considered streaming for other roles.
+	// For Aurora use e.g. "SELECT COALESCE(MAX(replica_lag_in_msec), 0) / 1000.0 FROM aurora_replica_status()"
+	DefaultReplicationLagQuery = "SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() " +
+		"AND EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming') THEN 0 " +
+		"ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END::float8"
+)
+
+// WithReadOnly marks context so that queries made with it via ReplicatedDB outside of transaction are routed to replicas
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, constants.ContextKeyReadOnly{}, true)
+}
+
+// IsReadOnly returns true if context was marked with WithReadOnly
+func IsReadOnly(ctx context.Context) bool {
+	val, ok := ctx.Value(constants.ContextKeyReadOnly{}).(bool)
+	return ok && val
+}
+
+// ReplicaConfig configures replica health checking
+type ReplicaConfig struct {
+	// HealthCheckInterval is interval between replica health checks, DefaultHealthCheckInterval if zero
+	HealthCheckInterval time.Duration
+	// MaxReplicationLag is max tolerated replication lag, lagging replicas are ejected, DefaultMaxReplicationLag if zero
+	MaxReplicationLag time.Duration
+	// ReplicationLagQuery returns replication lag in seconds (float8), DefaultReplicationLagQuery if empty
+	ReplicationLagQuery string
+}
+
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// ReplicatedDB holds primary and replica pools (e.g. Aurora writer and reader endpoints).
+// Exec, Begin and all queries without read-only flag go to primary. Queries with context marked
+// by WithReadOnly go to healthy replicas (round-robin) and fall back to primary if no replica is healthy
+// or replica fails with connection error. Replicas are periodically health checked, replicas failing ping
+// or lagging more than MaxReplicationLag are ejected until they recover.
+type ReplicatedDB struct {
+	Primary  *DB
+	replicas []*replica
+	next     atomic.Uint64
+	cfg      ReplicaConfig
+	stop     context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+var _ Querier = (*ReplicatedDB)(nil)
+
+// NewReplicatedDBFromUris creates primary and replica pools and starts health checking of replicas
+func NewReplicatedDBFromUris(ctx context.Context, primaryUri string, replicaUris []string, cfg ReplicaConfig) (*ReplicatedDB, error) {
+	primary, err := NewPostgresDBFromUri(ctx, primaryUri)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaPools := make([]*pgxpool.Pool, 0, len(replicaUris))
+	for _, uri := range replicaUris {
+		pool, err := pgxpool.New(ctx, uri)
+		if err != nil {
+			primary.Close()
+			for _, p := range replicaPools {
+				p.Close()
+			}
+			return nil, err
+		}
+		replicaPools = append(replicaPools, pool)
+	}
+
+	return NewReplicatedDB(primary, replicaPools, cfg), nil
+}
+
+// NewReplicatedDB creates replicated database from existing pools and starts health checking of replicas
+func NewReplicatedDB(primary *DB, replicaPools []*pgxpool.Pool, cfg ReplicaConfig) *ReplicatedDB {
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	if cfg.MaxReplicationLag <= 0 {
+		cfg.MaxReplicationLag = DefaultMaxReplicationLag
+	}
+	if cfg.ReplicationLagQuery == "" {
+		cfg.ReplicationLagQuery = DefaultReplicationLagQuery
+	}
+
+	db := &ReplicatedDB{
+		Primary: primary,
+		cfg:     cfg,
+	}
+	for _, pool := range replicaPools {
+		db.replicas = append(db.replicas, &replica{pool: pool})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	db.stop = cancel
+	db.checkReplicas(ctx)
+	db.wg.Add(1)
+	go db.healthCheckLoop(ctx)
+
+	return db
+}
+
+// Exec always runs on primary
+func (db *ReplicatedDB) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return db.Primary.Exec(ctx, sql, arguments...)
+}
+
+// Query runs on replica if ctx is marked read-only, on primary otherwise
+func (db *ReplicatedDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	if r := db.pickReplica(ctx); r != nil {
+		rows, err := r.pool.Query(ctx, sql, args...)
+		if err == nil || !isConnectionError(err) {
+			return rows, err
+		}
+		db.eject(r, err)
+	}
+	return db.Primary.Query(ctx, sql, args...)
+}
+
+// QueryRow runs on replica if ctx is marked read-only, on primary otherwise
+// errors are reported only during Scan therefore there is no fallback to primary, unlike for Query
+func (db *ReplicatedDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if r := db.pickReplica(ctx); r != nil {
+		return r.pool.QueryRow(ctx, sql, args...)
+	}
+	return db.Primary.QueryRow(ctx, sql, args...)
+}
+
+// Begin always starts transaction on primary
+func (db *ReplicatedDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return db.Primary.Begin(ctx)
+}
+
+// Reader returns querier for read-only queries: healthy replica (round-robin) or primary if there is none
+func (db *ReplicatedDB) Reader() Querier {
+	if r := db.pickReplica(WithReadOnly(context.Background())); r != nil {
+		return r.pool
+	}
+	return db.Primary
+}
+
+// HealthyReplicas returns number of replicas currently in rotation
+func (db *ReplicatedDB) HealthyReplicas() int {
+	healthy := 0
+	for _, r := range db.replicas {
+		if r.healthy.Load() {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// Close stops health checking and closes all pools
+func (db *ReplicatedDB) Close() {
+	db.stop()
+	db.wg.Wait()
+	for _, r := range db.replicas {
+		r.pool.Close()
+	}
+	db.Primary.Close()
+}
+
+func (db *ReplicatedDB) pickReplica(ctx context.Context) *replica {
+	if !IsReadOnly(ctx) || len(db.replicas) == 0 {
+		return nil
+	}
+
+	start := db.next.Add(1)
+	for i := 0; i < len(db.replicas); i++ {
+		r := db.replicas[(start+uint64(i))%uint64(len(db.replicas))]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+func (db *ReplicatedDB) eject(r *replica, err error) {
+	if r.healthy.Swap(false) {
+		log.Warn().Err(err).Str("host", r.pool.Config().ConnConfig.Host).Msg("postgres replica ejected")
+	}
+}
+
+func (db *ReplicatedDB) healthCheckLoop(ctx context.Context) {
+	defer db.wg.Done()
+	ticker := time.NewTicker(db.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			db.checkReplicas(ctx)
+		}
+	}
+}
+
+func (db *ReplicatedDB) checkReplicas(ctx context.Context) {
+	for _, r := range db.replicas {
+		checkCtx, cancel := context.WithTimeout(ctx, db.cfg.HealthCheckInterval)
+		var lagSeconds float64
+		err := r.pool.QueryRow(checkCtx, db.cfg.ReplicationLagQuery).Scan(&lagSeconds)
+		cancel()
+
+		if err != nil {
+			db.eject(r, err)
+			continue
+		}
+
+		lag := time.Duration(lagSeconds * float64(time.Second))
+		if lag > db.cfg.MaxReplicationLag {
+			db.eject(r, errors.New("replication lag too high: "+lag.String()))
+			continue
+		}
+
+		if !r.healthy.Swap(true) {
+			log.Info().Str("host", r.pool.Config().ConnConfig.Host).Dur("lag", lag).Msg("postgres replica in rotation")
+		}
+	}
+}
+
+// isConnectionError returns true for errors not caused by the query itself (i.e. query can be retried elsewhere)
+func isConnectionError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// class 08 - connection exception, class 57 - operator intervention (e.g. admin shutdown, cannot connect now)
+		return len(pgErr.Code) == 5 && (pgErr.Code[:2] == "08" || pgErr.Code[:2] == "57")
+	}
+	var netErr net.Error
+	return pgconn.SafeToRetry(err) || errors.As(err, &netErr)
+}
@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReadOnlyContext(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, IsReadOnly(ctx))
+	assert.True(t, IsReadOnly(WithReadOnly(ctx)))
+}
+
+func TestPickReplicaRoundRobinSkipsUnhealthy(t *testing.T) {
+	db := &ReplicatedDB{replicas: []*replica{{}, {}, {}}}
+	db.replicas[0].healthy.Store(true)
+	db.replicas[2].healthy.Store(true)
+
+	// write context is never routed to replica
+	assert.Nil(t, db.pickReplica(context.Background()))
+
+	ctx := WithReadOnly(context.Background())
+	picked := map[*replica]int{}
+	for i := 0; i < 10; i++ {
+		picked[db.pickReplica(ctx)]++
+	}
+	assert.Len(t, picked, 2)
+	assert.Equal(t, 0, picked[db.replicas[1]])
+
+	// no healthy replica => fallback to primary
+	db.replicas[0].healthy.Store(false)
+	db.replicas[2].healthy.Store(false)
+	assert.Nil(t, db.pickReplica(ctx))
+}
+
+func TestIsConnectionError(t *testing.T) {
+	assert.True(t, isConnectionError(&pgconn.PgError{Code: "08006"}))
+	assert.True(t, isConnectionError(&pgconn.PgError{Code: "57P01"}))
+	assert.False(t, isConnectionError(&pgconn.PgError{Code: "42P01"}))
+	assert.False(t, isConnectionError(errors.New("cannot encode argument")))
+}
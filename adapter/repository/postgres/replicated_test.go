@@ -0,0 +1,64 @@
+package postgres_test
+
+import (
+	"context"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TstReplicationLagQuery(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pg := test.SetupPostgresDB(ctx, "user", "test", "testdb")
+	defer pg.TeardownPostgresDB()
+
+	db, err := postgres.NewPostgresDBFromUri(ctx, pg.URI)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	lag := func(query string) float64 {
+		var seconds float64
+		assert.Nil(t, db.QueryRow(ctx, query).Scan(&seconds))
+		return seconds
+	}
+	// replica functions return NULL on primary
+	assert.Equal(t, float64(0), lag(postgres.DefaultReplicationLagQuery))
+
+	// replica of idle primary replayed all WAL but its last replayed transaction is old
+	idle := strings.NewReplacer(
+		"pg_last_wal_receive_lsn()", "'0/3000060'::pg_lsn",
+		"pg_last_wal_replay_lsn()", "'0/3000060'::pg_lsn",
+		"pg_last_xact_replay_timestamp()", "(now() - interval '1 hour')",
+		"pg_stat_wal_receiver", "(SELECT 'streaming' AS status) AS receiver",
+	)
+	assert.Equal(t, float64(0), lag(idle.Replace(postgres.DefaultReplicationLagQuery)))
+
+	// replica which stopped receiving WAL replayed all it received, yet it is not caught up
+	disconnected := strings.NewReplacer(
+		"pg_last_wal_receive_lsn()", "'0/3000060'::pg_lsn",
+		"pg_last_wal_replay_lsn()", "'0/3000060'::pg_lsn",
+		"pg_last_xact_replay_timestamp()", "(now() - interval '1 hour')",
+		"pg_stat_wal_receiver", "(SELECT 'waiting' AS status) AS receiver",
+	)
+	assert.Equal(t, float64(3600), lag(disconnected.Replace(postgres.DefaultReplicationLagQuery)))
+	// no WAL receiver is running (there is none on primary the test runs on)
+	stopped := strings.NewReplacer(
+		"pg_last_wal_receive_lsn()", "'0/3000060'::pg_lsn",
+		"pg_last_wal_replay_lsn()", "'0/3000060'::pg_lsn",
+		"pg_last_xact_replay_timestamp()", "(now() - interval '1 hour')",
+	)
+	assert.Equal(t, float64(3600), lag(stopped.Replace(postgres.DefaultReplicationLagQuery)))
+
+	lagging := strings.NewReplacer(
+		"pg_last_wal_receive_lsn()", "'0/3000060'::pg_lsn",
+		"pg_last_wal_replay_lsn()", "'0/3000000'::pg_lsn",
+		"pg_last_xact_replay_timestamp()", "(now() - interval '1 hour')",
+	)
+	assert.Equal(t, float64(3600), lag(lagging.Replace(postgres.DefaultReplicationLagQuery)))
+}
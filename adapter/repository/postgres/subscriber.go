@@ -0,0 +1,238 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMinReconnectDelay = 500 * time.Millisecond
+	DefaultMaxReconnectDelay = 30 * time.Second
+)
+
+// Notification is postgres notification sent by NOTIFY channel, 'payload' or pg_notify('channel', 'payload')
+type Notification = pgconn.Notification
+
+// NotificationHandler handles single notification, returned error is only logged
+type NotificationHandler func(ctx context.Context, n *Notification) error
+
+// GapHandler is called after subscriber reconnected, notifications sent on given channels while
+// connection was down are lost so consumers should resync (e.g. drop whole cache)
+type GapHandler func(ctx context.Context, channels []string)
+
+// JSONHandler creates notification handler decoding JSON payload into T
+func JSONHandler[T any](fn func(ctx context.Context, channel string, payload T) error) NotificationHandler {
+	return func(ctx context.Context, n *Notification) error {
+		var payload T
+		if err := json.Unmarshal([]byte(n.Payload), &payload); err != nil {
+			return fmt.Errorf("cannot decode notification payload on channel '%s': %w", n.Channel, err)
+		}
+		return fn(ctx, n.Channel, payload)
+	}
+}
+
+// SubscriberConfig configures subscriber, zero values are replaced with defaults
+type SubscriberConfig struct {
+	// MinReconnectDelay and MaxReconnectDelay bound exponential backoff between reconnect attempts
+	MinReconnectDelay time.Duration
+	MaxReconnectDelay time.Duration
+	// OnGap is called after every reconnect
+	OnGap GapHandler
+}
+
+// Subscriber holds dedicated connection (taken out of the pool) listening on subscribed channels
+// and dispatches received notifications to handlers. Handlers are invoked sequentially in order of arrival.
+// Lost connection is re-established automatically, all channels are LISTENed again and OnGap is called.
+type Subscriber struct {
+	db       *DB
+	cfg      SubscriberConfig
+	mu       sync.Mutex
+	handlers map[string][]NotificationHandler
+	wake     chan struct{}
+}
+
+// NewSubscriber creates new subscriber, register handlers with Subscribe and start it with Run
+func (db *DB) NewSubscriber(cfg SubscriberConfig) *Subscriber {
+	if cfg.MinReconnectDelay <= 0 {
+		cfg.MinReconnectDelay = DefaultMinReconnectDelay
+	}
+	if cfg.MaxReconnectDelay <= 0 {
+		cfg.MaxReconnectDelay = DefaultMaxReconnectDelay
+	}
+
+	return &Subscriber{
+		db:       db,
+		cfg:      cfg,
+		handlers: make(map[string][]NotificationHandler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Subscribe registers handler for given channel, can be called before or while subscriber is running
+func (s *Subscriber) Subscribe(channel string, handler NotificationHandler) {
+	s.mu.Lock()
+	s.handlers[channel] = append(s.handlers[channel], handler)
+	s.mu.Unlock()
+	s.notifyChange()
+}
+
+// Unsubscribe removes all handlers of given channel and stops listening on it
+func (s *Subscriber) Unsubscribe(channel string) {
+	s.mu.Lock()
+	delete(s.handlers, channel)
+	s.mu.Unlock()
+	s.notifyChange()
+}
+
+// Channels returns subscribed channels
+func (s *Subscriber) Channels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	channels := make([]string, 0, len(s.handlers))
+	for channel := range s.handlers {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+func (s *Subscriber) notifyChange() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run listens for notifications until ctx is cancelled, ctx.Err() is returned then
+func (s *Subscriber) Run(ctx context.Context) error {
+	connectedBefore := false
+	attempt := 0
+
+	for {
+		conn, err := s.connect(ctx)
+		if err == nil {
+			if connectedBefore && s.cfg.OnGap != nil {
+				s.cfg.OnGap(ctx, s.Channels())
+			}
+			connectedBefore = true
+			attempt = 0
+
+			err = s.listen(ctx, conn)
+			_ = conn.Close(context.Background())
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		attempt++
+		delay := reconnectDelay(attempt, s.cfg.MinReconnectDelay, s.cfg.MaxReconnectDelay)
+		log.Warn().Err(err).Int("attempt", attempt).Dur("delay", delay).Msg("postgres subscriber: connection lost, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// connect takes connection out of the pool (so that pool hooks like BeforeConnect still apply)
+func (s *Subscriber) connect(ctx context.Context) (*pgx.Conn, error) {
+	pooled, err := s.db.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pooled.Hijack(), nil
+}
+
+func (s *Subscriber) listen(ctx context.Context, conn *pgx.Conn) error {
+	listening := make(map[string]bool)
+
+	for {
+		if err := s.syncChannels(ctx, conn, listening); err != nil {
+			return err
+		}
+
+		// waiting is interrupted (without closing connection) whenever subscriptions change
+		waitCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-s.wake:
+				cancel()
+			case <-waitCtx.Done():
+			}
+		}()
+
+		n, err := conn.WaitForNotification(waitCtx)
+		woken := waitCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+
+		if err != nil {
+			if woken {
+				continue
+			}
+			return err
+		}
+
+		s.dispatch(ctx, n)
+	}
+}
+
+// syncChannels issues LISTEN/UNLISTEN so that connection listens exactly on subscribed channels
+func (s *Subscriber) syncChannels(ctx context.Context, conn *pgx.Conn, listening map[string]bool) error {
+	channels := s.Channels()
+
+	wanted := make(map[string]bool, len(channels))
+	for _, channel := range channels {
+		wanted[channel] = true
+		if !listening[channel] {
+			if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+				return err
+			}
+			listening[channel] = true
+		}
+	}
+
+	for channel := range listening {
+		if !wanted[channel] {
+			if _, err := conn.Exec(ctx, "UNLISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+				return err
+			}
+			delete(listening, channel)
+		}
+	}
+
+	return nil
+}
+
+func (s *Subscriber) dispatch(ctx context.Context, n *Notification) {
+	s.mu.Lock()
+	handlers := append([]NotificationHandler(nil), s.handlers[n.Channel]...)
+	s.mu.Unlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, n); err != nil {
+			log.Error().Err(err).Str("channel", n.Channel).Msg("postgres subscriber: notification handler failed")
+		}
+	}
+}
+
+func reconnectDelay(attempt int, minDelay time.Duration, maxDelay time.Duration) time.Duration {
+	delay := minDelay
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
@@ -0,0 +1,66 @@
+package postgres_test
+
+import (
+	"context"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type cacheInvalidation struct {
+	Key string `json:"key"`
+}
+
+func TestJSONHandler(t *testing.T) {
+	var received cacheInvalidation
+	handler := postgres.JSONHandler(func(ctx context.Context, channel string, payload cacheInvalidation) error {
+		received = payload
+		return nil
+	})
+
+	err := handler(context.Background(), &postgres.Notification{Channel: "cache", Payload: `{"key":"player:1"}`})
+	assert.Nil(t, err)
+	assert.Equal(t, "player:1", received.Key)
+
+	err = handler(context.Background(), &postgres.Notification{Channel: "cache", Payload: `not json`})
+	assert.NotNil(t, err)
+}
+
+func TstSubscriberReceivesNotifications(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pg := test.SetupPostgresDB(ctx, "user", "test", "testdb")
+	defer pg.TeardownPostgresDB()
+
+	db, err := postgres.NewPostgresDBFromUri(ctx, pg.URI)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	received := make(chan cacheInvalidation, 1)
+	subscriber := db.NewSubscriber(postgres.SubscriberConfig{})
+	subscriber.Subscribe("cache", postgres.JSONHandler(func(ctx context.Context, channel string, payload cacheInvalidation) error {
+		received <- payload
+		return nil
+	}))
+
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go func() {
+		_ = subscriber.Run(runCtx)
+	}()
+	time.Sleep(time.Second) // let subscriber LISTEN
+
+	_, err = db.Exec(ctx, `SELECT pg_notify('cache', '{"key":"player:1"}')`)
+	assert.Nil(t, err)
+
+	select {
+	case payload := <-received:
+		assert.Equal(t, "player:1", payload.Key)
+	case <-time.After(10 * time.Second):
+		t.Error("notification not received")
+	}
+}
@@ -0,0 +1,83 @@
+package aws
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	sts_types "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"sort"
+	"time"
+)
+
+// CredentialsExpiryWindow is how long before expiration assumed role credentials are refreshed
+const CredentialsExpiryWindow = 5 * time.Minute
+
+// AssumeRole describes role assumed by Factory, see WithRole and Factory.Assume
+type AssumeRole struct {
+	RoleARN string
+	// ExternalID is required by roles of third party accounts which trust the account only with external ID
+	ExternalID string
+	// SessionName identifies session in CloudTrail, SDK generates one when empty
+	SessionName string
+	// Duration of credentials, default is 1h (also max duration of chained roles)
+	Duration time.Duration
+	// Tags are session tags, TransitiveTagKeys are keys of tags passed to roles assumed further in chain
+	Tags              map[string]string
+	TransitiveTagKeys []string
+}
+
+// WithRole makes clients use credentials of given role, repeated option chains roles: each role is assumed
+// with credentials of the previous one (first one with the loaded credentials)
+func WithRole(role AssumeRole) FactoryOption {
+	return func(o *factoryOptions) { o.roles = append(o.roles, role) }
+}
+
+// Assume returns factory whose clients use credentials of given role assumed with credentials of f, e.g. to access
+// queues or tables of another account. Returned factory shares config of f (region, endpoints, retries, HTTP client),
+// factories are cached by role so their clients and credentials are reused.
+func (f *Factory) Assume(role AssumeRole) *Factory {
+	key := fmt.Sprintf("%+v", role)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if assumed, ok := f.assumed[key]; ok {
+		return assumed
+	}
+
+	awsConfig := f.config.Copy()
+	awsConfig.Credentials = f.assumeRoleCredentials(f.config, role)
+	assumed := &Factory{config: awsConfig, serviceEndpoints: f.serviceEndpoints, s3PathStyle: f.s3PathStyle}
+	if f.assumed == nil {
+		f.assumed = make(map[string]*Factory)
+	}
+	f.assumed[key] = assumed
+	return assumed
+}
+
+// assumeRoleCredentials returns cached credentials of role assumed with credentials of given config,
+// credentials are refreshed CredentialsExpiryWindow before they expire
+func (f *Factory) assumeRoleCredentials(awsConfig aws.Config, role AssumeRole) aws.CredentialsProvider {
+	client := sts.NewFromConfig(awsConfig, func(o *sts.Options) {
+		o.BaseEndpoint = f.baseEndpoint(sts.ServiceID, o.BaseEndpoint)
+	})
+	provider := stscreds.NewAssumeRoleProvider(client, role.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		if role.ExternalID != "" {
+			o.ExternalID = aws.String(role.ExternalID)
+		}
+		if role.SessionName != "" {
+			o.RoleSessionName = role.SessionName
+		}
+		if role.Duration > 0 {
+			o.Duration = role.Duration
+		}
+		for key, value := range role.Tags {
+			o.Tags = append(o.Tags, sts_types.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+		sort.Slice(o.Tags, func(i, j int) bool { return *o.Tags[i].Key < *o.Tags[j].Key })
+		o.TransitiveTagKeys = role.TransitiveTagKeys
+	})
+	return aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = CredentialsExpiryWindow
+	})
+}
@@ -0,0 +1,94 @@
+package aws_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSts issues credentials with access key derived from role name and records AssumeRole requests
+type fakeSts struct {
+	mu       sync.Mutex
+	requests []url.Values
+	signedBy []string
+}
+
+func (s *fakeSts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = r.ParseForm()
+	s.requests = append(s.requests, r.PostForm)
+	// Authorization: AWS4-HMAC-SHA256 Credential=<access key>/<date>/...
+	credential := strings.SplitN(r.Header.Get("Authorization"), "Credential=", 2)[1]
+	s.signedBy = append(s.signedBy, strings.SplitN(credential, "/", 2)[0])
+
+	role := r.PostForm.Get("RoleArn")
+	accessKey := "ASIA" + strings.ToUpper(role[strings.LastIndex(role, "/")+1:])
+	fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>%s</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+    <AssumedRoleUser><Arn>%s</Arn><AssumedRoleId>id</AssumedRoleId></AssumedRoleUser>
+  </AssumeRoleResult>
+  <ResponseMetadata><RequestId>r</RequestId></ResponseMetadata>
+</AssumeRoleResponse>`, accessKey, time.Now().Add(time.Hour).UTC().Format(time.RFC3339), role)
+}
+
+func TestFactoryAssumesRoles(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "BASE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	fake := &fakeSts{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx := context.Background()
+	factory, err := aws.NewFactory(ctx,
+		aws.WithRegion(constants.AwsDefaultRegion),
+		aws.WithServiceEndpoint(sts.ServiceID, server.URL),
+		aws.WithRole(aws.AssumeRole{
+			RoleARN:     "arn:aws:iam::111111111111:role/deployer",
+			SessionName: "matches-service",
+			Tags:        map[string]string{"team": "matches", "env": "prod"},
+		}),
+		aws.WithAssumeRole("arn:aws:iam::111111111111:role/reader"),
+	)
+	assert.Nil(t, err)
+
+	credentials, err := factory.Config().Credentials.Retrieve(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "ASIAREADER", credentials.AccessKeyID)
+	// credentials are cached
+	_, err = factory.Config().Credentials.Retrieve(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, fake.requests, 2)
+	// roles are chained
+	assert.Equal(t, []string{"BASE", "ASIADEPLOYER"}, fake.signedBy)
+	assert.Equal(t, "matches-service", fake.requests[0].Get("RoleSessionName"))
+	assert.Equal(t, "env", fake.requests[0].Get("Tags.member.1.Key"))
+	assert.Equal(t, "matches", fake.requests[0].Get("Tags.member.2.Value"))
+
+	partner := aws.AssumeRole{RoleARN: "arn:aws:iam::222222222222:role/partner", ExternalID: "hrnogomet"}
+	assumed := factory.Assume(partner)
+	assert.Same(t, assumed, factory.Assume(partner))
+	assert.NotSame(t, factory.SQS(), assumed.SQS())
+
+	credentials, err = assumed.Config().Credentials.Retrieve(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "ASIAPARTNER", credentials.AccessKeyID)
+	assert.Equal(t, "ASIAREADER", fake.signedBy[2])
+	assert.Equal(t, "hrnogomet", fake.requests[2].Get("ExternalId"))
+}
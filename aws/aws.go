@@ -3,47 +3,21 @@ package aws
 import (
 	"context"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
 )
 
-// CustomEndpointResolver does custom endpoint resolution
-// used to run aws calls against localstack
-// see https://aws.github.io/aws-sdk-go-v2/docs/configuring-sdk/endpoints/
-// https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/aws/endpoints
-type CustomEndpointResolver struct {
-	CustomEndpoint string
-}
-
-func (r *CustomEndpointResolver) ResolveEndpoint(serviceID, regionID string, options ...interface{}) (aws.Endpoint, error) {
-	// You can implement custom logic here to return the endpoint based on the serviceID and regionID.
-	return aws.Endpoint{
-		URL:           r.CustomEndpoint,
-		SigningRegion: regionID,
-	}, nil
-}
-
-func newAwsConfig(ctx context.Context, awsRegion string, customEndpoint string) (*aws.Config, error) {
-	var awsConfig aws.Config
-	var err error
-
-	if customEndpoint != "" {
-		resolver := &CustomEndpointResolver{
-			CustomEndpoint: customEndpoint,
-		}
-		awsConfig, err = config.LoadDefaultConfig(ctx, config.WithRegion(awsRegion), config.WithEndpointResolverWithOptions(resolver))
-	} else {
-		awsConfig, err = config.LoadDefaultConfig(ctx, config.WithRegion(awsRegion))
-	}
-
-	if err != nil {
-		return nil, err
-	} else {
-		return &awsConfig, nil
-	}
+// newFactory creates factory for given region honouring custom endpoint set in context (see SetCustomAwsEndpoint),
+// Create* functions load config on every call so prefer Factory when creating several clients
+func newFactory(ctx context.Context, awsRegion string) (*Factory, error) {
+	return NewFactory(ctx, WithRegion(awsRegion), WithEndpoint(getCustomAwsEndpoint(ctx)))
 }
 
 // getCustomAwsEndpoint returns custom context key with custom aws endpoint if set
@@ -55,34 +29,91 @@ func getCustomAwsEndpoint(ctx context.Context) string {
 	return ""
 }
 
-// SetCustomAwsEndpoint sets custom context attribute for aws custom endpoint
+// SetCustomAwsEndpoint sets custom context attribute for aws custom endpoint used by Create* functions for all services,
+// AWS_ENDPOINT_URL_<SERVICE> environment variables take precedence over it (see WithEndpoint)
 func SetCustomAwsEndpoint(ctx context.Context, customEndpoint string) context.Context {
 	return context.WithValue(ctx, constants.ContextKeyCustomAwsEndpoint{}, customEndpoint)
 }
 
+// LoadAwsConfig loads default aws config for given region honouring custom endpoint set in context (see SetCustomAwsEndpoint)
+// use it when config is needed directly, e.g. for credentials used to sign RDS IAM auth tokens
+func LoadAwsConfig(ctx context.Context, awsRegion string) (*aws.Config, error) {
+	if factory, err := newFactory(ctx, awsRegion); err != nil {
+		return nil, err
+	} else {
+		awsConfig := factory.Config()
+		return &awsConfig, nil
+	}
+}
+
 // CreateDynamodbClient creates new dynamodb client
 func CreateDynamodbClient(ctx context.Context, awsRegion string) (*dynamodb.Client, error) {
-	if awsConfig, err := newAwsConfig(ctx, awsRegion, getCustomAwsEndpoint(ctx)); err != nil {
+	if factory, err := newFactory(ctx, awsRegion); err != nil {
 		return nil, err
 	} else {
-		return dynamodb.NewFromConfig(*awsConfig), nil
+		return factory.DynamoDB(), nil
 	}
 }
 
 // CreateSqsClient creates new AWS SQS client
 func CreateSqsClient(ctx context.Context, awsRegion string) (*sqs.Client, error) {
-	if awsConfig, err := newAwsConfig(ctx, awsRegion, getCustomAwsEndpoint(ctx)); err != nil {
+	if factory, err := newFactory(ctx, awsRegion); err != nil {
 		return nil, err
 	} else {
-		return sqs.NewFromConfig(*awsConfig), nil
+		return factory.SQS(), nil
+	}
+}
+
+// CreateSnsClient creates new AWS SNS client
+func CreateSnsClient(ctx context.Context, awsRegion string) (*sns.Client, error) {
+	if factory, err := newFactory(ctx, awsRegion); err != nil {
+		return nil, err
+	} else {
+		return factory.SNS(), nil
+	}
+}
+
+// CreateEventBridgeClient creates new AWS EventBridge client
+func CreateEventBridgeClient(ctx context.Context, awsRegion string) (*eventbridge.Client, error) {
+	if factory, err := newFactory(ctx, awsRegion); err != nil {
+		return nil, err
+	} else {
+		return factory.EventBridge(), nil
+	}
+}
+
+// CreateSchedulerClient creates new AWS EventBridge Scheduler client
+func CreateSchedulerClient(ctx context.Context, awsRegion string) (*scheduler.Client, error) {
+	if factory, err := newFactory(ctx, awsRegion); err != nil {
+		return nil, err
+	} else {
+		return factory.Scheduler(), nil
+	}
+}
+
+// CreateS3Client creates new AWS S3 client, path-style addressing is used with custom endpoint (localstack)
+func CreateS3Client(ctx context.Context, awsRegion string) (*s3.Client, error) {
+	if factory, err := newFactory(ctx, awsRegion); err != nil {
+		return nil, err
+	} else {
+		return factory.S3(), nil
 	}
 }
 
 // CreateCloudWatchClient creates new AWS CW client
 func CreateCloudWatchClient(ctx context.Context, awsRegion string) (*cloudwatch.Client, error) {
-	if awsConfig, err := newAwsConfig(ctx, awsRegion, getCustomAwsEndpoint(ctx)); err != nil {
+	if factory, err := newFactory(ctx, awsRegion); err != nil {
+		return nil, err
+	} else {
+		return factory.CloudWatch(), nil
+	}
+}
+
+// CreateSecretsManagerClient creates new AWS Secrets Manager client
+func CreateSecretsManagerClient(ctx context.Context, awsRegion string) (*secretsmanager.Client, error) {
+	if factory, err := newFactory(ctx, awsRegion); err != nil {
 		return nil, err
 	} else {
-		return cloudwatch.NewFromConfig(*awsConfig), nil
+		return factory.SecretsManager(), nil
 	}
 }
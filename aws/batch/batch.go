@@ -0,0 +1,152 @@
+package batch
+
+/*
+Retries of partially failed batch calls shared by publishers (SQS SendMessageBatch, SNS PublishBatch,
+EventBridge PutEvents). Entries are referenced by their indexes in caller's slice, entries failed with retryable
+errors (or missing in the response) are resent with exponential backoff and every entry gets exactly one result.
+Calls are limited by number and total size of entries (see Policy.MaxEntries and Policy.MaxBytes).
+Entries of FIFO queues and topics (see Policy.Group) are sent at most one per message group in every call:
+entry sent in the same call as preceding entry of its group would get ahead of it if the preceding one is retried.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Result is outcome of single batch entry
+type Result struct {
+	// ID is ID assigned to entry by the service, e.g. message ID
+	ID  string
+	Err error
+	// Retry marks failures worth retrying, e.g. throttling or internal service errors
+	Retry bool
+}
+
+// Sender makes single batch call with entries of given indexes and returns results by entry index.
+// Entries without result are retried, returned error fails (and retries) all of them.
+type Sender func(ctx context.Context, indexes []int) (map[int]Result, error)
+
+// Policy configures retries of failed entries
+type Policy struct {
+	// MaxRetries is max number of retries of failed entries
+	MaxRetries int
+	// Backoff is delay before first retry, it doubles with every further retry
+	Backoff time.Duration
+	// Operation describes call in errors of entries which were not sent, e.g. "send message"
+	Operation string
+	// MaxEntries is max number of entries sent in single call, unlimited when zero
+	MaxEntries int
+	// MaxBytes is max total size of entries sent in single call (see Size), unlimited when zero.
+	// Entry exceeding it on its own is sent alone.
+	MaxBytes int
+	// Size returns size of entry as counted by the service, required when MaxBytes is set
+	Size func(index int) int
+	// Group returns message group of entry (FIFO queues and topics), optional. Entries of the same group are sent
+	// one after another in order of indexes, entries following failed entry of their group are failed too.
+	Group func(index int) string
+}
+
+// Send sends entries with given indexes retrying failed ones until they succeed, fail permanently or retries
+// are exhausted (or ctx is done). Results are stored into ids and errs at entry indexes.
+func Send(ctx context.Context, policy Policy, indexes []int, send Sender, ids []string, errs []error) {
+	retries := make(map[int]int)
+	for len(indexes) > 0 {
+		call := policy.call(indexes)
+		results, err := send(ctx, call)
+
+		// done marks entries with final result, failed ones are marked also in failed
+		done := make(map[int]bool, len(call))
+		failed := make(map[int]bool)
+		retrying := false
+		var backoff time.Duration
+		for _, index := range call {
+			result, ok := results[index]
+			switch {
+			case err != nil:
+				errs[index] = err
+			case !ok:
+				errs[index] = errors.New("missing batch result entry")
+			case result.Err == nil:
+				ids[index], errs[index], done[index] = result.ID, nil, true
+				continue
+			default:
+				errs[index] = result.Err
+				if !result.Retry {
+					done[index], failed[index] = true, true
+					continue
+				}
+			}
+			if retries[index] == policy.MaxRetries {
+				errs[index] = fmt.Errorf("cannot %s: %w", policy.Operation, errs[index])
+				done[index], failed[index] = true, true
+				continue
+			}
+			retrying, backoff = true, max(backoff, policy.Backoff<<retries[index])
+			retries[index]++
+		}
+
+		indexes = policy.pending(indexes, done, failed, errs)
+		if !retrying || len(indexes) == 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			for _, index := range indexes {
+				errs[index] = fmt.Errorf("cannot %s: %w", policy.Operation, errors.Join(errs[index], ctx.Err()))
+			}
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// call returns entries sent in next call, i.e. first pending entries fitting into MaxEntries and MaxBytes
+// taking only first entry of every group
+func (p Policy) call(indexes []int) []int {
+	var call []int
+	size := 0
+	groups := make(map[string]bool)
+	for _, index := range indexes {
+		if p.MaxEntries > 0 && len(call) == p.MaxEntries {
+			break
+		}
+		if p.Group != nil && groups[p.Group(index)] {
+			continue
+		}
+		if p.MaxBytes > 0 {
+			if len(call) > 0 && size+p.Size(index) > p.MaxBytes {
+				break
+			}
+			size += p.Size(index)
+		}
+		if p.Group != nil {
+			groups[p.Group(index)] = true
+		}
+		call = append(call, index)
+	}
+	return call
+}
+
+// pending returns entries without final result, entries following failed entry of their group are failed
+// instead so that they are not delivered out of order
+func (p Policy) pending(indexes []int, done map[int]bool, failed map[int]bool, errs []error) []int {
+	var pending []int
+	failedGroups := make(map[string]bool)
+	for _, index := range indexes {
+		switch {
+		case failed[index]:
+			if p.Group != nil {
+				failedGroups[p.Group(index)] = true
+			}
+		case done[index]:
+		case p.Group != nil && failedGroups[p.Group(index)]:
+			errs[index] = fmt.Errorf("cannot %s: preceding entry of message group %s failed", p.Operation, p.Group(index))
+		default:
+			pending = append(pending, index)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,126 @@
+package batch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/batch"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSendRetriesFailedEntries(t *testing.T) {
+	var calls [][]int
+	failures := map[int]int{1: 1, 2: 10}
+	send := func(ctx context.Context, indexes []int) (map[int]batch.Result, error) {
+		calls = append(calls, indexes)
+		if len(calls) == 1 {
+			return nil, errors.New("connection reset")
+		}
+		results := make(map[int]batch.Result)
+		for _, index := range indexes {
+			switch {
+			case index == 3:
+				results[index] = batch.Result{Err: errors.New("rejected")}
+			case index == 4 && len(calls) == 2:
+				// missing in response
+			case failures[index] > 0:
+				failures[index]--
+				results[index] = batch.Result{Err: errors.New("throttled"), Retry: true}
+			default:
+				results[index] = batch.Result{ID: fmt.Sprint("id-", index)}
+			}
+		}
+		return results, nil
+	}
+
+	ids := make([]string, 5)
+	errs := make([]error, 5)
+	batch.Send(context.Background(), batch.Policy{MaxRetries: 3, Backoff: time.Millisecond, Operation: "send message"}, []int{0, 1, 2, 3, 4}, send, ids, errs)
+
+	assert.Equal(t, []string{"id-0", "id-1", "", "", "id-4"}, ids)
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.EqualError(t, errs[2], "cannot send message: throttled")
+	assert.EqualError(t, errs[3], "rejected")
+	assert.Nil(t, errs[4])
+	assert.Equal(t, [][]int{{0, 1, 2, 3, 4}, {0, 1, 2, 3, 4}, {1, 2, 4}, {2}}, calls)
+}
+
+func TestSendKeepsOrderWithinGroups(t *testing.T) {
+	groups := []string{"a", "a", "b", "a", "b", "c"}
+	var calls [][]int
+	send := func(ctx context.Context, indexes []int) (map[int]batch.Result, error) {
+		calls = append(calls, indexes)
+		results := make(map[int]batch.Result)
+		for _, index := range indexes {
+			switch {
+			case index == 1 && len(calls) == 2:
+				results[index] = batch.Result{Err: errors.New("throttled"), Retry: true}
+			case index == 2:
+				results[index] = batch.Result{Err: errors.New("rejected")}
+			default:
+				results[index] = batch.Result{ID: fmt.Sprint("id-", index)}
+			}
+		}
+		return results, nil
+	}
+
+	ids := make([]string, len(groups))
+	errs := make([]error, len(groups))
+	policy := batch.Policy{
+		MaxRetries: 3,
+		Backoff:    time.Millisecond,
+		Operation:  "send message",
+		MaxEntries: 2,
+		Group:      func(index int) string { return groups[index] },
+	}
+	batch.Send(context.Background(), policy, []int{0, 1, 2, 3, 4, 5}, send, ids, errs)
+
+	assert.Equal(t, []string{"id-0", "id-1", "", "id-3", "", "id-5"}, ids)
+	assert.NotNil(t, errs[2])
+	assert.NotNil(t, errs[4])
+	// entry following failed one of group b is not sent, entry 3 waits for retried entry 1 of group a
+	assert.Equal(t, [][]int{{0, 2}, {1, 5}, {1}, {3}}, calls)
+}
+
+func TestSendLimitsSizeOfCalls(t *testing.T) {
+	sizes := []int{40, 30, 50, 120, 10}
+	var calls [][]int
+	send := func(ctx context.Context, indexes []int) (map[int]batch.Result, error) {
+		calls = append(calls, indexes)
+		results := make(map[int]batch.Result)
+		for _, index := range indexes {
+			results[index] = batch.Result{ID: fmt.Sprint("id-", index)}
+		}
+		return results, nil
+	}
+
+	ids := make([]string, len(sizes))
+	errs := make([]error, len(sizes))
+	policy := batch.Policy{
+		MaxRetries: 3,
+		Backoff:    time.Millisecond,
+		Operation:  "send message",
+		MaxBytes:   100,
+		Size:       func(index int) int { return sizes[index] },
+	}
+	batch.Send(context.Background(), policy, []int{0, 1, 2, 3, 4}, send, ids, errs)
+
+	assert.Equal(t, []string{"id-0", "id-1", "id-2", "id-3", "id-4"}, ids)
+	// entry exceeding the limit on its own is sent alone
+	assert.Equal(t, [][]int{{0, 1}, {2}, {3}, {4}}, calls)
+}
+
+func TestSendStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ids := make([]string, 1)
+	errs := make([]error, 1)
+	batch.Send(ctx, batch.Policy{MaxRetries: 3, Backoff: time.Hour, Operation: "publish event"}, []int{0}, func(ctx context.Context, indexes []int) (map[int]batch.Result, error) {
+		return nil, errors.New("throttled")
+	}, ids, errs)
+	assert.True(t, errors.Is(errs[0], context.Canceled))
+}
@@ -9,74 +9,72 @@ import (
 	"cirello.io/dynamolock/v2"
 	"context"
 	"errors"
+	"fmt"
 	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dynamodb_types "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
-	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
 	"time"
 )
 
+// LockTablePartitionKey is name of partition key of lock tables
+const LockTablePartitionKey = "key"
+
+var _ DistributedLock = (*distributedDynamodbLock)(nil)
+
 type distributedDynamodbLock struct {
 	dynamoTableName string
 	client          *dynamolock.Client
 	lock            *dynamolock.Lock
 }
 
-// NewLockClient creates new client for distributed lock operations
-func NewLockClient(ctx context.Context, leaseDuration time.Duration, leaseExtensionHeartbeatInterval time.Duration, dynamoTableName string) (*dynamolock.Client, error) {
-	dynamodbClient, err := aws.CreateDynamodbClient(ctx, constants.AwsDefaultRegion)
+// NewLockClient creates new client for distributed lock operations, honours WithRegion, WithPartitionKeyName
+// and WithOwnerName options
+func NewLockClient(ctx context.Context, leaseDuration time.Duration, leaseExtensionHeartbeatInterval time.Duration, dynamoTableName string, opts ...Option) (*dynamolock.Client, error) {
+	o := newOptions(opts)
+	dynamodbClient, err := aws.CreateDynamodbClient(ctx, o.region)
 	if err != nil {
 		return nil, err
 	}
 
-	return dynamolock.New(dynamodbClient,
-		dynamoTableName,
+	return newLockClient(dynamodbClient, leaseDuration, leaseExtensionHeartbeatInterval, dynamoTableName, o)
+}
+
+func newLockClient(dynamodbClient dynamolock.DynamoDBClient, leaseDuration time.Duration, leaseExtensionHeartbeatInterval time.Duration, dynamoTableName string, o *options) (*dynamolock.Client, error) {
+	clientOpts := append([]dynamolock.ClientOption{
 		dynamolock.WithLeaseDuration(leaseDuration),
 		dynamolock.WithHeartbeatPeriod(leaseExtensionHeartbeatInterval),
-	)
+	}, o.clientOptions()...)
+	return dynamolock.New(dynamodbClient, dynamoTableName, clientOpts...)
 }
 
-// AcquireLock retrieves new lock utilizing provided client
-func AcquireLock(lockKey string, client *dynamolock.Client, lockData []byte, additionalTimeToWaitForLock time.Duration, failIfLocked bool) (*dynamolock.Lock, error) {
-	// https://github.com/cirello-io/dynamolock/issues/199
-	// https://pkg.go.dev/github.com/aws/aws-sdk-go-v2/service/dynamodb#Client.UpdateTimeToLive
-	// TTL can be used automatically expire lock items in database and let dynamodb delete them after some time
-	// we are deleting lock rows  (see below WithDeleteLockOnRelease) but still it is good to have it here
-	//attrs := make(map[string]*dynamodb.AttributeValue, 0)
-	//attrTTL := &dynamodb.AttributeValue{N: aws_sdk.String(fmt.Sprintf("%d", time.Now().Add(24*time.Hour).Unix()))}
-	//attrs["TTL"] = attrTTL
-	// causing false positive during linting (need to wait for fixed version of golangci/golangci-lint-action):
-	// Error: internal/distributed_lock/distributed_lock.go:57:2: G602: Potentially accessing slice out of bounds (gosec)
-	// attrs["TTL"] = attrTTL
-
+// AcquireLock retrieves new lock utilizing provided client, honours WithTTL option
+// (TTL can be used to automatically expire lock items left behind by crashed processes and let dynamodb delete them,
+// see CreateLockTable). Timestamp is not refreshed while lock is held, prefer Manager for long held locks.
+func AcquireLock(lockKey string, client *dynamolock.Client, lockData []byte, additionalTimeToWaitForLock time.Duration, failIfLocked bool, opts ...Option) (*dynamolock.Lock, error) {
+	acquireOpts := append([]dynamolock.AcquireLockOption{
+		dynamolock.WithData(lockData),
+		dynamolock.WithAdditionalTimeToWaitForLock(additionalTimeToWaitForLock),
+		dynamolock.WithDeleteLockOnRelease(), // delete row from dynamodb table once lock is released
+	}, newOptions(opts).acquireOptions(nil)...)
 	if failIfLocked {
-		return client.AcquireLock(lockKey,
-			dynamolock.FailIfLocked(),
-			dynamolock.WithData(lockData),
-			dynamolock.WithAdditionalTimeToWaitForLock(additionalTimeToWaitForLock),
-			///dynamolock.WithAdditionalAttributes(attrs),
-			dynamolock.WithDeleteLockOnRelease(), // delete row from dynamodb table once lock is released
-		)
-	} else {
-		return client.AcquireLock(lockKey,
-			dynamolock.WithData(lockData),
-			dynamolock.WithAdditionalTimeToWaitForLock(additionalTimeToWaitForLock),
-			//dynamolock.WithAdditionalAttributes(attrs),
-			dynamolock.WithDeleteLockOnRelease(), // delete row from dynamodb table once lock is released
-		)
+		acquireOpts = append(acquireOpts, dynamolock.FailIfLocked())
 	}
+
+	return client.AcquireLock(lockKey, acquireOpts...)
 }
 
 // NewDistributedDynamodbLock is convenience function combining creation of locking client and lock into single step.
 // Created lock holds no data because this feature will be mostly not needed.
 // If needed call NewLockClient and AcquireLock explicitly instead.
 // lock created this call will wait at most (2*leaseDuration time  + leaseDuration) to get the lock before timing out
-func NewDistributedDynamodbLock(ctx context.Context, lockKey string, leaseDuration time.Duration, leaseExtensionHeartbeatInterval time.Duration, dynamoTableName string) (*distributedDynamodbLock, error) {
-	if client, errNewClient := NewLockClient(ctx, leaseDuration, leaseExtensionHeartbeatInterval, dynamoTableName); errNewClient != nil {
+func NewDistributedDynamodbLock(ctx context.Context, lockKey string, leaseDuration time.Duration, leaseExtensionHeartbeatInterval time.Duration, dynamoTableName string, opts ...Option) (DistributedLock, error) {
+	if client, errNewClient := NewLockClient(ctx, leaseDuration, leaseExtensionHeartbeatInterval, dynamoTableName, opts...); errNewClient != nil {
 		return nil, errNewClient
 	} else {
-		if lock, errLock := AcquireLock(lockKey, client, nil, leaseDuration*2, false); errLock != nil {
-			return nil, errLock
+		if lock, errLock := AcquireLock(lockKey, client, nil, leaseDuration*2, false, opts...); errLock != nil {
+			_ = client.Close()
+			return nil, wrapLockNotGranted(errLock)
 		} else {
 			return &distributedDynamodbLock{
 				dynamoTableName,
@@ -87,6 +85,15 @@ func NewDistributedDynamodbLock(ctx context.Context, lockKey string, leaseDurati
 	}
 }
 
+// wrapLockNotGranted makes dynamolock.LockNotGrantedError match ErrLockNotGranted while keeping it accessible via errors.As
+func wrapLockNotGranted(err error) error {
+	var lockNotGrantedErr *dynamolock.LockNotGrantedError
+	if errors.As(err, &lockNotGrantedErr) {
+		return fmt.Errorf("%w: %w", ErrLockNotGranted, err)
+	}
+	return err
+}
+
 // ReleaseLock will release distributed lock and also close locking client
 func (l *distributedDynamodbLock) ReleaseLock() error {
 	if l.client != nil && l.lock != nil {
@@ -107,23 +114,48 @@ func (l *distributedDynamodbLock) ReleaseLock() error {
 	return nil
 }
 
-// CreateLockTable should be used only within unit tests testing the lock
-// in real environments locking table is provisioned in advance using terraform scripts
-func CreateLockTable(ctx context.Context, dynamoTableName string) error {
-	if client, errNewClient := NewLockClient(ctx, 3*time.Second, 1*time.Second, dynamoTableName); errNewClient != nil {
+// CreateLockTable creates lock table with provisioned throughput (5 RCU/WCU) or on-demand billing (WithOnDemandBilling)
+// and enables TTL on attribute set by WithTTL. Mostly used within unit tests testing the lock,
+// in real environments locking table is provisioned in advance using terraform scripts.
+func CreateLockTable(ctx context.Context, dynamoTableName string, opts ...Option) error {
+	o := newOptions(opts)
+	dynamodbClient, err := aws.CreateDynamodbClient(ctx, o.region)
+	if err != nil {
+		return err
+	}
+
+	if client, errNewClient := newLockClient(dynamodbClient, 3*time.Second, 1*time.Second, dynamoTableName, o); errNewClient != nil {
 		return errNewClient
 	} else {
 		defer client.Close()
-		_, errCreateTable := client.CreateTable(dynamoTableName,
-			dynamolock.WithProvisionedThroughput(&dynamodb_types.ProvisionedThroughput{
+
+		createOpts := []dynamolock.CreateTableOption{dynamolock.WithCustomPartitionKeyName(o.partitionKeyName)}
+		if !o.onDemandBilling {
+			createOpts = append(createOpts, dynamolock.WithProvisionedThroughput(&dynamodb_types.ProvisionedThroughput{
 				ReadCapacityUnits:  aws_sdk.Int64(5),
 				WriteCapacityUnits: aws_sdk.Int64(5),
-			}),
-			dynamolock.WithCustomPartitionKeyName("key"))
-		if errCreateTable != nil {
+			}))
+		}
+		if _, errCreateTable := client.CreateTableWithContext(ctx, dynamoTableName, createOpts...); errCreateTable != nil {
 			return errCreateTable
 		}
+	}
 
+	if o.ttlAttribute == "" {
 		return nil
 	}
+
+	// TTL can be enabled only once table is active
+	waiter := dynamodb.NewTableExistsWaiter(dynamodbClient)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws_sdk.String(dynamoTableName)}, time.Minute); err != nil {
+		return err
+	}
+	_, err = dynamodbClient.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws_sdk.String(dynamoTableName),
+		TimeToLiveSpecification: &dynamodb_types.TimeToLiveSpecification{
+			AttributeName: aws_sdk.String(o.ttlAttribute),
+			Enabled:       aws_sdk.Bool(true),
+		},
+	})
+	return err
 }
@@ -0,0 +1,244 @@
+package dist_lock
+
+import (
+	"cirello.io/dynamolock/v2"
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodb_types "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+var (
+	_ Locker     = (*DynamodbLocker)(nil)
+	_ FencedLock = (*dynamodbLock)(nil)
+)
+
+// DynamodbLocker acquires locks using shared dynamolock client, client (and its heartbeats) is owned by caller
+type DynamodbLocker struct {
+	client *dynamolock.Client
+	// leaseDuration is lease duration client was created with
+	leaseDuration time.Duration
+	safeTime      time.Duration
+	opts          *options
+	// dynamodbClient accesses lock items in table directly (fencing counters, TTL refresh), nil for plain locker
+	dynamodbClient DynamodbClient
+	table          string
+	// fencing is set when locker issues fencing tokens
+	fencing bool
+}
+
+// NewDynamodbLocker creates locker on top of client created by NewLockClient with given leaseDuration. Lock is
+// considered lost once heartbeats failed for so long that less than safeTime of its lease is left (i.e. before other
+// owner can take it), safeTime must be positive and shorter than leaseDuration. WithTTL option is refused since
+// the locker cannot refresh TTL attribute of held locks, use Manager instead.
+func NewDynamodbLocker(client *dynamolock.Client, leaseDuration time.Duration, safeTime time.Duration, opts ...Option) (*DynamodbLocker, error) {
+	o := newOptions(opts)
+	if o.ttlAttribute != "" {
+		return nil, errors.New("NewDynamodbLocker: WithTTL option is not supported, use Manager or NewFencedDynamodbLocker")
+	}
+	return newDynamodbLocker(client, leaseDuration, safeTime, nil, "", false, o)
+}
+
+// NewFencedDynamodbLocker creates locker issuing fencing token with every acquired lock (see FencedLock),
+// counters are kept in lock table accessed via dynamodbClient. Honours WithTTL and WithPartitionKeyName options.
+func NewFencedDynamodbLocker(client *dynamolock.Client, leaseDuration time.Duration, safeTime time.Duration, dynamodbClient DynamodbClient, table string, opts ...Option) (*DynamodbLocker, error) {
+	return newDynamodbLocker(client, leaseDuration, safeTime, dynamodbClient, table, true, newOptions(opts))
+}
+
+func newDynamodbLocker(client *dynamolock.Client, leaseDuration time.Duration, safeTime time.Duration, dynamodbClient DynamodbClient, table string, fencing bool, o *options) (*DynamodbLocker, error) {
+	if safeTime <= 0 || safeTime >= leaseDuration {
+		return nil, fmt.Errorf("NewDynamodbLocker: safe time %s must be positive and shorter than lease duration %s", safeTime, leaseDuration)
+	}
+	if o.ttlAttribute != "" && o.ttl <= leaseDuration {
+		return nil, fmt.Errorf("NewDynamodbLocker: ttl %s must be longer than lease duration %s", o.ttl, leaseDuration)
+	}
+	return &DynamodbLocker{
+		client:         client,
+		leaseDuration:  leaseDuration,
+		safeTime:       safeTime,
+		opts:           o,
+		dynamodbClient: dynamodbClient,
+		table:          table,
+		fencing:        fencing,
+	}, nil
+}
+
+// Acquire waits until lock is acquired or ctx is done
+func (l *DynamodbLocker) Acquire(ctx context.Context, key string) (Lock, error) {
+	return l.AcquireWithData(ctx, key, nil)
+}
+
+// AcquireWithData is Acquire storing data in lock item, others can read it with Manager.LockData
+func (l *DynamodbLocker) AcquireWithData(ctx context.Context, key string, data []byte) (Lock, error) {
+	for {
+		lock, err := l.acquire(ctx, key, false, data)
+		var lockNotGrantedErr *dynamolock.LockNotGrantedError
+		if err == nil || !errors.As(err, &lockNotGrantedErr) {
+			return lock, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// TryAcquire makes single attempt, error wrapping ErrLockNotGranted is returned if lock is held by someone else
+func (l *DynamodbLocker) TryAcquire(ctx context.Context, key string) (Lock, error) {
+	return l.acquire(ctx, key, true, nil)
+}
+
+// TryAcquireWithData is TryAcquire storing data in lock item, others can read it with Manager.LockData.
+// Note that lock item left behind by crashed holder is never taken over by TryAcquire, only by Acquire.
+func (l *DynamodbLocker) TryAcquireWithData(ctx context.Context, key string, data []byte) (Lock, error) {
+	return l.acquire(ctx, key, true, data)
+}
+
+func (l *DynamodbLocker) acquire(ctx context.Context, key string, failIfLocked bool, data []byte) (Lock, error) {
+	state := NewLockState(ctx)
+	opts := []dynamolock.AcquireLockOption{
+		dynamolock.WithDeleteLockOnRelease(),
+		// session monitor fires once given time passed since last heartbeat, i.e. when only safeTime of lease is left
+		dynamolock.WithSessionMonitor(l.leaseDuration-l.safeTime, func() {
+			log.Warn().Str("key", key).Msg("dynamodb lock: lease is about to expire, lock is lost")
+			state.MarkLost()
+		}),
+	}
+	if failIfLocked {
+		opts = append(opts, dynamolock.FailIfLocked())
+	}
+	if data != nil {
+		opts = append(opts, dynamolock.WithData(data), dynamolock.ReplaceData())
+	}
+	// fenced lock item carries unique acquisition, token is issued only while it is unchanged
+	var acquisition string
+	var attrs map[string]dynamodb_types.AttributeValue
+	if l.fencing {
+		acquisition = uuid.NewString()
+		attrs = map[string]dynamodb_types.AttributeValue{fencingAcquisitionAttribute: &dynamodb_types.AttributeValueMemberS{Value: acquisition}}
+	}
+	opts = append(opts, l.opts.acquireOptions(attrs)...)
+
+	lock, err := l.client.AcquireLockWithContext(ctx, key, opts...)
+	if err != nil {
+		state.MarkReleased()
+		return nil, wrapLockNotGranted(err)
+	}
+
+	held := &dynamodbLock{
+		LockState: state,
+		key:       key,
+		client:    l.client,
+		lock:      lock,
+	}
+
+	// token is issued only after the lock is acquired so that it is greater than tokens of all previous holders
+	if l.fencing {
+		if held.fencingToken, err = nextFencingToken(ctx, l.dynamodbClient, l.table, l.opts.partitionKeyName, key, lock, acquisition); err != nil {
+			_ = held.Release(context.WithoutCancel(ctx))
+			return nil, err
+		}
+	}
+
+	go held.watchExpiry(l.safeTime)
+	if l.opts.ttlAttribute != "" {
+		go l.refreshTTL(held)
+	}
+	return held, nil
+}
+
+// refreshTTL extends expiry timestamp of held lock (see WithTTL) every quarter of ttl until lock is released or lost,
+// so that dynamodb never deletes item of held lock. Heartbeats of dynamolock do not touch additional attributes.
+func (l *DynamodbLocker) refreshTTL(held *dynamodbLock) {
+	ticker := time.NewTicker(l.opts.ttl / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-held.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(held.Context(), l.leaseDuration)
+		_, err := l.dynamodbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                aws_sdk.String(l.table),
+			Key:                      map[string]dynamodb_types.AttributeValue{l.opts.partitionKeyName: &dynamodb_types.AttributeValueMemberS{Value: held.key}},
+			UpdateExpression:         aws_sdk.String("SET #ttl = :ttl"),
+			ConditionExpression:      aws_sdk.String("#owner = :owner"),
+			ExpressionAttributeNames: map[string]string{"#ttl": l.opts.ttlAttribute, "#owner": lockItemAttrOwnerName},
+			ExpressionAttributeValues: map[string]dynamodb_types.AttributeValue{
+				":ttl":   l.opts.ttlValue(),
+				":owner": &dynamodb_types.AttributeValueMemberS{Value: held.lock.OwnerName()},
+			},
+		})
+		cancel()
+
+		var conditionFailedErr *dynamodb_types.ConditionalCheckFailedException
+		switch {
+		case err == nil, held.Context().Err() != nil:
+		case errors.As(err, &conditionFailedErr):
+			// lock item was released or taken over, loss is reported by session monitor or watchExpiry
+			return
+		default:
+			log.Warn().Err(err).Str("key", held.key).Msg("dynamodb lock: cannot refresh ttl of lock item")
+		}
+	}
+}
+
+type dynamodbLock struct {
+	*LockState
+	key          string
+	client       *dynamolock.Client
+	lock         *dynamolock.Lock
+	fencingToken int64
+}
+
+func (l *dynamodbLock) Key() string {
+	return l.key
+}
+
+func (l *dynamodbLock) FencingToken() int64 {
+	return l.fencingToken
+}
+
+// Release releases the lock, error is returned if lock was already lost
+func (l *dynamodbLock) Release(ctx context.Context) error {
+	l.MarkReleased()
+
+	released, err := l.client.ReleaseLockWithContext(ctx, l.lock)
+	if err != nil {
+		return err
+	}
+	if !released {
+		return fmt.Errorf("Release: lock '%s' was not held", l.key)
+	}
+	return nil
+}
+
+// ReleaseLock releases the lock, unlike distributedDynamodbLock shared client is not closed
+func (l *dynamodbLock) ReleaseLock() error {
+	return l.Release(context.Background())
+}
+
+// watchExpiry catches expiry not reported by session monitor, e.g. when lock is released by client.Close
+func (l *dynamodbLock) watchExpiry(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.Context().Done():
+			return
+		case <-ticker.C:
+			if l.lock.IsExpired() {
+				l.MarkLost()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package dist_lock
+
+import (
+	"cirello.io/dynamolock/v2"
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodb_types "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ttlRefreshes records TTL refreshes of lock items, refreshes fail once item is taken over
+type ttlRefreshes struct {
+	DynamodbClient
+	mu        sync.Mutex
+	updates   []*dynamodb.UpdateItemInput
+	takenOver bool
+}
+
+func (f *ttlRefreshes) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates = append(f.updates, params)
+	if f.takenOver {
+		return nil, &dynamodb_types.ConditionalCheckFailedException{}
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (f *ttlRefreshes) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.updates)
+}
+
+func TestNewDynamodbLockerValidatesSafeTime(t *testing.T) {
+	for _, safeTime := range []time.Duration{0, -time.Second, 10 * time.Second, 11 * time.Second} {
+		_, err := NewDynamodbLocker(nil, 10*time.Second, safeTime)
+		assert.NotNil(t, err, safeTime)
+	}
+
+	locker, err := NewDynamodbLocker(nil, 10*time.Second, 3*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Second, locker.leaseDuration)
+}
+
+func TestNewDynamodbLockerRefusesTTL(t *testing.T) {
+	_, err := NewDynamodbLocker(nil, 10*time.Second, 3*time.Second, WithTTL("", 0))
+	assert.NotNil(t, err)
+
+	_, err = NewFencedDynamodbLocker(nil, 10*time.Second, 3*time.Second, nil, "locks", WithTTL("", 5*time.Second))
+	assert.NotNil(t, err)
+	_, err = NewFencedDynamodbLocker(nil, 10*time.Second, 3*time.Second, nil, "locks", WithTTL("", time.Hour))
+	assert.Nil(t, err)
+}
+
+func TestDynamodbLockerRefreshesTTLWhileLockIsHeld(t *testing.T) {
+	client := &ttlRefreshes{}
+	locker, err := newDynamodbLocker(nil, 10*time.Millisecond, 3*time.Millisecond, client, "locks", false, newOptions([]Option{WithTTL("expiresAt", 40*time.Millisecond)}))
+	assert.Nil(t, err)
+
+	held := &dynamodbLock{LockState: NewLockState(context.Background()), key: "feeds", lock: &dynamolock.Lock{}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		locker.refreshTTL(held)
+	}()
+
+	assert.Eventually(t, func() bool { return client.count() >= 2 }, time.Second, time.Millisecond)
+	client.mu.Lock()
+	update := client.updates[0]
+	assert.Equal(t, "SET #ttl = :ttl", *update.UpdateExpression)
+	assert.Equal(t, "expiresAt", update.ExpressionAttributeNames["#ttl"])
+	assert.Equal(t, &dynamodb_types.AttributeValueMemberS{Value: "feeds"}, update.Key[LockTablePartitionKey])
+	// refreshing stops once lock item is taken over
+	client.takenOver = true
+	client.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ttl refresh not stopped")
+	}
+	held.MarkReleased()
+}
@@ -0,0 +1,154 @@
+package dist_lock
+
+import (
+	"cirello.io/dynamolock/v2"
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodb_types "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strconv"
+)
+
+/*
+Fencing tokens protect resources against holders which keep working after their lease expired
+(e.g. process paused by GC or throttled container). Every acquisition gets token greater than all previously
+issued tokens of the same lock, resource remembers highest token it has seen and rejects writes with lower ones.
+Tokens are kept in separate items (<lock key>#fencing) of the lock table, they survive lock release.
+Token is issued in transaction checking that lock item still belongs to the acquisition, holder whose lease expired
+and lock was taken over before the token was issued therefore never gets token greater than the new holder's one.
+*/
+
+const (
+	// FencingTokenAttribute is attribute holding fencing token, both in counter items and in fenced items (see PutItemFenced)
+	FencingTokenAttribute = "fencingToken"
+
+	// fencingAcquisitionAttribute identifies acquisition in lock item, token is issued only while it is unchanged
+	fencingAcquisitionAttribute = "fencingAcquisition"
+	fencingCounterKeySuffix     = "#fencing"
+)
+
+// DynamodbClient is subset of *dynamodb.Client used by Manager and fenced locker
+type DynamodbClient interface {
+	dynamolock.DynamoDBClient
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// nextFencingToken increments fencing counter of given lock if lock item still belongs to given acquisition,
+// error wrapping ErrLockNotGranted is returned if lock was taken over meanwhile
+func nextFencingToken(ctx context.Context, client DynamodbClient, table string, partitionKeyName string, key string, lock *dynamolock.Lock, acquisition string) (int64, error) {
+	lockKey := map[string]dynamodb_types.AttributeValue{partitionKeyName: &dynamodb_types.AttributeValueMemberS{Value: key}}
+	counterKey := map[string]dynamodb_types.AttributeValue{partitionKeyName: &dynamodb_types.AttributeValueMemberS{Value: key + fencingCounterKeySuffix}}
+
+	owned, err := expression.NewBuilder().WithCondition(expression.And(
+		expression.Name(lockItemAttrOwnerName).Equal(expression.Value(lock.OwnerName())),
+		expression.Name(fencingAcquisitionAttribute).Equal(expression.Value(acquisition)),
+	)).Build()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws_sdk.String(table),
+			Key:            counterKey,
+			ConsistentRead: aws_sdk.Bool(true),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("cannot issue fencing token: %w", err)
+		}
+
+		// counter is compared and set as transactions do not return updated values
+		var current int64
+		unchanged := expression.AttributeNotExists(expression.Name(FencingTokenAttribute))
+		if token, ok := out.Item[FencingTokenAttribute].(*dynamodb_types.AttributeValueMemberN); ok {
+			if current, err = strconv.ParseInt(token.Value, 10, 64); err != nil {
+				return 0, fmt.Errorf("cannot issue fencing token: %w", err)
+			}
+			unchanged = expression.Name(FencingTokenAttribute).Equal(expression.Value(current))
+		}
+		increment, err := expression.NewBuilder().
+			WithCondition(unchanged).
+			WithUpdate(expression.Set(expression.Name(FencingTokenAttribute), expression.Value(current+1))).
+			Build()
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: []dynamodb_types.TransactWriteItem{
+			{ConditionCheck: &dynamodb_types.ConditionCheck{
+				TableName:                 aws_sdk.String(table),
+				Key:                       lockKey,
+				ConditionExpression:       owned.Condition(),
+				ExpressionAttributeNames:  owned.Names(),
+				ExpressionAttributeValues: owned.Values(),
+			}},
+			{Update: &dynamodb_types.Update{
+				TableName:                 aws_sdk.String(table),
+				Key:                       counterKey,
+				UpdateExpression:          increment.Update(),
+				ConditionExpression:       increment.Condition(),
+				ExpressionAttributeNames:  increment.Names(),
+				ExpressionAttributeValues: increment.Values(),
+			}},
+		}})
+		if err == nil {
+			return current + 1, nil
+		}
+
+		var canceledErr *dynamodb_types.TransactionCanceledException
+		if !errors.As(err, &canceledErr) || len(canceledErr.CancellationReasons) != 2 {
+			return 0, fmt.Errorf("cannot issue fencing token: %w", err)
+		}
+		if aws_sdk.ToString(canceledErr.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+			return 0, fmt.Errorf("%w: lock '%s' was taken over before fencing token was issued", ErrLockNotGranted, key)
+		}
+		// otherwise counter was incremented (or locked) by concurrent transaction, retry with fresh value
+	}
+}
+
+// FencingCondition accepts write only if item has no token yet or its token is not greater than given one,
+// same holder can therefore write repeatedly
+func FencingCondition(token int64) expression.ConditionBuilder {
+	return expression.Or(
+		expression.AttributeNotExists(expression.Name(FencingTokenAttribute)),
+		expression.Name(FencingTokenAttribute).LessThanEqual(expression.Value(token)),
+	)
+}
+
+// PutItemFenced stores token in the item and puts it only if stored item was not written by newer lock holder,
+// error wrapping ErrStaleFencingToken is returned otherwise. Input must not have its own condition expression.
+func PutItemFenced(ctx context.Context, client *dynamodb.Client, input *dynamodb.PutItemInput, token int64) (*dynamodb.PutItemOutput, error) {
+	if input.ConditionExpression != nil {
+		return nil, errors.New("PutItemFenced: input already has condition expression")
+	}
+
+	expr, err := expression.NewBuilder().WithCondition(FencingCondition(token)).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	fenced := *input
+	fenced.Item = make(map[string]dynamodb_types.AttributeValue, len(input.Item)+1)
+	for k, v := range input.Item {
+		fenced.Item[k] = v
+	}
+	fenced.Item[FencingTokenAttribute] = &dynamodb_types.AttributeValueMemberN{Value: strconv.FormatInt(token, 10)}
+	fenced.ConditionExpression = expr.Condition()
+	fenced.ExpressionAttributeNames = expr.Names()
+	fenced.ExpressionAttributeValues = expr.Values()
+
+	out, err := client.PutItem(ctx, &fenced)
+	return out, wrapStaleFencingToken(err)
+}
+
+// wrapStaleFencingToken makes failed fencing condition match ErrStaleFencingToken
+func wrapStaleFencingToken(err error) error {
+	var conditionFailedErr *dynamodb_types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailedErr) {
+		return fmt.Errorf("%w: %w", ErrStaleFencingToken, err)
+	}
+	return err
+}
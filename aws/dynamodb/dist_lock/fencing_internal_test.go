@@ -0,0 +1,56 @@
+package dist_lock
+
+import (
+	"context"
+	"errors"
+	dynamodb_types "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TstExpiredHolderCannotIssueFencingTokenLate(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	c := test.SetupLocalstack(ctx)
+	ctx = aws.SetCustomAwsEndpoint(ctx, c.URI)
+	defer c.TeardownLocalstack()
+
+	table := "fencingTable"
+	err := CreateLockTable(ctx, table, WithOnDemandBilling())
+	assert.Nil(t, err)
+	dynamodbClient, err := aws.CreateDynamodbClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+
+	// expired holder: lock acquired without heartbeats, token not issued yet (e.g. process paused)
+	expiredClient, err := newLockClient(dynamodbClient, time.Second, 0, table, newOptions([]Option{WithOwnerName("expired")}))
+	assert.Nil(t, err)
+	expiredLocker, err := NewFencedDynamodbLocker(expiredClient, time.Second, 300*time.Millisecond, dynamodbClient, table)
+	assert.Nil(t, err)
+	expiredLock, err := expiredClient.AcquireLockWithContext(ctx, "foo", expiredLocker.opts.acquireOptions(map[string]dynamodb_types.AttributeValue{
+		fencingAcquisitionAttribute: &dynamodb_types.AttributeValueMemberS{Value: "expired-acquisition"},
+	})...)
+	assert.Nil(t, err)
+
+	// new holder takes over expired lock and gets token
+	newClient, err := newLockClient(dynamodbClient, 3*time.Second, time.Second, table, newOptions([]Option{WithOwnerName("new")}))
+	assert.Nil(t, err)
+	newLocker, err := NewFencedDynamodbLocker(newClient, 3*time.Second, time.Second, dynamodbClient, table)
+	assert.Nil(t, err)
+	held, err := newLocker.Acquire(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), held.(FencedLock).FencingToken())
+
+	// expired holder resumes and must not get token greater than new holder's one
+	_, err = nextFencingToken(ctx, dynamodbClient, table, LockTablePartitionKey, "foo", expiredLock, "expired-acquisition")
+	assert.True(t, errors.Is(err, ErrLockNotGranted))
+
+	assert.Nil(t, held.Release(ctx))
+	again, err := newLocker.Acquire(ctx, "foo")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), again.(FencedLock).FencingToken())
+	assert.Nil(t, again.Release(ctx))
+}
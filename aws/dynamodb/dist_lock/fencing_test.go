@@ -0,0 +1,25 @@
+package dist_lock_test
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/dynamodb/dist_lock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFencingCondition(t *testing.T) {
+	expr, err := expression.NewBuilder().WithCondition(dist_lock.FencingCondition(7)).Build()
+	assert.Nil(t, err)
+	assert.Equal(t, "(attribute_not_exists (#0)) OR (#0 <= :0)", *expr.Condition())
+	assert.Equal(t, dist_lock.FencingTokenAttribute, expr.Names()["#0"])
+}
+
+func TestPutItemFencedRejectsOwnCondition(t *testing.T) {
+	condition := "attribute_not_exists(id)"
+	_, err := dist_lock.PutItemFenced(context.Background(), nil, &dynamodb.PutItemInput{ConditionExpression: &condition}, 1)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, dist_lock.ErrStaleFencingToken))
+}
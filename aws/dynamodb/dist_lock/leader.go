@@ -0,0 +1,133 @@
+package dist_lock
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog/log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultRetryPeriod = 2 * time.Second
+)
+
+// LeaderElectionConfig configures leader elector, zero values are replaced with defaults
+type LeaderElectionConfig struct {
+	// Name is name of the leadership lock, all candidates must use the same name
+	Name string
+	// Identity identifies this candidate, stored in lock data (see CurrentLeader), defaults to hostname
+	Identity string
+	// RetryPeriod is delay before new campaign after failure or lost leadership
+	RetryPeriod time.Duration
+	// OnStartedLeading is called once leadership is acquired, ctx is cancelled when leadership is lost or Run ends.
+	// It must return once ctx is cancelled, new campaign starts only after it returns. Leadership is released
+	// when it returns earlier.
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called after OnStartedLeading returned
+	OnStoppedLeading func()
+}
+
+// LeaderElector continually campaigns for leadership lock, use it for jobs which must run on exactly one replica
+type LeaderElector struct {
+	manager *Manager
+	table   string
+	cfg     LeaderElectionConfig
+	leader  atomic.Bool
+}
+
+// NewLeaderElector creates leader elector using locks from given table, start it with Run
+func NewLeaderElector(manager *Manager, table string, cfg LeaderElectionConfig) (*LeaderElector, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("NewLeaderElector: leadership lock name must be set")
+	}
+	if cfg.OnStartedLeading == nil {
+		return nil, errors.New("NewLeaderElector: OnStartedLeading callback must be set")
+	}
+	if cfg.Identity == "" {
+		if hostname, err := os.Hostname(); err != nil {
+			return nil, err
+		} else {
+			cfg.Identity = hostname
+		}
+	}
+	if cfg.RetryPeriod <= 0 {
+		cfg.RetryPeriod = DefaultRetryPeriod
+	}
+
+	return &LeaderElector{
+		manager: manager,
+		table:   table,
+		cfg:     cfg,
+	}, nil
+}
+
+// Run campaigns for leadership until ctx is cancelled, ctx.Err() is returned then. Leadership held when ctx is
+// cancelled is released so that other candidate can take over immediately.
+func (e *LeaderElector) Run(ctx context.Context) error {
+	locker, err := e.manager.locker(e.table)
+	if err != nil {
+		return err
+	}
+
+	for {
+		// waits until leadership is acquired, lock of crashed leader is taken over once its lease expires
+		lock, err := locker.AcquireWithData(ctx, e.cfg.Name, []byte(e.cfg.Identity))
+		if err == nil {
+			e.lead(ctx, lock)
+		} else if ctx.Err() == nil {
+			log.Warn().Err(err).Str("name", e.cfg.Name).Msg("leader election: campaign failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.cfg.RetryPeriod):
+		}
+	}
+}
+
+func (e *LeaderElector) lead(ctx context.Context, lock Lock) {
+	leaderCtx, cancel := context.WithCancel(lock.Context())
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	e.leader.Store(true)
+	log.Info().Str("name", e.cfg.Name).Str("identity", e.cfg.Identity).Msg("leader election: started leading")
+
+	e.cfg.OnStartedLeading(leaderCtx)
+	cancel()
+
+	e.leader.Store(false)
+	select {
+	case <-lock.Lost():
+		log.Warn().Str("name", e.cfg.Name).Str("identity", e.cfg.Identity).Msg("leader election: leadership lost")
+	default:
+		if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+			log.Warn().Err(err).Str("name", e.cfg.Name).Msg("leader election: cannot release leadership")
+		}
+		log.Info().Str("name", e.cfg.Name).Str("identity", e.cfg.Identity).Msg("leader election: stopped leading")
+	}
+
+	if e.cfg.OnStoppedLeading != nil {
+		e.cfg.OnStoppedLeading()
+	}
+}
+
+// IsLeader returns true while this candidate holds leadership
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// CurrentLeader returns identity of current leader, empty string if there is none
+func (e *LeaderElector) CurrentLeader(ctx context.Context) (string, error) {
+	if e.IsLeader() {
+		return e.cfg.Identity, nil
+	}
+	data, err := e.manager.LockData(ctx, e.table, e.cfg.Name)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
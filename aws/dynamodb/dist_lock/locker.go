@@ -0,0 +1,29 @@
+package dist_lock
+
+import (
+	"context"
+	"github.com/hrsupersport/hrnogomet-backend-kit/lock"
+)
+
+// Backend neutral lock interfaces live in lock package so that postgres backend does not depend on this package,
+// aliases keep existing callers working.
+type (
+	DistributedLock = lock.DistributedLock
+	Locker          = lock.Locker
+	Lock            = lock.Lock
+	FencedLock      = lock.FencedLock
+	LockState       = lock.LockState
+)
+
+var (
+	// ErrLockNotGranted is returned (wrapped) when lock cannot be acquired in time,
+	// *dynamolock.LockNotGrantedError is wrapped as well
+	ErrLockNotGranted = lock.ErrLockNotGranted
+	// ErrStaleFencingToken is returned (wrapped) when write is rejected because newer lock holder already wrote to resource
+	ErrStaleFencingToken = lock.ErrStaleFencingToken
+)
+
+// NewLockState creates state of newly acquired lock, see lock.NewLockState
+func NewLockState(parent context.Context) *LockState {
+	return lock.NewLockState(parent)
+}
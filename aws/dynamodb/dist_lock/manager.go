@@ -0,0 +1,395 @@
+package dist_lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodb_types "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLeaseDuration   = 10 * time.Second
+	DefaultHeartbeatPeriod = 3 * time.Second
+
+	// attributes of lock items managed by dynamolock
+	lockItemAttrData       = "data"
+	lockItemAttrIsReleased = "isReleased"
+	lockItemAttrOwnerName  = "ownerName"
+)
+
+// ErrManagerClosed is returned when lock is requested from closed Manager
+var ErrManagerClosed = errors.New("lock manager is closed")
+
+// ManagerConfig configures lock manager, zero values are replaced with defaults
+type ManagerConfig struct {
+	// LeaseDuration is lease of every lock, lock held by crashed owner can be taken over after it expires
+	LeaseDuration time.Duration
+	// HeartbeatPeriod is interval of lease extensions, must be well below LeaseDuration
+	HeartbeatPeriod time.Duration
+	// SafeTime lock is reported as lost once less than SafeTime of lease is left without successful heartbeat,
+	// must be shorter than LeaseDuration, see defaultSafeTime for default
+	SafeTime time.Duration
+	// FencingTokens enables fencing tokens, locks returned by manager implement FencedLock then
+	FencingTokens bool
+	// OnAcquire is called after every acquisition attempt, use it to feed metrics (latency, contention)
+	OnAcquire func(e AcquireEvent)
+}
+
+// AcquireEvent describes single acquisition attempt
+type AcquireEvent struct {
+	Table    string
+	Key      string
+	Duration time.Duration
+	// Contended is true if lock was held by someone else (i.e. TryAcquire was refused or Acquire had to wait)
+	Contended bool
+	Err       error
+}
+
+// Stats are cumulative lock manager counters
+type Stats struct {
+	Acquired int64
+	// NotGranted counts acquisitions refused because lock was held by someone else
+	NotGranted int64
+	// Failed counts acquisitions failed for other reasons (e.g. dynamodb errors, cancelled context)
+	Failed   int64
+	Released int64
+	Lost     int64
+	// Held is number of currently held locks
+	Held int
+	// AcquireTime is total time spent by successful acquisitions, AcquireTime/Acquired gives average latency
+	AcquireTime time.Duration
+}
+
+// Manager owns one dynamolock client per table shared by all locks acquired through it, keeps track of held locks
+// and releases them on Close. Use one Manager per process instead of NewDistributedDynamodbLock which creates
+// new clients for every lock.
+type Manager struct {
+	dynamodbClient DynamodbClient
+	cfg            ManagerConfig
+	opts           []Option
+	partitionKey   string
+
+	mu      sync.Mutex
+	closed  bool
+	lockers map[string]*managedLocker
+	held    map[*managedLock]struct{}
+	stats   Stats
+}
+
+// NewManager creates manager using new dynamodb client for given region, honours WithPartitionKeyName,
+// WithOwnerName and WithTTL options
+func NewManager(ctx context.Context, awsRegion string, cfg ManagerConfig, opts ...Option) (*Manager, error) {
+	dynamodbClient, err := aws.CreateDynamodbClient(ctx, awsRegion)
+	if err != nil {
+		return nil, err
+	}
+	return NewManagerWithClient(dynamodbClient, cfg, opts...)
+}
+
+// defaultSafeTime leaves more than two heartbeat periods between last successful heartbeat and lock being reported
+// as lost, so that single failed or slow heartbeat does not lose the lock. Rest of the lease is split evenly.
+func defaultSafeTime(leaseDuration time.Duration, heartbeatPeriod time.Duration) time.Duration {
+	return (leaseDuration - 2*heartbeatPeriod) / 2
+}
+
+// validateLease checks that heartbeats can extend the lease before it expires and that safe time fits into the lease
+func validateLease(leaseDuration time.Duration, heartbeatPeriod time.Duration, safeTime time.Duration) error {
+	if heartbeatPeriod >= leaseDuration {
+		return fmt.Errorf("heartbeat period %s must be shorter than lease duration %s", heartbeatPeriod, leaseDuration)
+	}
+	if safeTime <= 0 || safeTime >= leaseDuration {
+		return fmt.Errorf("safe time %s must be positive and shorter than lease duration %s (heartbeat period %s is too long for default safe time)",
+			safeTime, leaseDuration, heartbeatPeriod)
+	}
+	return nil
+}
+
+// NewManagerWithClient creates manager using provided dynamodb client, see NewManager for supported options
+func NewManagerWithClient(dynamodbClient DynamodbClient, cfg ManagerConfig, opts ...Option) (*Manager, error) {
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = DefaultLeaseDuration
+	}
+	if cfg.HeartbeatPeriod <= 0 {
+		cfg.HeartbeatPeriod = DefaultHeartbeatPeriod
+	}
+	if cfg.SafeTime <= 0 {
+		cfg.SafeTime = defaultSafeTime(cfg.LeaseDuration, cfg.HeartbeatPeriod)
+	}
+	if err := validateLease(cfg.LeaseDuration, cfg.HeartbeatPeriod, cfg.SafeTime); err != nil {
+		return nil, fmt.Errorf("NewManager: %w", err)
+	}
+	o := newOptions(opts)
+	if o.ttlAttribute != "" && o.ttl <= cfg.LeaseDuration {
+		return nil, fmt.Errorf("NewManager: ttl %s must be longer than lease duration %s", o.ttl, cfg.LeaseDuration)
+	}
+
+	return &Manager{
+		dynamodbClient: dynamodbClient,
+		cfg:            cfg,
+		opts:           opts,
+		partitionKey:   o.partitionKeyName,
+		lockers:        make(map[string]*managedLocker),
+		held:           make(map[*managedLock]struct{}),
+	}, nil
+}
+
+// Locker returns locker acquiring locks in given table, lock client of the table is created on first use
+func (m *Manager) Locker(table string) (Locker, error) {
+	if locker, err := m.locker(table); err != nil {
+		return nil, err
+	} else {
+		return locker, nil
+	}
+}
+
+// Acquire waits until lock in given table is acquired or ctx is done
+func (m *Manager) Acquire(ctx context.Context, table string, key string) (Lock, error) {
+	if locker, err := m.locker(table); err != nil {
+		return nil, err
+	} else {
+		return locker.Acquire(ctx, key)
+	}
+}
+
+// TryAcquire makes single attempt to acquire lock in given table, error wrapping ErrLockNotGranted is returned
+// if lock is held by someone else
+func (m *Manager) TryAcquire(ctx context.Context, table string, key string) (Lock, error) {
+	if locker, err := m.locker(table); err != nil {
+		return nil, err
+	} else {
+		return locker.TryAcquire(ctx, key)
+	}
+}
+
+// LockData returns data stored by current holder of the lock (see DynamodbLocker.AcquireWithData), nil if lock is not held.
+// Holder which crashed without releasing the lock is reported until its lease is taken over by someone else.
+func (m *Manager) LockData(ctx context.Context, table string, key string) ([]byte, error) {
+	// item is read directly, dynamolock Get would reset lease of the lock if it is held by this process
+	out, err := m.dynamodbClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws_sdk.String(table),
+		Key:            map[string]dynamodb_types.AttributeValue{m.partitionKey: &dynamodb_types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws_sdk.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, released := out.Item[lockItemAttrIsReleased]; released {
+		return nil, nil
+	}
+	if data, ok := out.Item[lockItemAttrData].(*dynamodb_types.AttributeValueMemberB); ok {
+		return data.Value, nil
+	}
+	return nil, nil
+}
+
+// HeldLocks returns currently held locks as table/key
+func (m *Manager) HeldLocks() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	held := make([]string, 0, len(m.held))
+	for l := range m.held {
+		held = append(held, l.table+"/"+l.Key())
+	}
+	sort.Strings(held)
+	return held
+}
+
+// Stats returns snapshot of manager counters
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Held = len(m.held)
+	return stats
+}
+
+// Close releases all held locks and closes lock clients, call it on graceful shutdown
+// so that other instances do not have to wait for lease expiry
+func (m *Manager) Close(ctx context.Context) error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	held := make([]*managedLock, 0, len(m.held))
+	for l := range m.held {
+		held = append(held, l)
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, l := range held {
+		if err := l.Release(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, locker := range m.lockers {
+		if err := locker.client.CloseWithContext(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Manager) locker(table string) (*managedLocker, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrManagerClosed
+	}
+	if locker, ok := m.lockers[table]; ok {
+		return locker, nil
+	}
+
+	client, err := newLockClient(m.dynamodbClient, m.cfg.LeaseDuration, m.cfg.HeartbeatPeriod, table, newOptions(m.opts))
+	if err != nil {
+		return nil, err
+	}
+
+	dynamodbLocker, err := newDynamodbLocker(client, m.cfg.LeaseDuration, m.cfg.SafeTime, m.dynamodbClient, table, m.cfg.FencingTokens, newOptions(m.opts))
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	locker := &managedLocker{
+		DynamodbLocker: dynamodbLocker,
+		manager:        m,
+		table:          table,
+	}
+	m.lockers[table] = locker
+	return locker, nil
+}
+
+// track records outcome of acquisition, lock acquired after manager was closed is released immediately
+func (m *Manager) track(table string, key string, started time.Time, contended bool, lock Lock, err error) (Lock, error) {
+	duration := time.Since(started)
+
+	var held *managedLock
+	m.mu.Lock()
+	switch {
+	case err == nil && m.closed:
+		m.mu.Unlock()
+		_ = lock.Release(context.Background())
+		return nil, ErrManagerClosed
+	case err == nil:
+		held = &managedLock{Lock: lock, manager: m, table: table}
+		m.held[held] = struct{}{}
+		m.stats.Acquired++
+		m.stats.AcquireTime += duration
+	case errors.Is(err, ErrLockNotGranted):
+		m.stats.NotGranted++
+		contended = true
+	default:
+		m.stats.Failed++
+	}
+	m.mu.Unlock()
+
+	if m.cfg.OnAcquire != nil {
+		m.cfg.OnAcquire(AcquireEvent{
+			Table:     table,
+			Key:       key,
+			Duration:  duration,
+			Contended: contended,
+			Err:       err,
+		})
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	go held.watch()
+	return held, nil
+}
+
+func (m *Manager) untrack(l *managedLock, lost bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.held[l]; !ok {
+		return
+	}
+	delete(m.held, l)
+	if lost {
+		m.stats.Lost++
+	} else {
+		m.stats.Released++
+	}
+}
+
+type managedLocker struct {
+	*DynamodbLocker
+	manager *Manager
+	table   string
+}
+
+func (l *managedLocker) Acquire(ctx context.Context, key string) (Lock, error) {
+	return l.AcquireWithData(ctx, key, nil)
+}
+
+func (l *managedLocker) AcquireWithData(ctx context.Context, key string, data []byte) (Lock, error) {
+	started := time.Now()
+	lock, err := l.DynamodbLocker.TryAcquireWithData(ctx, key, data)
+	if err == nil || !errors.Is(err, ErrLockNotGranted) {
+		return l.manager.track(l.table, key, started, false, lock, err)
+	}
+
+	// lock is held by someone else, wait for it (dynamolock keeps polling until lease of current owner expires)
+	lock, err = l.DynamodbLocker.AcquireWithData(ctx, key, data)
+	return l.manager.track(l.table, key, started, true, lock, err)
+}
+
+func (l *managedLocker) TryAcquire(ctx context.Context, key string) (Lock, error) {
+	started := time.Now()
+	lock, err := l.DynamodbLocker.TryAcquire(ctx, key)
+	return l.manager.track(l.table, key, started, false, lock, err)
+}
+
+func (l *managedLocker) TryAcquireWithData(ctx context.Context, key string, data []byte) (Lock, error) {
+	started := time.Now()
+	lock, err := l.DynamodbLocker.TryAcquireWithData(ctx, key, data)
+	return l.manager.track(l.table, key, started, false, lock, err)
+}
+
+var _ FencedLock = (*managedLock)(nil)
+
+type managedLock struct {
+	Lock
+	manager *Manager
+	table   string
+}
+
+func (l *managedLock) Release(ctx context.Context) error {
+	l.manager.untrack(l, false)
+	return l.Lock.Release(ctx)
+}
+
+func (l *managedLock) FencingToken() int64 {
+	if fenced, ok := l.Lock.(FencedLock); ok {
+		return fenced.FencingToken()
+	}
+	return 0
+}
+
+func (l *managedLock) ReleaseLock() error {
+	return l.Release(context.Background())
+}
+
+// watch stops tracking lost lock, context is cancelled on both loss and release
+func (l *managedLock) watch() {
+	<-l.Context().Done()
+	select {
+	case <-l.Lost():
+		l.manager.untrack(l, true)
+	default:
+	}
+}
@@ -0,0 +1,41 @@
+package dist_lock
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestManagerDefaultSafeTimeSurvivesFailedHeartbeat(t *testing.T) {
+	for _, cfg := range []ManagerConfig{
+		{},
+		{LeaseDuration: 3 * time.Second, HeartbeatPeriod: time.Second},
+		{LeaseDuration: time.Minute, HeartbeatPeriod: 10 * time.Second},
+	} {
+		m, err := NewManagerWithClient(nil, cfg)
+		assert.Nil(t, err, cfg)
+		// lock must not be reported lost before heartbeat following a failed one had a chance to extend the lease
+		assert.Greater(t, m.cfg.LeaseDuration-m.cfg.SafeTime, 2*m.cfg.HeartbeatPeriod, cfg)
+		assert.Greater(t, m.cfg.SafeTime, time.Duration(0), cfg)
+	}
+
+	m, err := NewManagerWithClient(nil, ManagerConfig{SafeTime: time.Second})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, m.cfg.SafeTime)
+}
+
+func TestNewManagerValidatesLease(t *testing.T) {
+	for _, cfg := range []ManagerConfig{
+		{LeaseDuration: 3 * time.Second, HeartbeatPeriod: 3 * time.Second, SafeTime: time.Second},
+		{LeaseDuration: 3 * time.Second, HeartbeatPeriod: 5 * time.Second},
+		// default safe time would not be positive
+		{LeaseDuration: 4 * time.Second, HeartbeatPeriod: 2 * time.Second},
+		{LeaseDuration: 4 * time.Second, HeartbeatPeriod: time.Second, SafeTime: 4 * time.Second},
+	} {
+		_, err := NewManagerWithClient(nil, cfg)
+		assert.NotNil(t, err, cfg)
+	}
+
+	_, err := NewManagerWithClient(nil, ManagerConfig{}, WithTTL("", 5*time.Second))
+	assert.NotNil(t, err)
+}
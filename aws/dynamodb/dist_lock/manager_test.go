@@ -0,0 +1,121 @@
+package dist_lock_test
+
+import (
+	"context"
+	"errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/dynamodb/dist_lock"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestClosedManagerRefusesLocks(t *testing.T) {
+	manager, err := dist_lock.NewManagerWithClient(nil, dist_lock.ManagerConfig{})
+	assert.Nil(t, err)
+	assert.Nil(t, manager.Close(context.Background()))
+
+	_, err = manager.TryAcquire(context.Background(), dynamoDistLockTableName, "foo")
+	assert.True(t, errors.Is(err, dist_lock.ErrManagerClosed))
+	_, err = manager.Locker(dynamoDistLockTableName)
+	assert.True(t, errors.Is(err, dist_lock.ErrManagerClosed))
+}
+
+func TstManagerSharesClientAndReleasesLocksOnClose(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	c := test.SetupLocalstack(ctx)
+	ctx = aws.SetCustomAwsEndpoint(ctx, c.URI)
+	defer c.TeardownLocalstack()
+
+	err := dist_lock.CreateLockTable(ctx, dynamoDistLockTableName, dist_lock.WithOnDemandBilling(), dist_lock.WithTTL("", 0))
+	assert.Nil(t, err)
+
+	var events []dist_lock.AcquireEvent
+	manager, err := dist_lock.NewManager(ctx, constants.AwsDefaultRegion, dist_lock.ManagerConfig{
+		LeaseDuration:   3 * time.Second,
+		HeartbeatPeriod: time.Second,
+		OnAcquire: func(e dist_lock.AcquireEvent) {
+			events = append(events, e)
+		},
+	})
+	assert.Nil(t, err)
+
+	foo, err := manager.Acquire(ctx, dynamoDistLockTableName, "foo")
+	assert.Nil(t, err)
+	_, err = manager.Acquire(ctx, dynamoDistLockTableName, "bar")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{dynamoDistLockTableName + "/bar", dynamoDistLockTableName + "/foo"}, manager.HeldLocks())
+
+	_, err = manager.TryAcquire(ctx, dynamoDistLockTableName, "foo")
+	assert.True(t, errors.Is(err, dist_lock.ErrLockNotGranted))
+
+	assert.Nil(t, foo.Release(ctx))
+	assert.Nil(t, manager.Close(ctx))
+
+	stats := manager.Stats()
+	assert.Equal(t, int64(2), stats.Acquired)
+	assert.Equal(t, int64(1), stats.NotGranted)
+	assert.Equal(t, int64(2), stats.Released)
+	assert.Equal(t, 0, stats.Held)
+	assert.Len(t, events, 3)
+	assert.True(t, events[2].Contended)
+}
+
+func TstLeaderElection(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := test.SetupLocalstack(ctx)
+	ctx = aws.SetCustomAwsEndpoint(ctx, c.URI)
+	defer c.TeardownLocalstack()
+
+	err := dist_lock.CreateLockTable(ctx, dynamoDistLockTableName, dist_lock.WithOnDemandBilling(), dist_lock.WithTTL("", 0))
+	assert.Nil(t, err)
+
+	manager, err := dist_lock.NewManager(ctx, constants.AwsDefaultRegion, dist_lock.ManagerConfig{
+		LeaseDuration:   3 * time.Second,
+		HeartbeatPeriod: time.Second,
+	})
+	assert.Nil(t, err)
+	defer manager.Close(ctx)
+
+	started := make(chan string, 2)
+	newCandidate := func(identity string) *dist_lock.LeaderElector {
+		elector, err := dist_lock.NewLeaderElector(manager, dynamoDistLockTableName, dist_lock.LeaderElectionConfig{
+			Name:     "scheduler",
+			Identity: identity,
+			OnStartedLeading: func(ctx context.Context) {
+				started <- identity
+				<-ctx.Done()
+			},
+		})
+		assert.Nil(t, err)
+		return elector
+	}
+
+	first := newCandidate("first")
+	firstCtx, stopFirst := context.WithCancel(ctx)
+	go func() { _ = first.Run(firstCtx) }()
+	assert.Equal(t, "first", <-started)
+
+	second := newCandidate("second")
+	go func() { _ = second.Run(ctx) }()
+
+	leader, err := second.CurrentLeader(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", leader)
+
+	// first candidate steps down, second takes over
+	stopFirst()
+	select {
+	case identity := <-started:
+		assert.Equal(t, "second", identity)
+	case <-time.After(15 * time.Second):
+		t.Fatal("leadership not taken over")
+	}
+	assert.True(t, second.IsLeader())
+	assert.False(t, first.IsLeader())
+}
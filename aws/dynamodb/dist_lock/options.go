@@ -0,0 +1,114 @@
+package dist_lock
+
+import (
+	"cirello.io/dynamolock/v2"
+	dynamodb_types "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultTTLAttribute is name of TTL attribute used by WithTTL when attribute is empty
+	DefaultTTLAttribute = "TTL"
+	// DefaultTTL is used by WithTTL when ttl is zero
+	DefaultTTL = 24 * time.Hour
+)
+
+// Option customizes lock clients, lockers and lock tables, options not relevant for given call are ignored
+type Option func(*options)
+
+type options struct {
+	region           string
+	partitionKeyName string
+	ownerName        string
+	ttlAttribute     string
+	ttl              time.Duration
+	onDemandBilling  bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		region:           constants.AwsDefaultRegion,
+		partitionKeyName: LockTablePartitionKey,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithRegion sets aws region of lock table, constants.AwsDefaultRegion by default
+func WithRegion(region string) Option {
+	return func(o *options) {
+		o.region = region
+	}
+}
+
+// WithPartitionKeyName sets name of partition key of lock table, LockTablePartitionKey by default
+func WithPartitionKeyName(name string) Option {
+	return func(o *options) {
+		o.partitionKeyName = name
+	}
+}
+
+// WithOwnerName sets owner name stored in lock items, random by default. Owner names must be unique per process.
+func WithOwnerName(name string) Option {
+	return func(o *options) {
+		o.ownerName = name
+	}
+}
+
+// WithTTL stores expiry timestamp (epoch seconds) acquisition time + ttl into attribute of every lock item,
+// with TTL enabled on the table dynamodb deletes rows left behind by crashed processes. Locks acquired by Manager
+// (and fenced locker) refresh the timestamp while they are held, timestamp of locks acquired by AcquireLock is not
+// extended by heartbeats, ttl must be much longer than such locks are held. Empty attribute means DefaultTTLAttribute,
+// zero ttl means DefaultTTL.
+func WithTTL(attribute string, ttl time.Duration) Option {
+	return func(o *options) {
+		if attribute == "" {
+			attribute = DefaultTTLAttribute
+		}
+		if ttl <= 0 {
+			ttl = DefaultTTL
+		}
+		o.ttlAttribute = attribute
+		o.ttl = ttl
+	}
+}
+
+// WithOnDemandBilling creates lock table with on-demand (pay per request) billing, used by CreateLockTable only
+func WithOnDemandBilling() Option {
+	return func(o *options) {
+		o.onDemandBilling = true
+	}
+}
+
+// clientOptions returns dynamolock client options
+func (o *options) clientOptions() []dynamolock.ClientOption {
+	clientOpts := []dynamolock.ClientOption{dynamolock.WithPartitionKeyName(o.partitionKeyName)}
+	if o.ownerName != "" {
+		clientOpts = append(clientOpts, dynamolock.WithOwnerName(o.ownerName))
+	}
+	return clientOpts
+}
+
+// acquireOptions returns dynamolock options storing given attributes and TTL attribute (if enabled) in lock item
+func (o *options) acquireOptions(attrs map[string]dynamodb_types.AttributeValue) []dynamolock.AcquireLockOption {
+	additional := make(map[string]dynamodb_types.AttributeValue, len(attrs)+1)
+	for k, v := range attrs {
+		additional[k] = v
+	}
+	if o.ttlAttribute != "" {
+		additional[o.ttlAttribute] = o.ttlValue()
+	}
+	if len(additional) == 0 {
+		return nil
+	}
+	return []dynamolock.AcquireLockOption{dynamolock.WithAdditionalAttributes(additional)}
+}
+
+// ttlValue returns value of TTL attribute for lock item stored or refreshed now
+func (o *options) ttlValue() *dynamodb_types.AttributeValueMemberN {
+	return &dynamodb_types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(o.ttl).Unix(), 10)}
+}
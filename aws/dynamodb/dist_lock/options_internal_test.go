@@ -0,0 +1,29 @@
+package dist_lock
+
+import (
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestOptionsDefaults(t *testing.T) {
+	o := newOptions(nil)
+	assert.Equal(t, constants.AwsDefaultRegion, o.region)
+	assert.Equal(t, LockTablePartitionKey, o.partitionKeyName)
+	assert.Empty(t, o.acquireOptions(nil))
+	assert.Len(t, o.clientOptions(), 1)
+}
+
+func TestOptionsTTL(t *testing.T) {
+	o := newOptions([]Option{WithTTL("", 0), WithOwnerName("worker-1"), WithRegion("us-east-1")})
+	assert.Equal(t, DefaultTTLAttribute, o.ttlAttribute)
+	assert.Equal(t, DefaultTTL, o.ttl)
+	assert.Equal(t, "us-east-1", o.region)
+	assert.Len(t, o.acquireOptions(nil), 1)
+	assert.Len(t, o.clientOptions(), 2)
+
+	o = newOptions([]Option{WithTTL("expiresAt", time.Hour)})
+	assert.Equal(t, "expiresAt", o.ttlAttribute)
+	assert.Equal(t, time.Hour, o.ttl)
+}
@@ -0,0 +1,381 @@
+package dist_lock
+
+import (
+	"cirello.io/dynamolock/v2"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodb_types "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Counting semaphore stored as single item (<key>#semaphore) of the lock table:
+	holders - map of holder id to lease expiry (unix millis)
+	version - incremented on every acquisition and lease extension, guards acquisitions against each other
+	and against heartbeats of holders they reclaim
+Holders extend their leases by heartbeats, permits of crashed holders are reclaimed by next acquisition
+once their lease expires. Heartbeat does not extend lease which has already expired. Expiry is compared with local clock, replicas must have reasonably synchronized clocks.
+*/
+
+const (
+	DefaultSemaphoreRetryInterval = 500 * time.Millisecond
+
+	semaphoreKeySuffix        = "#semaphore"
+	semaphoreAttrHolders      = "holders"
+	semaphoreAttrVersion      = "version"
+	maxSemaphoreStoreAttempts = 10
+)
+
+var (
+	_ Locker = (*Semaphore)(nil)
+	_ Lock   = (*semaphorePermit)(nil)
+)
+
+// SemaphoreConfig configures semaphore, zero values are replaced with defaults
+type SemaphoreConfig struct {
+	// Permits is max number of concurrent holders of every semaphore key, must be set
+	Permits int
+	// LeaseDuration is lease of every permit, permit of crashed holder is reclaimed after it expires
+	LeaseDuration time.Duration
+	// HeartbeatPeriod is interval of lease extensions, must be well below LeaseDuration
+	HeartbeatPeriod time.Duration
+	// SafeTime permit is reported as lost once less than SafeTime of its lease is left without successful heartbeat,
+	// must be shorter than LeaseDuration, see defaultSafeTime for default
+	SafeTime time.Duration
+	// RetryInterval is interval between acquisition attempts while all permits are taken
+	RetryInterval time.Duration
+}
+
+// Semaphore is distributed counting semaphore allowing up to Permits concurrent holders per key.
+// It implements Locker, acquired permit implements Lock.
+type Semaphore struct {
+	dynamodbClient dynamolock.DynamoDBClient
+	table          string
+	cfg            SemaphoreConfig
+	opts           *options
+	now            func() time.Time
+}
+
+// NewSemaphore creates semaphore stored in given (lock) table, honours WithPartitionKeyName option
+func NewSemaphore(dynamodbClient dynamolock.DynamoDBClient, table string, cfg SemaphoreConfig, opts ...Option) (*Semaphore, error) {
+	if cfg.Permits <= 0 {
+		return nil, errors.New("NewSemaphore: number of permits must be positive")
+	}
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = DefaultLeaseDuration
+	}
+	if cfg.HeartbeatPeriod <= 0 {
+		cfg.HeartbeatPeriod = DefaultHeartbeatPeriod
+	}
+	if cfg.SafeTime <= 0 {
+		cfg.SafeTime = defaultSafeTime(cfg.LeaseDuration, cfg.HeartbeatPeriod)
+	}
+	if err := validateLease(cfg.LeaseDuration, cfg.HeartbeatPeriod, cfg.SafeTime); err != nil {
+		return nil, fmt.Errorf("NewSemaphore: %w", err)
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultSemaphoreRetryInterval
+	}
+
+	return &Semaphore{
+		dynamodbClient: dynamodbClient,
+		table:          table,
+		cfg:            cfg,
+		opts:           newOptions(opts),
+		now:            time.Now,
+	}, nil
+}
+
+// Acquire waits until permit is acquired or ctx is done
+func (s *Semaphore) Acquire(ctx context.Context, key string) (Lock, error) {
+	for {
+		permit, err := s.TryAcquire(ctx, key)
+		if err == nil || !errors.Is(err, ErrLockNotGranted) {
+			return permit, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(s.cfg.RetryInterval):
+		}
+	}
+}
+
+// TryAcquire makes single attempt, error wrapping ErrLockNotGranted is returned if all permits are taken
+func (s *Semaphore) TryAcquire(ctx context.Context, key string) (Lock, error) {
+	holderID, err := newHolderID()
+	if err != nil {
+		return nil, err
+	}
+
+	// store attempts conflicting with concurrent acquisitions are retried with fresh state
+	for attempt := 0; attempt < maxSemaphoreStoreAttempts; attempt++ {
+		state, err := s.read(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		now := s.now()
+		expired := state.expired(now)
+		if len(state.holders)-len(expired) >= s.cfg.Permits {
+			return nil, fmt.Errorf("%w: all %d permits of semaphore '%s' are taken", ErrLockNotGranted, s.cfg.Permits, key)
+		}
+
+		stored, err := s.store(ctx, key, state, holderID, expired, now.Add(s.cfg.LeaseDuration))
+		if err != nil {
+			return nil, err
+		}
+		if stored {
+			permit := &semaphorePermit{
+				LockState:     NewLockState(ctx),
+				semaphore:     s,
+				key:           key,
+				holderID:      holderID,
+				lastHeartbeat: now,
+			}
+			go permit.heartbeat()
+			return permit, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: semaphore '%s' is heavily contended", ErrLockNotGranted, key)
+}
+
+// Holders returns number of current (not expired) holders of given semaphore key
+func (s *Semaphore) Holders(ctx context.Context, key string) (int, error) {
+	state, err := s.read(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return len(state.holders) - len(state.expired(s.now())), nil
+}
+
+type semaphoreState struct {
+	exists  bool
+	version int64
+	// holders maps holder id to lease expiry
+	holders map[string]time.Time
+}
+
+// expired returns sorted ids of holders with expired lease
+func (st *semaphoreState) expired(now time.Time) []string {
+	var expired []string
+	for id, expiresAt := range st.holders {
+		if !expiresAt.After(now) {
+			expired = append(expired, id)
+		}
+	}
+	sort.Strings(expired)
+	return expired
+}
+
+func (s *Semaphore) itemKey(key string) map[string]dynamodb_types.AttributeValue {
+	return map[string]dynamodb_types.AttributeValue{
+		s.opts.partitionKeyName: &dynamodb_types.AttributeValueMemberS{Value: key + semaphoreKeySuffix},
+	}
+}
+
+func (s *Semaphore) read(ctx context.Context, key string) (*semaphoreState, error) {
+	out, err := s.dynamodbClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws_sdk.String(s.table),
+		Key:            s.itemKey(key),
+		ConsistentRead: aws_sdk.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	state := &semaphoreState{holders: make(map[string]time.Time)}
+	if out.Item == nil {
+		return state, nil
+	}
+	state.exists = true
+
+	if version, ok := out.Item[semaphoreAttrVersion].(*dynamodb_types.AttributeValueMemberN); ok {
+		if state.version, err = strconv.ParseInt(version.Value, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if holders, ok := out.Item[semaphoreAttrHolders].(*dynamodb_types.AttributeValueMemberM); ok {
+		for id, value := range holders.Value {
+			if expiresAt, ok := value.(*dynamodb_types.AttributeValueMemberN); ok {
+				millis, err := strconv.ParseInt(expiresAt.Value, 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				state.holders[id] = time.UnixMilli(millis)
+			}
+		}
+	}
+	return state, nil
+}
+
+// store adds holder and removes expired holders, returns false if item was changed since it was read
+func (s *Semaphore) store(ctx context.Context, key string, state *semaphoreState, holderID string, expired []string, expiresAt time.Time) (bool, error) {
+	var err error
+	if !state.exists {
+		item := s.itemKey(key)
+		item[semaphoreAttrVersion] = &dynamodb_types.AttributeValueMemberN{Value: "1"}
+		item[semaphoreAttrHolders] = &dynamodb_types.AttributeValueMemberM{Value: map[string]dynamodb_types.AttributeValue{
+			holderID: millisAttr(expiresAt),
+		}}
+		_, err = s.dynamodbClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                aws_sdk.String(s.table),
+			Item:                     item,
+			ConditionExpression:      aws_sdk.String("attribute_not_exists(#pk)"),
+			ExpressionAttributeNames: map[string]string{"#pk": s.opts.partitionKeyName},
+		})
+	} else {
+		names := map[string]string{
+			"#holders": semaphoreAttrHolders,
+			"#version": semaphoreAttrVersion,
+			"#me":      holderID,
+		}
+		values := map[string]dynamodb_types.AttributeValue{
+			":expiresAt": millisAttr(expiresAt),
+			":version":   &dynamodb_types.AttributeValueMemberN{Value: strconv.FormatInt(state.version, 10)},
+			":next":      &dynamodb_types.AttributeValueMemberN{Value: strconv.FormatInt(state.version+1, 10)},
+		}
+		update := "SET #holders.#me = :expiresAt, #version = :next"
+		if len(expired) > 0 {
+			removals := make([]string, 0, len(expired))
+			for i, id := range expired {
+				name := "#expired" + strconv.Itoa(i)
+				names[name] = id
+				removals = append(removals, "#holders."+name)
+			}
+			update += " REMOVE " + strings.Join(removals, ", ")
+		}
+		_, err = s.dynamodbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws_sdk.String(s.table),
+			Key:                       s.itemKey(key),
+			UpdateExpression:          aws_sdk.String(update),
+			ConditionExpression:       aws_sdk.String("#version = :version"),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		})
+	}
+
+	var conditionFailedErr *dynamodb_types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailedErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// extend prolongs lease of holder, returns false if holder is no longer present (its permit was reclaimed)
+// or its lease has expired. Version is incremented so that acquisitions which read the lease as expired
+// cannot reclaim it afterwards.
+func (s *Semaphore) extend(ctx context.Context, key string, holderID string, now time.Time, expiresAt time.Time) (bool, error) {
+	_, err := s.dynamodbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws_sdk.String(s.table),
+		Key:                      s.itemKey(key),
+		UpdateExpression:         aws_sdk.String("SET #holders.#me = :expiresAt, #version = #version + :one"),
+		ConditionExpression:      aws_sdk.String("#holders.#me > :now"),
+		ExpressionAttributeNames: map[string]string{"#holders": semaphoreAttrHolders, "#me": holderID, "#version": semaphoreAttrVersion},
+		ExpressionAttributeValues: map[string]dynamodb_types.AttributeValue{
+			":expiresAt": millisAttr(expiresAt),
+			":now":       millisAttr(now),
+			":one":       &dynamodb_types.AttributeValueMemberN{Value: "1"},
+		},
+	})
+
+	var conditionFailedErr *dynamodb_types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailedErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Semaphore) remove(ctx context.Context, key string, holderID string) error {
+	_, err := s.dynamodbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws_sdk.String(s.table),
+		Key:                      s.itemKey(key),
+		UpdateExpression:         aws_sdk.String("REMOVE #holders.#me"),
+		ExpressionAttributeNames: map[string]string{"#holders": semaphoreAttrHolders, "#me": holderID},
+	})
+	return err
+}
+
+type semaphorePermit struct {
+	*LockState
+	semaphore *Semaphore
+	key       string
+	holderID  string
+	// lastHeartbeat is accessed by heartbeat goroutine only
+	lastHeartbeat time.Time
+}
+
+func (p *semaphorePermit) Key() string {
+	return p.key
+}
+
+// Release returns permit to the semaphore
+func (p *semaphorePermit) Release(ctx context.Context) error {
+	p.MarkReleased()
+	return p.semaphore.remove(ctx, p.key, p.holderID)
+}
+
+func (p *semaphorePermit) ReleaseLock() error {
+	return p.Release(context.Background())
+}
+
+// heartbeat extends lease until permit is released, permit is lost once it is reclaimed by others
+// or heartbeats keep failing until less than SafeTime of lease is left
+func (p *semaphorePermit) heartbeat() {
+	cfg := p.semaphore.cfg
+	ticker := time.NewTicker(cfg.HeartbeatPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := p.semaphore.now()
+		ctx, cancel := context.WithTimeout(p.Context(), cfg.HeartbeatPeriod)
+		extended, err := p.semaphore.extend(ctx, p.key, p.holderID, now, now.Add(cfg.LeaseDuration))
+		cancel()
+
+		switch {
+		case err == nil && extended:
+			p.lastHeartbeat = now
+		case err == nil:
+			log.Warn().Str("key", p.key).Msg("dynamodb semaphore: lease expired or permit was reclaimed, permit is lost")
+			p.MarkLost()
+			return
+		case p.Context().Err() != nil:
+			return
+		case now.Sub(p.lastHeartbeat) > cfg.LeaseDuration-cfg.SafeTime:
+			log.Warn().Err(err).Str("key", p.key).Msg("dynamodb semaphore: lease is about to expire, permit is lost")
+			p.MarkLost()
+			return
+		default:
+			log.Warn().Err(err).Str("key", p.key).Msg("dynamodb semaphore: heartbeat failed")
+		}
+	}
+}
+
+func millisAttr(t time.Time) *dynamodb_types.AttributeValueMemberN {
+	return &dynamodb_types.AttributeValueMemberN{Value: strconv.FormatInt(t.UnixMilli(), 10)}
+}
+
+func newHolderID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
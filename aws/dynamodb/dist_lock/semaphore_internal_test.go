@@ -0,0 +1,182 @@
+package dist_lock
+
+import (
+	"cirello.io/dynamolock/v2"
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodb_types "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSemaphoreTable holds single semaphore item and evaluates update expressions used by Semaphore
+type fakeSemaphoreTable struct {
+	dynamolock.DynamoDBClient
+	mu      sync.Mutex
+	exists  bool
+	version int64
+	holders map[string]int64
+}
+
+func (f *fakeSemaphoreTable) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.exists {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	holders := make(map[string]dynamodb_types.AttributeValue, len(f.holders))
+	for id, millis := range f.holders {
+		holders[id] = &dynamodb_types.AttributeValueMemberN{Value: strconv.FormatInt(millis, 10)}
+	}
+	return &dynamodb.GetItemOutput{Item: map[string]dynamodb_types.AttributeValue{
+		semaphoreAttrVersion: &dynamodb_types.AttributeValueMemberN{Value: strconv.FormatInt(f.version, 10)},
+		semaphoreAttrHolders: &dynamodb_types.AttributeValueMemberM{Value: holders},
+	}}, nil
+}
+
+func (f *fakeSemaphoreTable) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.exists {
+		return nil, &dynamodb_types.ConditionalCheckFailedException{}
+	}
+	f.exists, f.version, f.holders = true, 1, make(map[string]int64)
+	for id, millis := range params.Item[semaphoreAttrHolders].(*dynamodb_types.AttributeValueMemberM).Value {
+		f.holders[id] = number(millis)
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeSemaphoreTable) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names, values, update := params.ExpressionAttributeNames, params.ExpressionAttributeValues, *params.UpdateExpression
+	me := names["#me"]
+
+	switch {
+	case params.ConditionExpression == nil:
+	case strings.HasPrefix(*params.ConditionExpression, "#version"):
+		if f.version != number(values[":version"]) {
+			return nil, &dynamodb_types.ConditionalCheckFailedException{}
+		}
+	default:
+		if expiresAt, ok := f.holders[me]; !ok || expiresAt <= number(values[":now"]) {
+			return nil, &dynamodb_types.ConditionalCheckFailedException{}
+		}
+	}
+
+	set, remove, _ := strings.Cut(update, " REMOVE ")
+	if strings.HasPrefix(update, "REMOVE ") {
+		set, remove = "", strings.TrimPrefix(update, "REMOVE ")
+	}
+	if set != "" {
+		f.holders[me] = number(values[":expiresAt"])
+		if next, ok := values[":next"]; ok {
+			f.version = number(next)
+		} else {
+			f.version++
+		}
+	}
+	for _, name := range strings.Split(remove, ", ") {
+		if name != "" {
+			delete(f.holders, names[strings.TrimPrefix(name, "#holders.")])
+		}
+	}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func number(value dynamodb_types.AttributeValue) int64 {
+	n, _ := strconv.ParseInt(value.(*dynamodb_types.AttributeValueMemberN).Value, 10, 64)
+	return n
+}
+
+func TestNewSemaphoreValidatesPermits(t *testing.T) {
+	_, err := NewSemaphore(nil, "locks", SemaphoreConfig{})
+	assert.NotNil(t, err)
+
+	s, err := NewSemaphore(nil, "locks", SemaphoreConfig{Permits: 3, LeaseDuration: 9 * time.Second})
+	assert.Nil(t, err)
+	assert.Equal(t, 1500*time.Millisecond, s.cfg.SafeTime)
+	assert.Equal(t, DefaultHeartbeatPeriod, s.cfg.HeartbeatPeriod)
+
+	_, err = NewSemaphore(nil, "locks", SemaphoreConfig{Permits: 3, LeaseDuration: 5 * time.Second})
+	assert.NotNil(t, err)
+	assert.Equal(t, &dynamodb_types.AttributeValueMemberS{Value: "feeds#semaphore"}, s.itemKey("feeds")[LockTablePartitionKey])
+}
+
+func TestSemaphoreStateExpired(t *testing.T) {
+	now := time.Now()
+	state := &semaphoreState{holders: map[string]time.Time{
+		"b": now.Add(-time.Second),
+		"a": now,
+		"c": now.Add(time.Second),
+	}}
+	assert.Equal(t, []string{"a", "b"}, state.expired(now))
+}
+
+func TestSemaphoreHeartbeatDoesNotExtendExpiredLease(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	table := &fakeSemaphoreTable{exists: true, version: 1, holders: map[string]int64{"old": now.UnixMilli()}}
+	s, err := NewSemaphore(table, "locks", SemaphoreConfig{Permits: 1})
+	assert.Nil(t, err)
+
+	extended, err := s.extend(ctx, "feeds", "old", now, now.Add(s.cfg.LeaseDuration))
+	assert.Nil(t, err)
+	assert.False(t, extended)
+	assert.Equal(t, int64(1), table.version)
+}
+
+func TestSemaphoreReclaimRacingWithHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	table := &fakeSemaphoreTable{exists: true, version: 1, holders: map[string]int64{"old": now.UnixMilli()}}
+	s, err := NewSemaphore(table, "locks", SemaphoreConfig{Permits: 1, HeartbeatPeriod: time.Hour, LeaseDuration: 3 * time.Hour})
+	assert.Nil(t, err)
+	s.now = func() time.Time { return now }
+
+	// acquirer reads lease of old holder as expired
+	state, err := s.read(ctx, "feeds")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"old"}, state.expired(now))
+
+	// heartbeat of old holder with clock behind lands before reclaim
+	extended, err := s.extend(ctx, "feeds", "old", now.Add(-time.Second), now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.True(t, extended)
+
+	// reclaim based on stale state is refused, fresh state shows extended lease of old holder
+	stored, err := s.store(ctx, "feeds", state, "new", state.expired(now), now.Add(s.cfg.LeaseDuration))
+	assert.Nil(t, err)
+	assert.False(t, stored)
+	_, err = s.TryAcquire(ctx, "feeds")
+	assert.True(t, errors.Is(err, ErrLockNotGranted))
+	assert.Equal(t, []string{"old"}, holderIDs(table))
+
+	// once lease expires, permit is reclaimed and late heartbeat of old holder fails
+	now = now.Add(time.Minute)
+	permit, err := s.TryAcquire(ctx, "feeds")
+	assert.Nil(t, err)
+	defer permit.ReleaseLock()
+	extended, err = s.extend(ctx, "feeds", "old", now.Add(-time.Second), now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.False(t, extended)
+	holders, err := s.Holders(ctx, "feeds")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, holders)
+}
+
+func holderIDs(table *fakeSemaphoreTable) []string {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	var ids []string
+	for id := range table.holders {
+		ids = append(ids, id)
+	}
+	return ids
+}
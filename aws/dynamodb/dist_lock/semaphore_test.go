@@ -0,0 +1,52 @@
+package dist_lock_test
+
+import (
+	"context"
+	"errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/dynamodb/dist_lock"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TstSemaphoreLimitsConcurrentHolders(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	c := test.SetupLocalstack(ctx)
+	ctx = aws.SetCustomAwsEndpoint(ctx, c.URI)
+	defer c.TeardownLocalstack()
+
+	err := dist_lock.CreateLockTable(ctx, dynamoDistLockTableName, dist_lock.WithOnDemandBilling())
+	assert.Nil(t, err)
+
+	dynamodbClient, err := aws.CreateDynamodbClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+	semaphore, err := dist_lock.NewSemaphore(dynamodbClient, dynamoDistLockTableName, dist_lock.SemaphoreConfig{
+		Permits:         2,
+		LeaseDuration:   3 * time.Second,
+		HeartbeatPeriod: time.Second,
+	})
+	assert.Nil(t, err)
+
+	first, err := semaphore.TryAcquire(ctx, "feeds")
+	assert.Nil(t, err)
+	second, err := semaphore.TryAcquire(ctx, "feeds")
+	assert.Nil(t, err)
+	_, err = semaphore.TryAcquire(ctx, "feeds")
+	assert.True(t, errors.Is(err, dist_lock.ErrLockNotGranted))
+
+	// heartbeats keep permits beyond lease duration
+	time.Sleep(5 * time.Second)
+	holders, err := semaphore.Holders(ctx, "feeds")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, holders)
+
+	assert.Nil(t, first.Release(ctx))
+	third, err := semaphore.TryAcquire(ctx, "feeds")
+	assert.Nil(t, err)
+	assert.Nil(t, third.Release(ctx))
+	assert.Nil(t, second.Release(ctx))
+}
@@ -0,0 +1,191 @@
+package publisher
+
+/*
+EventBridge publisher: puts events to single event bus in PutEvents batches (up to 10 entries and 256KB per call).
+Event details are JSON encoded. Entries failed by EventBridge with throttling or internal failure are retried with
+exponential backoff, other failures (e.g. malformed detail, missing permissions) are returned without retrying.
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridge_types "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/batch"
+	"time"
+)
+
+const (
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = 100 * time.Millisecond
+
+	// MaxBatchSize is max size of PutEvents request, single event may not exceed it either
+	MaxBatchSize = 256 * 1024
+
+	eventbridgeMaxBatchEntries = 10
+	// eventTimeSize is size EventBridge counts for event time
+	eventTimeSize = 14
+)
+
+// ErrEventTooLarge is returned (wrapped) for events exceeding EventBridge size limit
+var ErrEventTooLarge = errors.New("event too large")
+
+// retryableErrorCodes are PutEvents entry error codes worth retrying
+var retryableErrorCodes = map[string]bool{
+	"InternalFailure":     true,
+	"ThrottlingException": true,
+}
+
+// Client is subset of *eventbridge.Client used by publisher
+type Client interface {
+	PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// Event is event to be published
+type Event struct {
+	// Source overrides Config.Source
+	Source     string
+	DetailType string
+	// Detail is JSON encoded, use json.RawMessage for already encoded details
+	Detail    any
+	Resources []string
+	// Time is set by EventBridge when zero
+	Time time.Time
+}
+
+// Config configures publisher, zero values are replaced with defaults
+type Config struct {
+	// EventBusName is name or ARN of event bus, default event bus is used when empty
+	EventBusName string
+	// Source is source of published events, e.g. "hrnogomet.matches"
+	Source string
+	// MaxRetries is max number of retries of failed entries, negative value disables retries
+	MaxRetries int
+	// RetryBackoff is delay before first retry, it doubles with every further retry
+	RetryBackoff time.Duration
+}
+
+// Publisher publishes events to single event bus
+type Publisher struct {
+	client Client
+	cfg    Config
+}
+
+// New creates publisher, use aws.CreateEventBridgeClient to create the client
+func New(client Client, cfg Config) (*Publisher, error) {
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	return &Publisher{client: client, cfg: cfg}, nil
+}
+
+// Publish publishes events and returns their EventBridge IDs, IDs of failed events are empty.
+// Returned error joins errors of all failed events.
+func (p *Publisher) Publish(ctx context.Context, events ...Event) ([]string, error) {
+	ids := make([]string, len(events))
+	errs := make([]error, len(events))
+
+	entries := make([]eventbridge_types.PutEventsRequestEntry, len(events))
+	sizes := make([]int, len(events))
+	var batch []int
+	batchSize := 0
+	for i, e := range events {
+		entry, size, err := p.prepare(e)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		entries[i], sizes[i] = *entry, size
+
+		if len(batch) == eventbridgeMaxBatchEntries || batchSize+size > MaxBatchSize {
+			p.putEvents(ctx, entries, batch, ids, errs)
+			batch, batchSize = nil, 0
+		}
+		batch = append(batch, i)
+		batchSize += size
+	}
+	if len(batch) > 0 {
+		p.putEvents(ctx, entries, batch, ids, errs)
+	}
+	return ids, errors.Join(errs...)
+}
+
+// putEvents puts entries with given indexes retrying failed ones, results are stored into ids and errs
+func (p *Publisher) putEvents(ctx context.Context, entries []eventbridge_types.PutEventsRequestEntry, indexes []int, ids []string, errs []error) {
+	policy := batch.Policy{MaxRetries: p.cfg.MaxRetries, Backoff: p.cfg.RetryBackoff, Operation: "publish event"}
+	batch.Send(ctx, policy, indexes, func(ctx context.Context, indexes []int) (map[int]batch.Result, error) {
+		requestEntries := make([]eventbridge_types.PutEventsRequestEntry, len(indexes))
+		for i, index := range indexes {
+			requestEntries[i] = entries[index]
+		}
+
+		out, err := p.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: requestEntries})
+		if err != nil {
+			return nil, err
+		}
+
+		// result entries have the same order as request entries
+		results := make(map[int]batch.Result, len(indexes))
+		for i, index := range indexes {
+			if i >= len(out.Entries) {
+				break
+			}
+			result := out.Entries[i]
+			if code := aws_sdk.ToString(result.ErrorCode); code == "" {
+				results[index] = batch.Result{ID: aws_sdk.ToString(result.EventId)}
+			} else if failedErr := fmt.Errorf("%s: %s", code, aws_sdk.ToString(result.ErrorMessage)); retryableErrorCodes[code] {
+				results[index] = batch.Result{Err: failedErr, Retry: true}
+			} else {
+				results[index] = batch.Result{Err: fmt.Errorf("eventbridge rejected event: %w", failedErr)}
+			}
+		}
+		return results, nil
+	}, ids, errs)
+}
+
+// prepare validates event and builds request entry, returned size is entry size as counted by EventBridge
+func (p *Publisher) prepare(e Event) (*eventbridge_types.PutEventsRequestEntry, int, error) {
+	source := e.Source
+	if source == "" {
+		source = p.cfg.Source
+	}
+	if source == "" || e.DetailType == "" {
+		return nil, 0, errors.New("publisher: event source and detail type must be set")
+	}
+
+	detail, err := json.Marshal(e.Detail)
+	if err != nil {
+		return nil, 0, fmt.Errorf("cannot encode detail of %s event: %w", e.DetailType, err)
+	}
+
+	entry := &eventbridge_types.PutEventsRequestEntry{
+		Source:     aws_sdk.String(source),
+		DetailType: aws_sdk.String(e.DetailType),
+		Detail:     aws_sdk.String(string(detail)),
+		Resources:  e.Resources,
+	}
+	if p.cfg.EventBusName != "" {
+		entry.EventBusName = aws_sdk.String(p.cfg.EventBusName)
+	}
+
+	size := len(source) + len(e.DetailType) + len(detail)
+	for _, resource := range e.Resources {
+		size += len(resource)
+	}
+	if !e.Time.IsZero() {
+		entry.Time = aws_sdk.Time(e.Time)
+		size += eventTimeSize
+	}
+	if size > MaxBatchSize {
+		return nil, 0, fmt.Errorf("%w: %d bytes", ErrEventTooLarge, size)
+	}
+	return entry, size, nil
+}
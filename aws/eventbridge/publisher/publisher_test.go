@@ -0,0 +1,138 @@
+package publisher_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridge_types "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/eventbridge/publisher"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBus accepts events, rejected details fail permanently and throttled ones fail once
+type fakeBus struct {
+	mu        sync.Mutex
+	batches   [][]eventbridge_types.PutEventsRequestEntry
+	throttled map[string]bool
+	rejected  map[string]bool
+}
+
+func (b *fakeBus) PutEvents(_ context.Context, params *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, params.Entries)
+
+	out := &eventbridge.PutEventsOutput{}
+	for _, entry := range params.Entries {
+		detail := aws_sdk.ToString(entry.Detail)
+		switch {
+		case b.rejected[detail]:
+			out.Entries = append(out.Entries, eventbridge_types.PutEventsResultEntry{ErrorCode: aws_sdk.String("MalformedDetail")})
+			out.FailedEntryCount++
+		case b.throttled[detail]:
+			delete(b.throttled, detail)
+			out.Entries = append(out.Entries, eventbridge_types.PutEventsResultEntry{ErrorCode: aws_sdk.String("ThrottlingException")})
+			out.FailedEntryCount++
+		default:
+			out.Entries = append(out.Entries, eventbridge_types.PutEventsResultEntry{EventId: aws_sdk.String("id-" + detail)})
+		}
+	}
+	return out, nil
+}
+
+type matchStarted struct {
+	MatchID int `json:"matchId"`
+}
+
+func TestPublishBatchesAndRetries(t *testing.T) {
+	bus := &fakeBus{throttled: map[string]bool{`{"matchId":3}`: true}, rejected: map[string]bool{`{"matchId":7}`: true}}
+	p, err := publisher.New(bus, publisher.Config{EventBusName: "matches", Source: "hrnogomet.matches", RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+
+	events := make([]publisher.Event, 12)
+	for i := range events {
+		events[i] = publisher.Event{DetailType: "MatchStarted", Detail: matchStarted{MatchID: i}}
+	}
+	ids, err := p.Publish(context.Background(), events...)
+	assert.NotNil(t, err)
+	assert.Equal(t, `id-{"matchId":0}`, ids[0])
+	assert.Equal(t, `id-{"matchId":3}`, ids[3])
+	assert.Equal(t, "", ids[7])
+	assert.Equal(t, `id-{"matchId":11}`, ids[11])
+	// 10 + 2 events and retry of throttled one
+	assert.Len(t, bus.batches, 3)
+	assert.Len(t, bus.batches[0], 10)
+	assert.Len(t, bus.batches[1], 1)
+	assert.Equal(t, "matches", aws_sdk.ToString(bus.batches[0][0].EventBusName))
+	assert.Equal(t, "hrnogomet.matches", aws_sdk.ToString(bus.batches[0][0].Source))
+}
+
+func TestPublishSplitsBatchesBySize(t *testing.T) {
+	bus := &fakeBus{}
+	p, err := publisher.New(bus, publisher.Config{Source: "hrnogomet.matches"})
+	assert.Nil(t, err)
+
+	large := json.RawMessage(`"` + strings.Repeat("x", publisher.MaxBatchSize/2) + `"`)
+	_, err = p.Publish(context.Background(),
+		publisher.Event{DetailType: "Report", Detail: large},
+		publisher.Event{DetailType: "Report", Detail: large},
+		publisher.Event{DetailType: "Report", Detail: json.RawMessage(`"` + strings.Repeat("x", publisher.MaxBatchSize) + `"`)},
+		publisher.Event{Detail: "missing detail type"},
+	)
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, publisher.ErrEventTooLarge))
+	assert.Len(t, bus.batches, 2)
+}
+
+func TstPublishToQueue(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	c := test.SetupLocalstack(ctx)
+	ctx = aws.SetCustomAwsEndpoint(ctx, c.URI)
+	defer c.TeardownLocalstack()
+
+	queueURL, queueARN, err := c.CreateSqsQueue(ctx, "matches")
+	assert.Nil(t, err)
+	client, err := aws.CreateEventBridgeClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+	_, err = client.PutRule(ctx, &eventbridge.PutRuleInput{
+		Name:         aws_sdk.String("matches"),
+		EventPattern: aws_sdk.String(`{"source": ["hrnogomet.matches"]}`),
+	})
+	assert.Nil(t, err)
+	_, err = client.PutTargets(ctx, &eventbridge.PutTargetsInput{
+		Rule:    aws_sdk.String("matches"),
+		Targets: []eventbridge_types.Target{{Id: aws_sdk.String("queue"), Arn: aws_sdk.String(queueARN)}},
+	})
+	assert.Nil(t, err)
+
+	p, err := publisher.New(client, publisher.Config{Source: "hrnogomet.matches"})
+	assert.Nil(t, err)
+	ids, err := p.Publish(ctx, publisher.Event{DetailType: "MatchStarted", Detail: matchStarted{MatchID: 1}})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, ids[0])
+
+	sqsClient, err := aws.CreateSqsClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+	out, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws_sdk.String(queueURL), WaitTimeSeconds: 10})
+	assert.Nil(t, err)
+	assert.Len(t, out.Messages, 1)
+
+	var event struct {
+		DetailType string       `json:"detail-type"`
+		Detail     matchStarted `json:"detail"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(aws_sdk.ToString(out.Messages[0].Body)), &event))
+	assert.Equal(t, "MatchStarted", event.DetailType)
+	assert.Equal(t, 1, event.Detail.MatchID)
+}
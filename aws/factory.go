@@ -0,0 +1,284 @@
+package aws
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// factoryOptions are options Factory is built from
+type factoryOptions struct {
+	region           string
+	profile          string
+	roles            []AssumeRole
+	endpoint         string
+	serviceEndpoints map[string]string
+	s3PathStyle      *bool
+	maxRetries       *int
+	timeout          time.Duration
+	connectTimeout   time.Duration
+}
+
+// FactoryOption configures Factory
+type FactoryOption func(o *factoryOptions)
+
+// WithRegion sets AWS region, region from environment or shared config is used by default
+func WithRegion(region string) FactoryOption {
+	return func(o *factoryOptions) { o.region = region }
+}
+
+// WithProfile sets shared config profile
+func WithProfile(profile string) FactoryOption {
+	return func(o *factoryOptions) { o.profile = profile }
+}
+
+// WithAssumeRole makes clients use credentials of given role assumed with the loaded credentials,
+// see WithRole for further assume role options
+func WithAssumeRole(roleARN string) FactoryOption {
+	return WithRole(AssumeRole{RoleARN: roleARN})
+}
+
+// WithEndpoint sends requests of all clients to custom endpoint (e.g. localstack), see also SetCustomAwsEndpoint.
+// Endpoints can be configured also by AWS_ENDPOINT_URL and AWS_ENDPOINT_URL_<SERVICE> environment variables
+// (e.g. AWS_ENDPOINT_URL_DYNAMODB), service specific variable takes precedence over this option.
+func WithEndpoint(endpoint string) FactoryOption {
+	return func(o *factoryOptions) { o.endpoint = endpoint }
+}
+
+// WithServiceEndpoint sends requests of clients of given service to custom endpoint (e.g. DynamoDB Local),
+// it takes precedence over WithEndpoint and environment variables. Service is SDK service ID
+// (e.g. dynamodb.ServiceID) or its environment variable form (e.g. "SECRETS_MANAGER").
+func WithServiceEndpoint(service string, endpoint string) FactoryOption {
+	return func(o *factoryOptions) {
+		if o.serviceEndpoints == nil {
+			o.serviceEndpoints = make(map[string]string)
+		}
+		o.serviceEndpoints[normalizeServiceID(service)] = endpoint
+	}
+}
+
+// WithS3PathStyle sets path-style addressing of S3 buckets, by default it is used when S3 endpoint is overridden
+func WithS3PathStyle(pathStyle bool) FactoryOption {
+	return func(o *factoryOptions) { o.s3PathStyle = &pathStyle }
+}
+
+// WithMaxRetries sets max number of retries of failed requests, 0 disables retries
+func WithMaxRetries(maxRetries int) FactoryOption {
+	return func(o *factoryOptions) { o.maxRetries = &maxRetries }
+}
+
+// WithTimeout sets timeout of single HTTP request attempt (including reading response body)
+func WithTimeout(timeout time.Duration) FactoryOption {
+	return func(o *factoryOptions) { o.timeout = timeout }
+}
+
+// WithConnectTimeout sets timeout of establishing connections
+func WithConnectTimeout(timeout time.Duration) FactoryOption {
+	return func(o *factoryOptions) { o.connectTimeout = timeout }
+}
+
+// lazyClient creates client on first use
+type lazyClient[T any] struct {
+	once   sync.Once
+	client T
+}
+
+func (l *lazyClient[T]) get(create func() T) T {
+	l.once.Do(func() { l.client = create() })
+	return l.client
+}
+
+// Factory loads aws config once and creates clients sharing it, clients are created on first use and reused.
+// Factory is safe for concurrent use.
+type Factory struct {
+	config           aws.Config
+	serviceEndpoints map[string]string
+	s3PathStyle      *bool
+
+	// mu guards assumed, factories created by Assume
+	mu      sync.Mutex
+	assumed map[string]*Factory
+
+	dynamodb       lazyClient[*dynamodb.Client]
+	sqs            lazyClient[*sqs.Client]
+	sns            lazyClient[*sns.Client]
+	s3             lazyClient[*s3.Client]
+	cloudWatch     lazyClient[*cloudwatch.Client]
+	secretsManager lazyClient[*secretsmanager.Client]
+	ssm            lazyClient[*ssm.Client]
+	sts            lazyClient[*sts.Client]
+	eventBridge    lazyClient[*eventbridge.Client]
+	scheduler      lazyClient[*scheduler.Client]
+}
+
+// NewFactory loads aws config (default credential chain) with given options
+func NewFactory(ctx context.Context, opts ...FactoryOption) (*Factory, error) {
+	var o factoryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var loadOptions []func(*config.LoadOptions) error
+	if o.region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(o.region))
+	}
+	if o.profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(o.profile))
+	}
+	if o.maxRetries != nil {
+		// max attempts include the first attempt
+		loadOptions = append(loadOptions, config.WithRetryMaxAttempts(*o.maxRetries+1))
+	}
+	if o.timeout > 0 || o.connectTimeout > 0 {
+		httpClient := awshttp.NewBuildableClient()
+		if o.timeout > 0 {
+			httpClient = httpClient.WithTimeout(o.timeout)
+		}
+		if o.connectTimeout > 0 {
+			httpClient = httpClient.WithDialerOptions(func(d *net.Dialer) { d.Timeout = o.connectTimeout })
+		}
+		loadOptions = append(loadOptions, config.WithHTTPClient(httpClient))
+	}
+
+	awsConfig, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if o.endpoint != "" {
+		awsConfig.BaseEndpoint = aws.String(o.endpoint)
+	}
+	f := &Factory{config: awsConfig, serviceEndpoints: o.serviceEndpoints, s3PathStyle: o.s3PathStyle}
+	for _, role := range o.roles {
+		f.config.Credentials = f.assumeRoleCredentials(f.config, role)
+	}
+	return f, nil
+}
+
+// normalizeServiceID converts SDK service ID to the form used in AWS_ENDPOINT_URL_<SERVICE> variables
+func normalizeServiceID(serviceID string) string {
+	return strings.ToUpper(strings.ReplaceAll(serviceID, " ", "_"))
+}
+
+// baseEndpoint returns endpoint of given service, endpoint resolved by the SDK (from config or environment) is
+// returned unless it is overridden by WithServiceEndpoint
+func (f *Factory) baseEndpoint(serviceID string, resolved *string) *string {
+	if endpoint, ok := f.serviceEndpoints[normalizeServiceID(serviceID)]; ok {
+		return aws.String(endpoint)
+	}
+	return resolved
+}
+
+// Config returns copy of loaded aws config, use it for clients of services without Factory method
+func (f *Factory) Config() aws.Config {
+	return f.config.Copy()
+}
+
+// DynamoDB returns DynamoDB client
+func (f *Factory) DynamoDB() *dynamodb.Client {
+	return f.dynamodb.get(func() *dynamodb.Client {
+		return dynamodb.NewFromConfig(f.config, func(o *dynamodb.Options) {
+			o.BaseEndpoint = f.baseEndpoint(dynamodb.ServiceID, o.BaseEndpoint)
+		})
+	})
+}
+
+// SQS returns SQS client
+func (f *Factory) SQS() *sqs.Client {
+	return f.sqs.get(func() *sqs.Client {
+		return sqs.NewFromConfig(f.config, func(o *sqs.Options) {
+			o.BaseEndpoint = f.baseEndpoint(sqs.ServiceID, o.BaseEndpoint)
+		})
+	})
+}
+
+// SNS returns SNS client
+func (f *Factory) SNS() *sns.Client {
+	return f.sns.get(func() *sns.Client {
+		return sns.NewFromConfig(f.config, func(o *sns.Options) {
+			o.BaseEndpoint = f.baseEndpoint(sns.ServiceID, o.BaseEndpoint)
+		})
+	})
+}
+
+// S3 returns S3 client, path-style addressing is used with custom endpoint (localstack) unless set by WithS3PathStyle
+func (f *Factory) S3() *s3.Client {
+	return f.s3.get(func() *s3.Client {
+		return s3.NewFromConfig(f.config, func(o *s3.Options) {
+			o.BaseEndpoint = f.baseEndpoint(s3.ServiceID, o.BaseEndpoint)
+			if f.s3PathStyle != nil {
+				o.UsePathStyle = *f.s3PathStyle
+			} else {
+				o.UsePathStyle = o.BaseEndpoint != nil
+			}
+		})
+	})
+}
+
+// CloudWatch returns CloudWatch client
+func (f *Factory) CloudWatch() *cloudwatch.Client {
+	return f.cloudWatch.get(func() *cloudwatch.Client {
+		return cloudwatch.NewFromConfig(f.config, func(o *cloudwatch.Options) {
+			o.BaseEndpoint = f.baseEndpoint(cloudwatch.ServiceID, o.BaseEndpoint)
+		})
+	})
+}
+
+// SecretsManager returns Secrets Manager client
+func (f *Factory) SecretsManager() *secretsmanager.Client {
+	return f.secretsManager.get(func() *secretsmanager.Client {
+		return secretsmanager.NewFromConfig(f.config, func(o *secretsmanager.Options) {
+			o.BaseEndpoint = f.baseEndpoint(secretsmanager.ServiceID, o.BaseEndpoint)
+		})
+	})
+}
+
+// SSM returns Systems Manager (e.g. Parameter Store) client
+func (f *Factory) SSM() *ssm.Client {
+	return f.ssm.get(func() *ssm.Client {
+		return ssm.NewFromConfig(f.config, func(o *ssm.Options) {
+			o.BaseEndpoint = f.baseEndpoint(ssm.ServiceID, o.BaseEndpoint)
+		})
+	})
+}
+
+// STS returns STS client
+func (f *Factory) STS() *sts.Client {
+	return f.sts.get(func() *sts.Client {
+		return sts.NewFromConfig(f.config, func(o *sts.Options) {
+			o.BaseEndpoint = f.baseEndpoint(sts.ServiceID, o.BaseEndpoint)
+		})
+	})
+}
+
+// EventBridge returns EventBridge client
+func (f *Factory) EventBridge() *eventbridge.Client {
+	return f.eventBridge.get(func() *eventbridge.Client {
+		return eventbridge.NewFromConfig(f.config, func(o *eventbridge.Options) {
+			o.BaseEndpoint = f.baseEndpoint(eventbridge.ServiceID, o.BaseEndpoint)
+		})
+	})
+}
+
+// Scheduler returns EventBridge Scheduler client
+func (f *Factory) Scheduler() *scheduler.Client {
+	return f.scheduler.get(func() *scheduler.Client {
+		return scheduler.NewFromConfig(f.config, func(o *scheduler.Options) {
+			o.BaseEndpoint = f.baseEndpoint(scheduler.ServiceID, o.BaseEndpoint)
+		})
+	})
+}
@@ -0,0 +1,100 @@
+package aws_test
+
+import (
+	"context"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFactoryAppliesOptions(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	factory, err := aws.NewFactory(ctx,
+		aws.WithRegion(constants.AwsDefaultRegion),
+		aws.WithEndpoint(server.URL),
+		aws.WithMaxRetries(2),
+		aws.WithTimeout(5*time.Second),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, constants.AwsDefaultRegion, factory.Config().Region)
+	assert.Equal(t, 3, factory.Config().RetryMaxAttempts)
+	assert.Same(t, factory.SQS(), factory.SQS())
+
+	_, err = factory.SQS().ListQueues(ctx, &sqs.ListQueuesInput{}, func(o *sqs.Options) {
+		o.Retryer = retry.AddWithMaxBackoffDelay(o.Retryer, time.Millisecond)
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+// recordingServer records paths of requests it receives and fails them
+type recordingServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	paths []string
+}
+
+func newRecordingServer() *recordingServer {
+	s := &recordingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.paths = append(s.paths, r.URL.Path)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	return s
+}
+
+func TestFactoryResolvesServiceEndpoints(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	localstack, dynamodbLocal, snsEnv := newRecordingServer(), newRecordingServer(), newRecordingServer()
+	defer localstack.Close()
+	defer dynamodbLocal.Close()
+	defer snsEnv.Close()
+	t.Setenv("AWS_ENDPOINT_URL_SNS", snsEnv.URL)
+
+	ctx := context.Background()
+	factory, err := aws.NewFactory(ctx,
+		aws.WithRegion(constants.AwsDefaultRegion),
+		aws.WithEndpoint(localstack.URL),
+		aws.WithServiceEndpoint(dynamodb.ServiceID, dynamodbLocal.URL),
+		aws.WithMaxRetries(0),
+	)
+	assert.Nil(t, err)
+
+	_, err = factory.SQS().ListQueues(ctx, &sqs.ListQueuesInput{})
+	assert.NotNil(t, err)
+	_, err = factory.S3().ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws_sdk.String("reports")})
+	assert.NotNil(t, err)
+	_, err = factory.DynamoDB().ListTables(ctx, &dynamodb.ListTablesInput{})
+	assert.NotNil(t, err)
+	_, err = factory.SNS().ListTopics(ctx, &sns.ListTopicsInput{})
+	assert.NotNil(t, err)
+
+	assert.Equal(t, []string{"/", "/reports"}, localstack.paths)
+	assert.Len(t, dynamodbLocal.paths, 1)
+	assert.Len(t, snsEnv.paths, 1)
+}
@@ -0,0 +1,127 @@
+package scheduler
+
+/*
+One-off EventBridge Scheduler schedules delivering payload to SQS queue at given time, e.g. for delayed jobs
+exceeding SQS max delay of 15 minutes. Schedules are deleted by EventBridge Scheduler after they run.
+Scheduler needs IAM role it assumes to send messages to the queue (sqs:SendMessage on the queue).
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	scheduler_types "github.com/aws/aws-sdk-go-v2/service/scheduler/types"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	// atExpressionLayout is layout of time in one-time schedule expression at(yyyy-mm-ddThh:mm:ss)
+	atExpressionLayout = "2006-01-02T15:04:05"
+	// maxNameLength is max length of schedule name
+	maxNameLength = 64
+)
+
+// Client is subset of *scheduler.Client used by Scheduler
+type Client interface {
+	CreateSchedule(ctx context.Context, params *scheduler.CreateScheduleInput, optFns ...func(*scheduler.Options)) (*scheduler.CreateScheduleOutput, error)
+	DeleteSchedule(ctx context.Context, params *scheduler.DeleteScheduleInput, optFns ...func(*scheduler.Options)) (*scheduler.DeleteScheduleOutput, error)
+}
+
+// Config configures Scheduler
+type Config struct {
+	// GroupName is schedule group of created schedules, default group is used when empty
+	GroupName string
+	// RoleARN is ARN of IAM role assumed by EventBridge Scheduler to deliver payloads
+	RoleARN string
+	// DeadLetterQueueARN receives payloads which cannot be delivered, optional
+	DeadLetterQueueARN string
+}
+
+// Schedule is one-off delivery of payload to SQS queue
+type Schedule struct {
+	// Name identifies schedule within group (max 64 characters), random name is generated when empty.
+	// Creating schedule with name of existing schedule fails, so the name can be used for deduplication.
+	Name     string
+	QueueARN string
+	Payload  string
+	// At is delivery time, it is truncated to seconds
+	At time.Time
+	// GroupID is message group ID, required for FIFO queues
+	GroupID string
+}
+
+// Scheduler creates one-off schedules
+type Scheduler struct {
+	client Client
+	cfg    Config
+}
+
+// New creates Scheduler, use aws.CreateSchedulerClient to create the client
+func New(client Client, cfg Config) (*Scheduler, error) {
+	if cfg.RoleARN == "" {
+		return nil, errors.New("scheduler: role arn must be set")
+	}
+	return &Scheduler{client: client, cfg: cfg}, nil
+}
+
+// ScheduleMessage creates schedule delivering payload to queue at given time and returns name of the schedule
+func (s *Scheduler) ScheduleMessage(ctx context.Context, schedule Schedule) (string, error) {
+	if schedule.QueueARN == "" {
+		return "", errors.New("scheduler: queue arn must be set")
+	}
+	name := schedule.Name
+	if name == "" {
+		name = uuid.NewString()
+	} else if len(name) > maxNameLength {
+		return "", fmt.Errorf("scheduler: schedule name %s is longer than %d characters", name, maxNameLength)
+	}
+
+	target := &scheduler_types.Target{
+		Arn:     aws_sdk.String(schedule.QueueARN),
+		RoleArn: aws_sdk.String(s.cfg.RoleARN),
+		Input:   aws_sdk.String(schedule.Payload),
+	}
+	if schedule.GroupID != "" {
+		target.SqsParameters = &scheduler_types.SqsParameters{MessageGroupId: aws_sdk.String(schedule.GroupID)}
+	}
+	if s.cfg.DeadLetterQueueARN != "" {
+		target.DeadLetterConfig = &scheduler_types.DeadLetterConfig{Arn: aws_sdk.String(s.cfg.DeadLetterQueueARN)}
+	}
+
+	_, err := s.client.CreateSchedule(ctx, &scheduler.CreateScheduleInput{
+		Name:                       aws_sdk.String(name),
+		GroupName:                  s.groupName(),
+		ScheduleExpression:         aws_sdk.String("at(" + schedule.At.UTC().Format(atExpressionLayout) + ")"),
+		ScheduleExpressionTimezone: aws_sdk.String("UTC"),
+		FlexibleTimeWindow:         &scheduler_types.FlexibleTimeWindow{Mode: scheduler_types.FlexibleTimeWindowModeOff},
+		ActionAfterCompletion:      scheduler_types.ActionAfterCompletionDelete,
+		Target:                     target,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot create schedule %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// Cancel deletes schedule which has not run yet, cancelling already deleted schedule is not an error
+func (s *Scheduler) Cancel(ctx context.Context, name string) error {
+	_, err := s.client.DeleteSchedule(ctx, &scheduler.DeleteScheduleInput{
+		Name:      aws_sdk.String(name),
+		GroupName: s.groupName(),
+	})
+	var notFound *scheduler_types.ResourceNotFoundException
+	if err != nil && !errors.As(err, &notFound) {
+		return fmt.Errorf("cannot delete schedule %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *Scheduler) groupName() *string {
+	if s.cfg.GroupName == "" {
+		return nil
+	}
+	return aws_sdk.String(s.cfg.GroupName)
+}
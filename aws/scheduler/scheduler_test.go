@@ -0,0 +1,84 @@
+package scheduler_test
+
+import (
+	"context"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	sdk_scheduler "github.com/aws/aws-sdk-go-v2/service/scheduler"
+	scheduler_types "github.com/aws/aws-sdk-go-v2/service/scheduler/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/scheduler"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// fakeClient records created schedules
+type fakeClient struct {
+	created []*sdk_scheduler.CreateScheduleInput
+}
+
+func (f *fakeClient) CreateSchedule(_ context.Context, params *sdk_scheduler.CreateScheduleInput, _ ...func(*sdk_scheduler.Options)) (*sdk_scheduler.CreateScheduleOutput, error) {
+	f.created = append(f.created, params)
+	return &sdk_scheduler.CreateScheduleOutput{ScheduleArn: aws_sdk.String("arn")}, nil
+}
+
+func (f *fakeClient) DeleteSchedule(context.Context, *sdk_scheduler.DeleteScheduleInput, ...func(*sdk_scheduler.Options)) (*sdk_scheduler.DeleteScheduleOutput, error) {
+	return nil, &scheduler_types.ResourceNotFoundException{Message: aws_sdk.String("not found")}
+}
+
+func TestScheduleMessage(t *testing.T) {
+	client := &fakeClient{}
+	s, err := scheduler.New(client, scheduler.Config{GroupName: "jobs", RoleARN: "role"})
+	assert.Nil(t, err)
+
+	at := time.Date(2024, 3, 1, 20, 45, 0, 0, time.FixedZone("CET", 3600))
+	name, err := s.ScheduleMessage(context.Background(), scheduler.Schedule{
+		Name:     "match-1-reminder",
+		QueueARN: "arn:aws:sqs:eu-central-1:000000000000:jobs.fifo",
+		Payload:  `{"matchId": 1}`,
+		At:       at,
+		GroupID:  "match-1",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "match-1-reminder", name)
+
+	created := client.created[0]
+	assert.Equal(t, "at(2024-03-01T19:45:00)", aws_sdk.ToString(created.ScheduleExpression))
+	assert.Equal(t, "jobs", aws_sdk.ToString(created.GroupName))
+	assert.Equal(t, scheduler_types.ActionAfterCompletionDelete, created.ActionAfterCompletion)
+	assert.Equal(t, `{"matchId": 1}`, aws_sdk.ToString(created.Target.Input))
+	assert.Equal(t, "match-1", aws_sdk.ToString(created.Target.SqsParameters.MessageGroupId))
+
+	name, err = s.ScheduleMessage(context.Background(), scheduler.Schedule{QueueARN: "queue", At: at})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, name)
+	assert.Nil(t, client.created[1].Target.SqsParameters)
+
+	assert.Nil(t, s.Cancel(context.Background(), "match-1-reminder"))
+}
+
+func TstScheduleMessage(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	c := test.SetupLocalstack(ctx)
+	ctx = aws.SetCustomAwsEndpoint(ctx, c.URI)
+	defer c.TeardownLocalstack()
+
+	_, queueARN, err := c.CreateSqsQueue(ctx, "jobs")
+	assert.Nil(t, err)
+	client, err := aws.CreateSchedulerClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+	s, err := scheduler.New(client, scheduler.Config{RoleARN: "arn:aws:iam::000000000000:role/scheduler"})
+	assert.Nil(t, err)
+
+	name, err := s.ScheduleMessage(ctx, scheduler.Schedule{QueueARN: queueARN, Payload: `{"matchId": 1}`, At: time.Now().Add(time.Hour)})
+	assert.Nil(t, err)
+	schedule, err := client.GetSchedule(ctx, &sdk_scheduler.GetScheduleInput{Name: aws_sdk.String(name)})
+	assert.Nil(t, err)
+	assert.Equal(t, queueARN, aws_sdk.ToString(schedule.Target.Arn))
+
+	assert.Nil(t, s.Cancel(ctx, name))
+	assert.Nil(t, s.Cancel(ctx, name))
+}
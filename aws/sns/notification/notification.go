@@ -0,0 +1,82 @@
+package notification
+
+/*
+SNS delivers messages to subscribed SQS queues either raw (message body and attributes are passed as they are)
+or wrapped in JSON notification (default). Unwrap turns notification back into original message so that
+handlers work the same way regardless of subscription settings, see also consumer.Config.UnwrapSNS.
+*/
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"time"
+)
+
+const (
+	// AttributeTopicARN is message attribute holding ARN of topic unwrapped notification was published to
+	AttributeTopicARN = "SnsTopicArn"
+
+	typeNotification = "Notification"
+)
+
+// Attribute is message attribute in SNS notification
+type Attribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+// Notification is SNS notification delivered to SQS queue without raw message delivery
+type Notification struct {
+	Type              string               `json:"Type"`
+	MessageID         string               `json:"MessageId"`
+	TopicARN          string               `json:"TopicArn"`
+	Subject           string               `json:"Subject,omitempty"`
+	Message           string               `json:"Message"`
+	Timestamp         time.Time            `json:"Timestamp"`
+	MessageAttributes map[string]Attribute `json:"MessageAttributes,omitempty"`
+}
+
+// Parse returns notification carried by message body, false is returned for other (e.g. raw delivered) messages
+func Parse(body string) (*Notification, bool) {
+	var n Notification
+	if err := json.Unmarshal([]byte(body), &n); err != nil || n.Type != typeNotification || n.TopicARN == "" {
+		return nil, false
+	}
+	return &n, true
+}
+
+// Unwrap replaces body of message carrying SNS notification with published message and adds published message
+// attributes (unless message already has attribute of the same name) and AttributeTopicARN.
+// Other messages are left untouched, returned bool reports whether message was unwrapped.
+func Unwrap(m *sqs_types.Message) (bool, error) {
+	n, ok := Parse(aws_sdk.ToString(m.Body))
+	if !ok {
+		return false, nil
+	}
+
+	attributes := make(map[string]sqs_types.MessageAttributeValue, len(m.MessageAttributes)+len(n.MessageAttributes)+1)
+	for name, attr := range n.MessageAttributes {
+		value := sqs_types.MessageAttributeValue{DataType: aws_sdk.String(attr.Type)}
+		if attr.Type == "Binary" {
+			data, err := base64.StdEncoding.DecodeString(attr.Value)
+			if err != nil {
+				return false, fmt.Errorf("invalid binary attribute %s of notification %s: %w", name, n.MessageID, err)
+			}
+			value.BinaryValue = data
+		} else {
+			value.StringValue = aws_sdk.String(attr.Value)
+		}
+		attributes[name] = value
+	}
+	attributes[AttributeTopicARN] = sqs_types.MessageAttributeValue{DataType: aws_sdk.String("String"), StringValue: aws_sdk.String(n.TopicARN)}
+	for name, attr := range m.MessageAttributes {
+		attributes[name] = attr
+	}
+
+	m.Body = aws_sdk.String(n.Message)
+	m.MessageAttributes = attributes
+	return true, nil
+}
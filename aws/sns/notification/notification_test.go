@@ -0,0 +1,37 @@
+package notification_test
+
+import (
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sns/notification"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnwrapNotification(t *testing.T) {
+	m := &sqs_types.Message{
+		Body: aws_sdk.String(`{"Type":"Notification","MessageId":"n1","TopicArn":"arn:aws:sns:eu-central-1:000000000000:matches",` +
+			`"Message":"{\"id\":1}","Timestamp":"2024-01-01T10:00:00Z","MessageAttributes":{` +
+			`"RequestID":{"Type":"String","Value":"r1"},"Checksum":{"Type":"Binary","Value":"AQI="}}}`),
+		MessageAttributes: map[string]sqs_types.MessageAttributeValue{
+			"RequestID": {DataType: aws_sdk.String("String"), StringValue: aws_sdk.String("sqs")},
+		},
+	}
+
+	unwrapped, err := notification.Unwrap(m)
+	assert.Nil(t, err)
+	assert.True(t, unwrapped)
+	assert.Equal(t, `{"id":1}`, aws_sdk.ToString(m.Body))
+	assert.Equal(t, "sqs", aws_sdk.ToString(m.MessageAttributes["RequestID"].StringValue))
+	assert.Equal(t, []byte{1, 2}, m.MessageAttributes["Checksum"].BinaryValue)
+	assert.Equal(t, "arn:aws:sns:eu-central-1:000000000000:matches", aws_sdk.ToString(m.MessageAttributes[notification.AttributeTopicARN].StringValue))
+}
+
+func TestUnwrapLeavesRawMessage(t *testing.T) {
+	m := &sqs_types.Message{Body: aws_sdk.String(`{"Type":"Notification","Message":"not from sns"}`)}
+	unwrapped, err := notification.Unwrap(m)
+	assert.Nil(t, err)
+	assert.False(t, unwrapped)
+	assert.Equal(t, `{"Type":"Notification","Message":"not from sns"}`, aws_sdk.ToString(m.Body))
+	assert.Nil(t, m.MessageAttributes)
+}
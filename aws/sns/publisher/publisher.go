@@ -0,0 +1,237 @@
+package publisher
+
+/*
+SNS publisher: publishes single messages or batches (PublishBatch, up to 10 messages and 256KB per call) to single topic.
+Batch entries failed by SNS are retried with exponential backoff unless SNS reports the failure as caused
+by the sender. Messages of the same group of FIFO topic are published in separate calls so that retries cannot
+reorder them (see batch package). Subscribed SQS queues receive messages either raw or wrapped in SNS notification,
+see notification package for unwrapping them on consumer side.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	sns_types "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/batch"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/consumer"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = 100 * time.Millisecond
+
+	// MaxMessageSize is max size of SNS message including message attributes
+	MaxMessageSize = 256 * 1024
+	// MaxBatchSize is max total size of messages published in single PublishBatch call
+	MaxBatchSize = 256 * 1024
+
+	snsMaxBatchSize = 10
+	fifoTopicSuffix = ".fifo"
+)
+
+// ErrMessageTooLarge is returned (wrapped) for messages exceeding SNS size limit
+var ErrMessageTooLarge = errors.New("message too large")
+
+// Client is subset of *sns.Client used by publisher
+type Client interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+	PublishBatch(ctx context.Context, params *sns.PublishBatchInput, optFns ...func(*sns.Options)) (*sns.PublishBatchOutput, error)
+}
+
+// Message is message to be published
+type Message struct {
+	Body string
+	// Attributes are delivered as SQS message attributes (raw delivery) or in SNS notification, see StringAttribute
+	Attributes map[string]sns_types.MessageAttributeValue
+	// Subject is used by email subscriptions and included in SNS notifications
+	Subject string
+	// GroupID is message group ID, required for FIFO topics
+	GroupID string
+	// DeduplicationID is FIFO deduplication ID, may be empty if the topic has content-based deduplication enabled
+	DeduplicationID string
+}
+
+// StringAttribute creates string message attribute
+func StringAttribute(value string) sns_types.MessageAttributeValue {
+	return sns_types.MessageAttributeValue{DataType: aws_sdk.String("String"), StringValue: aws_sdk.String(value)}
+}
+
+// Config configures publisher, zero values are replaced with defaults
+type Config struct {
+	TopicARN string
+	// MaxRetries is max number of retries of failed batch entries, negative value disables retries
+	MaxRetries int
+	// RetryBackoff is delay before first retry, it doubles with every further retry
+	RetryBackoff time.Duration
+}
+
+// Publisher publishes messages to single topic
+type Publisher struct {
+	client Client
+	cfg    Config
+	fifo   bool
+}
+
+// New creates publisher, use aws.CreateSnsClient to create the client
+func New(client Client, cfg Config) (*Publisher, error) {
+	if cfg.TopicARN == "" {
+		return nil, errors.New("publisher: topic arn must be set")
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+
+	return &Publisher{
+		client: client,
+		cfg:    cfg,
+		fifo:   strings.HasSuffix(cfg.TopicARN, fifoTopicSuffix),
+	}, nil
+}
+
+// Publish publishes single message and returns its SNS message ID. Request ID from ctx (see consumer.WithRequestID)
+// is propagated in consumer.AttributeRequestID attribute unless message already has it.
+func (p *Publisher) Publish(ctx context.Context, m Message) (string, error) {
+	entry, _, err := p.prepare(ctx, m)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := p.client.Publish(ctx, &sns.PublishInput{
+		TopicArn:               aws_sdk.String(p.cfg.TopicARN),
+		Message:                entry.Message,
+		MessageAttributes:      entry.MessageAttributes,
+		Subject:                entry.Subject,
+		MessageGroupId:         entry.MessageGroupId,
+		MessageDeduplicationId: entry.MessageDeduplicationId,
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot publish message: %w", err)
+	}
+	return aws_sdk.ToString(out.MessageId), nil
+}
+
+// PublishBatch publishes messages in batches of up to 10 messages and 256KB and returns their SNS message IDs, IDs of failed messages are empty.
+// Returned error joins errors of all failed messages.
+func (p *Publisher) PublishBatch(ctx context.Context, messages []Message) ([]string, error) {
+	ids := make([]string, len(messages))
+	errs := make([]error, len(messages))
+
+	var pending []int
+	entries := make([]sns_types.PublishBatchRequestEntry, len(messages))
+	sizes := make([]int, len(messages))
+	for i, m := range messages {
+		entry, size, err := p.prepare(ctx, m)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		entry.Id = aws_sdk.String(strconv.Itoa(i))
+		entries[i], sizes[i] = *entry, size
+		pending = append(pending, i)
+	}
+
+	p.publishBatch(ctx, entries, sizes, pending, ids, errs)
+	return ids, errors.Join(errs...)
+}
+
+// publishBatch publishes entries with given indexes and sizes in PublishBatch calls retrying failed ones,
+// results are stored into ids and errs
+func (p *Publisher) publishBatch(ctx context.Context, entries []sns_types.PublishBatchRequestEntry, sizes []int, indexes []int, ids []string, errs []error) {
+	policy := batch.Policy{
+		MaxRetries: p.cfg.MaxRetries,
+		Backoff:    p.cfg.RetryBackoff,
+		Operation:  "publish message",
+		MaxEntries: snsMaxBatchSize,
+		MaxBytes:   MaxBatchSize,
+		Size:       func(index int) int { return sizes[index] },
+	}
+	if p.fifo {
+		policy.Group = func(index int) string { return aws_sdk.ToString(entries[index].MessageGroupId) }
+	}
+	batch.Send(ctx, policy, indexes, func(ctx context.Context, indexes []int) (map[int]batch.Result, error) {
+		requestEntries := make([]sns_types.PublishBatchRequestEntry, len(indexes))
+		for i, index := range indexes {
+			requestEntries[i] = entries[index]
+		}
+
+		out, err := p.client.PublishBatch(ctx, &sns.PublishBatchInput{
+			TopicArn:                   aws_sdk.String(p.cfg.TopicARN),
+			PublishBatchRequestEntries: requestEntries,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		results := make(map[int]batch.Result, len(indexes))
+		for _, ok := range out.Successful {
+			if index, errParse := strconv.Atoi(aws_sdk.ToString(ok.Id)); errParse == nil {
+				results[index] = batch.Result{ID: aws_sdk.ToString(ok.MessageId)}
+			}
+		}
+		for _, failed := range out.Failed {
+			index, errParse := strconv.Atoi(aws_sdk.ToString(failed.Id))
+			if _, answered := results[index]; errParse != nil || answered {
+				continue
+			}
+			failedErr := fmt.Errorf("%s: %s", aws_sdk.ToString(failed.Code), aws_sdk.ToString(failed.Message))
+			if failed.SenderFault {
+				results[index] = batch.Result{Err: fmt.Errorf("sns rejected message: %w", failedErr)}
+			} else {
+				results[index] = batch.Result{Err: failedErr, Retry: true}
+			}
+		}
+		return results, nil
+	}, ids, errs)
+}
+
+// prepare validates message and builds batch entry, returned size is message size as counted by SNS
+func (p *Publisher) prepare(ctx context.Context, m Message) (*sns_types.PublishBatchRequestEntry, int, error) {
+	if p.fifo && m.GroupID == "" {
+		return nil, 0, errors.New("publisher: message group id is required for fifo topic")
+	}
+
+	attributes := m.Attributes
+	if requestID := consumer.RequestID(ctx); requestID != "" {
+		if _, ok := attributes[consumer.AttributeRequestID]; !ok {
+			attributes = make(map[string]sns_types.MessageAttributeValue, len(m.Attributes)+1)
+			for name, attr := range m.Attributes {
+				attributes[name] = attr
+			}
+			attributes[consumer.AttributeRequestID] = StringAttribute(requestID)
+		}
+	}
+
+	size := len(m.Body)
+	for name, attr := range attributes {
+		size += len(name) + len(aws_sdk.ToString(attr.DataType)) + len(aws_sdk.ToString(attr.StringValue)) + len(attr.BinaryValue)
+	}
+	if size > MaxMessageSize {
+		return nil, 0, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, size)
+	}
+
+	entry := &sns_types.PublishBatchRequestEntry{
+		Message:           aws_sdk.String(m.Body),
+		MessageAttributes: attributes,
+	}
+	if m.Subject != "" {
+		entry.Subject = aws_sdk.String(m.Subject)
+	}
+	if m.GroupID != "" {
+		entry.MessageGroupId = aws_sdk.String(m.GroupID)
+	}
+	if m.DeduplicationID != "" {
+		entry.MessageDeduplicationId = aws_sdk.String(m.DeduplicationID)
+	}
+	return entry, size, nil
+}
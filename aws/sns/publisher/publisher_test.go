@@ -0,0 +1,202 @@
+package publisher_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	sns_types "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sns/publisher"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/consumer"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTopic accepts messages, rejected entries fail permanently and transient ones fail once
+type fakeTopic struct {
+	mu        sync.Mutex
+	batches   [][]sns_types.PublishBatchRequestEntry
+	published []*sns.PublishInput
+	transient map[string]bool
+	rejected  map[string]bool
+}
+
+func (f *fakeTopic) Publish(_ context.Context, params *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.published = append(f.published, params)
+	return &sns.PublishOutput{MessageId: aws_sdk.String("id-" + aws_sdk.ToString(params.Message))}, nil
+}
+
+func (f *fakeTopic) PublishBatch(_ context.Context, params *sns.PublishBatchInput, _ ...func(*sns.Options)) (*sns.PublishBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, params.PublishBatchRequestEntries)
+
+	size := 0
+	for _, entry := range params.PublishBatchRequestEntries {
+		size += len(aws_sdk.ToString(entry.Message))
+	}
+	if size > publisher.MaxBatchSize {
+		return nil, errors.New("BatchRequestTooLong")
+	}
+
+	out := &sns.PublishBatchOutput{}
+	for _, entry := range params.PublishBatchRequestEntries {
+		body := aws_sdk.ToString(entry.Message)
+		switch {
+		case f.rejected[body]:
+			out.Failed = append(out.Failed, sns_types.BatchResultErrorEntry{Id: entry.Id, Code: aws_sdk.String("InvalidParameter"), SenderFault: true})
+		case f.transient[body]:
+			delete(f.transient, body)
+			out.Failed = append(out.Failed, sns_types.BatchResultErrorEntry{Id: entry.Id, Code: aws_sdk.String("InternalError")})
+		default:
+			out.Successful = append(out.Successful, sns_types.PublishBatchResultEntry{Id: entry.Id, MessageId: aws_sdk.String("id-" + body)})
+		}
+	}
+	return out, nil
+}
+
+func TestPublishBatchRetriesFailedEntries(t *testing.T) {
+	topic := &fakeTopic{transient: map[string]bool{"3": true}, rejected: map[string]bool{"7": true}}
+	p, err := publisher.New(topic, publisher.Config{TopicARN: "topic", RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+
+	messages := make([]publisher.Message, 12)
+	for i := range messages {
+		messages[i] = publisher.Message{Body: fmt.Sprint(i)}
+	}
+	ids, err := p.PublishBatch(context.Background(), messages)
+	assert.NotNil(t, err)
+	assert.Equal(t, "id-0", ids[0])
+	assert.Equal(t, "id-3", ids[3])
+	assert.Equal(t, "", ids[7])
+	assert.Equal(t, "id-11", ids[11])
+	// 10 messages, then retry of transient failure with remaining 2 messages
+	assert.Len(t, topic.batches, 2)
+	assert.Len(t, topic.batches[0], 10)
+	assert.Len(t, topic.batches[1], 3)
+}
+
+func TestPublishBatchSplitsCallsBySize(t *testing.T) {
+	topic := &fakeTopic{}
+	p, err := publisher.New(topic, publisher.Config{TopicARN: "topic", RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+
+	messages := make([]publisher.Message, 10)
+	for i := range messages {
+		messages[i] = publisher.Message{Body: fmt.Sprint(i) + strings.Repeat("x", 100*1024)}
+	}
+	ids, err := p.PublishBatch(context.Background(), messages)
+	assert.Nil(t, err)
+	for i := range messages {
+		assert.Equal(t, "id-"+messages[i].Body, ids[i])
+	}
+	// 2 messages of 100KB per call
+	assert.Len(t, topic.batches, 5)
+	for _, batch := range topic.batches {
+		assert.Len(t, batch, 2)
+	}
+}
+
+func TestPublishBatchKeepsOrderOfFifoGroups(t *testing.T) {
+	topic := &fakeTopic{transient: map[string]bool{"a2": true}, rejected: map[string]bool{"b1": true}}
+	p, err := publisher.New(topic, publisher.Config{TopicARN: "arn:aws:sns:eu-central-1:000000000000:matches.fifo", RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+
+	ids, err := p.PublishBatch(context.Background(), []publisher.Message{
+		{Body: "a1", GroupID: "a"}, {Body: "a2", GroupID: "a"}, {Body: "b1", GroupID: "b"}, {Body: "a3", GroupID: "a"}, {Body: "b2", GroupID: "b"},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"id-a1", "id-a2", "", "id-a3", ""}, ids)
+
+	var published []string
+	for _, batch := range topic.batches {
+		var bodies []string
+		for _, entry := range batch {
+			bodies = append(bodies, aws_sdk.ToString(entry.Message))
+		}
+		published = append(published, strings.Join(bodies, ","))
+	}
+	// a3 waits for retried a2, b2 is not published after rejected b1
+	assert.Equal(t, []string{"a1,b1", "a2", "a2", "a3"}, published)
+}
+
+func TestPublishPropagatesRequestIDAndValidatesFifo(t *testing.T) {
+	topic := &fakeTopic{}
+	p, err := publisher.New(topic, publisher.Config{TopicARN: "arn:aws:sns:eu-central-1:000000000000:matches.fifo"})
+	assert.Nil(t, err)
+
+	ctx := consumer.WithRequestID(context.Background(), "r1")
+	_, err = p.Publish(ctx, publisher.Message{Body: "no group"})
+	assert.NotNil(t, err)
+
+	id, err := p.Publish(ctx, publisher.Message{Body: "m", GroupID: "g", Attributes: map[string]sns_types.MessageAttributeValue{
+		"Type": publisher.StringAttribute("MatchStarted"),
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, "id-m", id)
+	assert.Equal(t, "r1", aws_sdk.ToString(topic.published[0].MessageAttributes[consumer.AttributeRequestID].StringValue))
+	assert.Equal(t, "MatchStarted", aws_sdk.ToString(topic.published[0].MessageAttributes["Type"].StringValue))
+	assert.Equal(t, "g", aws_sdk.ToString(topic.published[0].MessageGroupId))
+
+	_, err = p.Publish(ctx, publisher.Message{Body: strings.Repeat("x", publisher.MaxMessageSize+1), GroupID: "g"})
+	assert.True(t, errors.Is(err, publisher.ErrMessageTooLarge))
+}
+
+func TstPublishToSubscribedQueues(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	c := test.SetupLocalstack(ctx)
+	ctx = aws.SetCustomAwsEndpoint(ctx, c.URI)
+	defer c.TeardownLocalstack()
+
+	topicARN, err := c.CreateSnsTopic(ctx, "matches")
+	assert.Nil(t, err)
+	snsClient, err := aws.CreateSnsClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+	sqsClient, err := aws.CreateSqsClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+
+	var queueURLs []string
+	for _, raw := range []bool{true, false} {
+		queueURL, queueARN, err := c.CreateSqsQueue(ctx, fmt.Sprint("matches-raw-", raw))
+		assert.Nil(t, err)
+		assert.Nil(t, c.SubscribeQueue(ctx, topicARN, queueARN, raw))
+		queueURLs = append(queueURLs, queueURL)
+	}
+
+	p, err := publisher.New(snsClient, publisher.Config{TopicARN: topicARN})
+	assert.Nil(t, err)
+	_, err = p.PublishBatch(consumer.WithRequestID(ctx, "r1"), []publisher.Message{{Body: `{"matchId": 1}`}, {Body: `{"matchId": 2}`}})
+	assert.Nil(t, err)
+
+	// handlers see the same messages regardless of raw message delivery
+	for _, queueURL := range queueURLs {
+		runCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		var mu sync.Mutex
+		var bodies []string
+		sqsConsumer, err := consumer.New(sqsClient, consumer.Config{QueueURL: queueURL, WaitTime: time.Second, UnwrapSNS: true},
+			func(ctx context.Context, m *consumer.Message) error {
+				mu.Lock()
+				defer mu.Unlock()
+				assert.Equal(t, "r1", consumer.RequestID(ctx))
+				bodies = append(bodies, aws_sdk.ToString(m.Body))
+				if len(bodies) == 2 {
+					cancel()
+				}
+				return nil
+			})
+		assert.Nil(t, err)
+		_ = sqsConsumer.Run(runCtx)
+		cancel()
+		assert.ElementsMatch(t, []string{`{"matchId": 1}`, `{"matchId": 2}`}, bodies)
+	}
+}
@@ -0,0 +1,466 @@
+package consumer
+
+/*
+SQS consumer: long-polling receivers feed bounded pool of handler goroutines. Messages are received only when
+there is free capacity in the pool so that they do not wait in memory while their visibility timeout runs out.
+Visibility of messages is extended while handlers run, successfully handled messages are deleted in batches.
+Failed messages are left in the queue and reappear after visibility timeout (use redrive policy to move
+messages failing repeatedly to DLQ). With RetryPolicy they reappear after exponential backoff instead
+and messages failing permanently are moved to DeadLetterQueueURL right away (see retry package).
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sns/notification"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/extended"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/retry"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/rs/zerolog/log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// AttributeRequestID is message attribute holding request ID propagated to handler context
+	AttributeRequestID = "RequestID"
+	// AttributeFailureReason is message attribute holding handler error of messages moved to DLQ
+	AttributeFailureReason = "FailureReason"
+	// AttributeSourceQueue is message attribute holding url of queue messages moved to DLQ were received from
+	AttributeSourceQueue = "SourceQueueUrl"
+
+	DefaultReceivers           = 1
+	DefaultWorkers             = 10
+	DefaultMaxMessages         = 10
+	DefaultWaitTime            = 20 * time.Second
+	DefaultVisibilityTimeout   = 30 * time.Second
+	DefaultDeleteFlushInterval = time.Second
+	DefaultDrainTimeout        = 30 * time.Second
+
+	sqsMaxBatchSize        = 10
+	sqsMaxAttributes       = 10
+	maxFailureReasonLength = 1024
+	receiveErrorBackoff    = time.Second
+	requestTimeout         = 10 * time.Second
+)
+
+// Client is subset of *sqs.Client used by consumer
+type Client interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// Message is received SQS message
+type Message = sqs_types.Message
+
+// Handler handles single message, message is deleted from the queue if nil is returned
+type Handler func(ctx context.Context, m *Message) error
+
+// TypedHandler creates handler decoding JSON message body into T
+func TypedHandler[T any](fn func(ctx context.Context, payload T, m *Message) error) Handler {
+	return func(ctx context.Context, m *Message) error {
+		var payload T
+		if err := json.Unmarshal([]byte(aws_sdk.ToString(m.Body)), &payload); err != nil {
+			return fmt.Errorf("cannot decode message %s: %w", aws_sdk.ToString(m.MessageId), err)
+		}
+		return fn(ctx, payload, m)
+	}
+}
+
+// WithRequestID stores request ID into context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, constants.ContextKeyRequestID{}, requestID)
+}
+
+// RequestID returns request ID stored in context, empty string if there is none
+func RequestID(ctx context.Context) string {
+	if val, ok := ctx.Value(constants.ContextKeyRequestID{}).(string); ok {
+		return val
+	}
+	return ""
+}
+
+// Config configures consumer, zero values are replaced with defaults
+type Config struct {
+	QueueURL string
+	// Receivers is number of concurrent long-polling receive loops
+	Receivers int
+	// Workers is max number of messages handled concurrently
+	Workers int
+	// MaxMessages is max number of messages received in single call (1-10)
+	MaxMessages int
+	// WaitTime is long polling wait time (max 20s)
+	WaitTime time.Duration
+	// VisibilityTimeout is set on receive and re-set every VisibilityTimeout/2 while message is being handled
+	VisibilityTimeout time.Duration
+	// DeleteFlushInterval is max delay of deletion of handled messages (deletes are sent in batches of 10)
+	DeleteFlushInterval time.Duration
+	// DrainTimeout is max time in-flight handlers get to finish after Run's ctx is cancelled,
+	// their contexts are cancelled afterwards
+	DrainTimeout time.Duration
+	// UnwrapSNS unwraps messages delivered by SNS subscriptions without raw message delivery (see notification package)
+	UnwrapSNS bool
+	// PayloadStore resolves payloads offloaded to S3 by publisher before messages reach handler, optional
+	PayloadStore *extended.Store
+	// RetryPolicy delays retries of failed messages with exponential backoff, optional
+	RetryPolicy *retry.Policy
+	// DeadLetterQueueURL receives messages failed permanently or exhausting RetryPolicy.MaxAttempts, without it such
+	// messages are retried with max backoff until redrive policy of the queue moves them. Used only with RetryPolicy.
+	DeadLetterQueueURL string
+}
+
+// Consumer receives messages from single queue and dispatches them to handler
+type Consumer struct {
+	client  Client
+	cfg     Config
+	handler Handler
+	deletes chan string
+}
+
+// New creates consumer, use aws.CreateSqsClient to create the client. Start it with Run.
+func New(client Client, cfg Config, handler Handler) (*Consumer, error) {
+	if cfg.QueueURL == "" {
+		return nil, errors.New("consumer: queue url must be set")
+	}
+	if cfg.Receivers <= 0 {
+		cfg.Receivers = DefaultReceivers
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultWorkers
+	}
+	if cfg.MaxMessages <= 0 || cfg.MaxMessages > sqsMaxBatchSize {
+		cfg.MaxMessages = DefaultMaxMessages
+	}
+	if cfg.WaitTime <= 0 || cfg.WaitTime > DefaultWaitTime {
+		cfg.WaitTime = DefaultWaitTime
+	}
+	if cfg.VisibilityTimeout < time.Second {
+		cfg.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+	if cfg.DeleteFlushInterval <= 0 {
+		cfg.DeleteFlushInterval = DefaultDeleteFlushInterval
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = DefaultDrainTimeout
+	}
+
+	return &Consumer{
+		client:  client,
+		cfg:     cfg,
+		handler: handler,
+		deletes: make(chan string, cfg.Workers),
+	}, nil
+}
+
+// Run consumes messages until ctx is cancelled. Then it stops receiving, waits (at most DrainTimeout)
+// for in-flight handlers, deletes handled messages and returns ctx.Err(). Run can be called only once.
+func (c *Consumer) Run(ctx context.Context) error {
+	// handlers are not cancelled together with ctx but only after drain timeout
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+	stopDrainTimer := context.AfterFunc(ctx, func() {
+		time.AfterFunc(c.cfg.DrainTimeout, cancelHandlers)
+	})
+	defer stopDrainTimer()
+
+	deleterDone := make(chan struct{})
+	go func() {
+		defer close(deleterDone)
+		c.deleteLoop()
+	}()
+
+	slots := make(chan struct{}, c.cfg.Workers)
+	var handlers sync.WaitGroup
+	var receivers sync.WaitGroup
+	for i := 0; i < c.cfg.Receivers; i++ {
+		receivers.Add(1)
+		go func() {
+			defer receivers.Done()
+			c.receiveLoop(ctx, handlerCtx, slots, &handlers)
+		}()
+	}
+
+	receivers.Wait()
+	handlers.Wait()
+	close(c.deletes)
+	<-deleterDone
+	return ctx.Err()
+}
+
+func (c *Consumer) receiveLoop(ctx context.Context, handlerCtx context.Context, slots chan struct{}, handlers *sync.WaitGroup) {
+	for {
+		free := c.acquireSlots(ctx, slots)
+		if free == 0 {
+			return
+		}
+
+		out, err := c.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws_sdk.String(c.cfg.QueueURL),
+			MaxNumberOfMessages:   int32(free),
+			WaitTimeSeconds:       int32(c.cfg.WaitTime.Seconds()),
+			VisibilityTimeout:     int32(c.cfg.VisibilityTimeout.Seconds()),
+			MessageAttributeNames: []string{"All"},
+			AttributeNames:        []sqs_types.QueueAttributeName{sqs_types.QueueAttributeNameAll},
+		})
+		if err != nil {
+			releaseSlots(slots, free)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Error().Err(err).Str("queue", c.cfg.QueueURL).Msg("sqs consumer: cannot receive messages")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(receiveErrorBackoff):
+			}
+			continue
+		}
+
+		releaseSlots(slots, free-len(out.Messages))
+		for i := range out.Messages {
+			m := out.Messages[i]
+			handlers.Add(1)
+			go func() {
+				defer handlers.Done()
+				defer releaseSlots(slots, 1)
+				c.handle(handlerCtx, &m)
+			}()
+		}
+	}
+}
+
+// acquireSlots blocks until at least one worker is free, then takes up to MaxMessages free slots.
+// Returns 0 if ctx is done.
+func (c *Consumer) acquireSlots(ctx context.Context, slots chan struct{}) int {
+	select {
+	case <-ctx.Done():
+		return 0
+	case slots <- struct{}{}:
+	}
+
+	free := 1
+	for free < c.cfg.MaxMessages {
+		select {
+		case slots <- struct{}{}:
+			free++
+		default:
+			return free
+		}
+	}
+	return free
+}
+
+func releaseSlots(slots chan struct{}, n int) {
+	for i := 0; i < n; i++ {
+		<-slots
+	}
+}
+
+func (c *Consumer) handle(ctx context.Context, m *Message) {
+	// handler gets unwrapped copy, message is moved to DLQ as it was received
+	unwrapped := *m
+	var err error
+	if c.cfg.UnwrapSNS {
+		if _, err = notification.Unwrap(&unwrapped); err != nil {
+			err = retry.Permanent(err)
+		}
+	}
+
+	requestID := aws_sdk.ToString(m.MessageId)
+	if attr, ok := unwrapped.MessageAttributes[AttributeRequestID]; ok && aws_sdk.ToString(attr.StringValue) != "" {
+		requestID = aws_sdk.ToString(attr.StringValue)
+	}
+	ctx = WithRequestID(ctx, requestID)
+
+	handlerDone := make(chan struct{})
+	extenderDone := make(chan struct{})
+	go func() {
+		defer close(extenderDone)
+		c.extendVisibility(ctx, m, handlerDone)
+	}()
+
+	if err == nil {
+		err = c.invoke(ctx, &unwrapped)
+	}
+	close(handlerDone)
+	// extension in flight must not override retry backoff set below or extend already deleted message
+	<-extenderDone
+
+	if err != nil {
+		log.Error().Err(err).Str("queue", c.cfg.QueueURL).Str("messageId", aws_sdk.ToString(m.MessageId)).Str("requestId", requestID).
+			Msg("sqs consumer: message handler failed")
+		c.retry(m, err)
+		return
+	}
+	c.deletes <- aws_sdk.ToString(m.ReceiptHandle)
+}
+
+// retry applies retry policy to failed message
+func (c *Consumer) retry(m *Message, err error) {
+	policy := c.cfg.RetryPolicy
+	if policy == nil {
+		return
+	}
+
+	// calls must go through also during shutdown, like deletes
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	attempt, _ := strconv.Atoi(m.Attributes[string(sqs_types.MessageSystemAttributeNameApproximateReceiveCount)])
+	backoff := policy.Backoff(attempt)
+	if policy.IsPermanent(err) || policy.Exhausted(attempt) {
+		if c.cfg.DeadLetterQueueURL != "" {
+			if errMove := c.moveToDeadLetterQueue(ctx, m, err); errMove != nil {
+				log.Error().Err(errMove).Str("queue", c.cfg.QueueURL).Str("messageId", aws_sdk.ToString(m.MessageId)).
+					Msg("sqs consumer: cannot move message to dead letter queue")
+			} else {
+				c.deletes <- aws_sdk.ToString(m.ReceiptHandle)
+				return
+			}
+		}
+		backoff = policy.MaxDelay()
+	}
+
+	_, errVisibility := c.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws_sdk.String(c.cfg.QueueURL),
+		ReceiptHandle:     m.ReceiptHandle,
+		VisibilityTimeout: int32(backoff.Seconds()),
+	})
+	if errVisibility != nil {
+		log.Warn().Err(errVisibility).Str("queue", c.cfg.QueueURL).Str("messageId", aws_sdk.ToString(m.MessageId)).
+			Msg("sqs consumer: cannot delay retry of failed message")
+	}
+}
+
+// moveToDeadLetterQueue sends copy of message to DLQ adding failure reason and source queue attributes
+// (as long as SQS limit of message attributes is not reached)
+func (c *Consumer) moveToDeadLetterQueue(ctx context.Context, m *Message, err error) error {
+	attributes := make(map[string]sqs_types.MessageAttributeValue, len(m.MessageAttributes)+2)
+	for name, attr := range m.MessageAttributes {
+		attributes[name] = attr
+	}
+	reason := err.Error()
+	if len(reason) > maxFailureReasonLength {
+		reason = reason[:maxFailureReasonLength]
+	}
+	for _, attr := range [][2]string{{AttributeFailureReason, reason}, {AttributeSourceQueue, c.cfg.QueueURL}} {
+		if _, ok := attributes[attr[0]]; ok || len(attributes) < sqsMaxAttributes {
+			attributes[attr[0]] = sqs_types.MessageAttributeValue{DataType: aws_sdk.String("String"), StringValue: aws_sdk.String(attr[1])}
+		}
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws_sdk.String(c.cfg.DeadLetterQueueURL),
+		MessageBody:       m.Body,
+		MessageAttributes: attributes,
+	}
+	if groupID, ok := m.Attributes[string(sqs_types.MessageSystemAttributeNameMessageGroupId)]; ok {
+		input.MessageGroupId = aws_sdk.String(groupID)
+		input.MessageDeduplicationId = m.MessageId
+	}
+	_, err = c.client.SendMessage(ctx, input)
+	return err
+}
+
+// invoke calls handler converting panic into error so that single message cannot crash the consumer
+func (c *Consumer) invoke(ctx context.Context, m *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	if c.cfg.PayloadStore != nil {
+		if err := c.cfg.PayloadStore.Resolve(ctx, m); err != nil {
+			return err
+		}
+	}
+	return c.handler(ctx, m)
+}
+
+// extendVisibility keeps message invisible to other consumers while it is being handled
+func (c *Consumer) extendVisibility(ctx context.Context, m *Message, handlerDone chan struct{}) {
+	ticker := time.NewTicker(c.cfg.VisibilityTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-handlerDone:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := c.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws_sdk.String(c.cfg.QueueURL),
+				ReceiptHandle:     m.ReceiptHandle,
+				VisibilityTimeout: int32(c.cfg.VisibilityTimeout.Seconds()),
+			})
+			if err != nil {
+				log.Warn().Err(err).Str("queue", c.cfg.QueueURL).Str("messageId", aws_sdk.ToString(m.MessageId)).
+					Msg("sqs consumer: cannot extend message visibility")
+			}
+		}
+	}
+}
+
+// deleteLoop deletes handled messages in batches until deletes channel is closed
+func (c *Consumer) deleteLoop() {
+	ticker := time.NewTicker(c.cfg.DeleteFlushInterval)
+	defer ticker.Stop()
+
+	pending := make([]string, 0, sqsMaxBatchSize)
+	for {
+		select {
+		case receiptHandle, ok := <-c.deletes:
+			if !ok {
+				c.deleteBatch(pending)
+				return
+			}
+			pending = append(pending, receiptHandle)
+			if len(pending) == sqsMaxBatchSize {
+				c.deleteBatch(pending)
+				pending = pending[:0]
+			}
+		case <-ticker.C:
+			c.deleteBatch(pending)
+			pending = pending[:0]
+		}
+	}
+}
+
+func (c *Consumer) deleteBatch(receiptHandles []string) {
+	if len(receiptHandles) == 0 {
+		return
+	}
+
+	entries := make([]sqs_types.DeleteMessageBatchRequestEntry, 0, len(receiptHandles))
+	for i, receiptHandle := range receiptHandles {
+		entries = append(entries, sqs_types.DeleteMessageBatchRequestEntry{
+			Id:            aws_sdk.String(fmt.Sprint(i)),
+			ReceiptHandle: aws_sdk.String(receiptHandle),
+		})
+	}
+
+	// deletes must go through also during shutdown, otherwise handled messages would be redelivered
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	out, err := c.client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws_sdk.String(c.cfg.QueueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("queue", c.cfg.QueueURL).Int("messages", len(entries)).Msg("sqs consumer: cannot delete handled messages")
+		return
+	}
+	for _, failed := range out.Failed {
+		log.Error().Str("queue", c.cfg.QueueURL).Str("code", aws_sdk.ToString(failed.Code)).Str("error", aws_sdk.ToString(failed.Message)).
+			Msg("sqs consumer: cannot delete handled message")
+	}
+}
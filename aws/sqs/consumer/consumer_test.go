@@ -0,0 +1,297 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/consumer"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/retry"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	service_errors "github.com/hrsupersport/hrnogomet-backend-kit/errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeQueue serves pending messages and records deleted receipt handles, visibility changes and sent messages
+type fakeQueue struct {
+	mu         sync.Mutex
+	pending    []sqs_types.Message
+	deleted    []string
+	visibility map[string]int32
+	sent       []*sqs.SendMessageInput
+}
+
+func (q *fakeQueue) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	q.mu.Lock()
+	n := min(int(params.MaxNumberOfMessages), len(q.pending))
+	messages := append([]sqs_types.Message(nil), q.pending[:n]...)
+	q.pending = q.pending[n:]
+	q.mu.Unlock()
+
+	if len(messages) == 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func (q *fakeQueue) DeleteMessageBatch(_ context.Context, params *sqs.DeleteMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, entry := range params.Entries {
+		q.deleted = append(q.deleted, aws_sdk.ToString(entry.ReceiptHandle))
+	}
+	return &sqs.DeleteMessageBatchOutput{}, nil
+}
+
+func (q *fakeQueue) ChangeMessageVisibility(_ context.Context, params *sqs.ChangeMessageVisibilityInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.visibility == nil {
+		q.visibility = make(map[string]int32)
+	}
+	q.visibility[aws_sdk.ToString(params.ReceiptHandle)] = params.VisibilityTimeout
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (q *fakeQueue) SendMessage(_ context.Context, params *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sent = append(q.sent, params)
+	return &sqs.SendMessageOutput{MessageId: aws_sdk.String("dlq")}, nil
+}
+
+type matchEvent struct {
+	MatchID int `json:"matchId"`
+}
+
+func TestConsumerDeletesHandledMessages(t *testing.T) {
+	queue := &fakeQueue{}
+	for i := 0; i < 25; i++ {
+		queue.pending = append(queue.pending, sqs_types.Message{
+			MessageId:     aws_sdk.String(fmt.Sprint("m", i)),
+			ReceiptHandle: aws_sdk.String(fmt.Sprint("r", i)),
+			Body:          aws_sdk.String(fmt.Sprintf(`{"matchId": %d}`, i)),
+			MessageAttributes: map[string]sqs_types.MessageAttributeValue{
+				consumer.AttributeRequestID: {DataType: aws_sdk.String("String"), StringValue: aws_sdk.String(fmt.Sprint("req", i))},
+			},
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var handled, requestIDs []string
+	c, err := consumer.New(queue, consumer.Config{QueueURL: "queue", Workers: 4}, consumer.TypedHandler(func(ctx context.Context, e matchEvent, m *consumer.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.MatchID%5 == 0 {
+			return errors.New("boom")
+		}
+		handled = append(handled, aws_sdk.ToString(m.ReceiptHandle))
+		requestIDs = append(requestIDs, consumer.RequestID(ctx))
+		if len(handled) == 20 {
+			cancel()
+		}
+		return nil
+	}))
+	assert.Nil(t, err)
+
+	err = c.Run(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	sort.Strings(handled)
+	sort.Strings(queue.deleted)
+	assert.Len(t, handled, 20)
+	assert.Equal(t, handled, queue.deleted)
+	assert.NotContains(t, queue.deleted, "r5")
+	assert.Contains(t, requestIDs, "req1")
+}
+
+func TestConsumerRecoversFromPanic(t *testing.T) {
+	queue := &fakeQueue{pending: []sqs_types.Message{{MessageId: aws_sdk.String("m"), ReceiptHandle: aws_sdk.String("r")}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := consumer.New(queue, consumer.Config{QueueURL: "queue"}, func(ctx context.Context, m *consumer.Message) error {
+		defer cancel()
+		panic("boom")
+	})
+	assert.Nil(t, err)
+
+	_ = c.Run(ctx)
+	assert.Empty(t, queue.deleted)
+}
+
+func TestConsumerRetriesWithBackoff(t *testing.T) {
+	received := func(id string, receiveCount int) sqs_types.Message {
+		return sqs_types.Message{
+			MessageId:     aws_sdk.String(id),
+			ReceiptHandle: aws_sdk.String(id),
+			Body:          aws_sdk.String(id),
+			Attributes:    map[string]string{string(sqs_types.MessageSystemAttributeNameApproximateReceiveCount): fmt.Sprint(receiveCount)},
+		}
+	}
+	queue := &fakeQueue{pending: []sqs_types.Message{received("transient", 3), received("permanent", 1), received("exhausted", 5)}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	handled := 0
+	c, err := consumer.New(queue, consumer.Config{
+		QueueURL:           "queue",
+		RetryPolicy:        &retry.Policy{InitialBackoff: 10 * time.Second, MaxAttempts: 5},
+		DeadLetterQueueURL: "dlq",
+	}, func(ctx context.Context, m *consumer.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if handled++; handled == 3 {
+			defer cancel()
+		}
+		if aws_sdk.ToString(m.Body) == "permanent" {
+			return service_errors.NewServiceErrorBadRequest(nil, "invalid match")
+		}
+		return errors.New("db down")
+	})
+	assert.Nil(t, err)
+	_ = c.Run(ctx)
+
+	assert.Equal(t, map[string]int32{"transient": 40}, queue.visibility)
+	assert.ElementsMatch(t, []string{"permanent", "exhausted"}, queue.deleted)
+	assert.Len(t, queue.sent, 2)
+	for _, sent := range queue.sent {
+		assert.Equal(t, "dlq", aws_sdk.ToString(sent.QueueUrl))
+		assert.Equal(t, "queue", aws_sdk.ToString(sent.MessageAttributes[consumer.AttributeSourceQueue].StringValue))
+	}
+}
+
+// slowExtensionQueue delays visibility extensions (changes to VisibilityTimeout) so that they are in flight
+// when handler finishes
+type slowExtensionQueue struct {
+	*fakeQueue
+	visibilityTimeout int32
+}
+
+func (q *slowExtensionQueue) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	if params.VisibilityTimeout == q.visibilityTimeout {
+		time.Sleep(300 * time.Millisecond)
+	}
+	return q.fakeQueue.ChangeMessageVisibility(ctx, params, optFns...)
+}
+
+func TestConsumerRetryIsNotOverriddenByVisibilityExtension(t *testing.T) {
+	queue := &slowExtensionQueue{
+		fakeQueue: &fakeQueue{pending: []sqs_types.Message{{
+			MessageId:     aws_sdk.String("m"),
+			ReceiptHandle: aws_sdk.String("r"),
+			Attributes:    map[string]string{string(sqs_types.MessageSystemAttributeNameApproximateReceiveCount): "1"},
+		}}},
+		visibilityTimeout: 1,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := consumer.New(queue, consumer.Config{
+		QueueURL:          "queue",
+		VisibilityTimeout: time.Second,
+		RetryPolicy:       &retry.Policy{InitialBackoff: 10 * time.Second, MaxAttempts: 5},
+	}, func(ctx context.Context, m *consumer.Message) error {
+		defer cancel()
+		// extension started after VisibilityTimeout/2 is still in flight when handler fails
+		time.Sleep(600 * time.Millisecond)
+		return errors.New("db down")
+	})
+	assert.Nil(t, err)
+	_ = c.Run(ctx)
+
+	// extension still in flight would land meanwhile
+	time.Sleep(500 * time.Millisecond)
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	assert.Equal(t, map[string]int32{"r": 10}, queue.visibility)
+}
+
+func TestConsumerUnwrapsSnsNotifications(t *testing.T) {
+	queue := &fakeQueue{pending: []sqs_types.Message{
+		{
+			MessageId:     aws_sdk.String("m1"),
+			ReceiptHandle: aws_sdk.String("r1"),
+			Body: aws_sdk.String(`{"Type":"Notification","MessageId":"n1","TopicArn":"arn:aws:sns:eu-central-1:000000000000:matches",` +
+				`"Message":"{\"matchId\": 1}","MessageAttributes":{"RequestID":{"Type":"String","Value":"req1"}}}`),
+		},
+		{MessageId: aws_sdk.String("m2"), ReceiptHandle: aws_sdk.String("r2"), Body: aws_sdk.String(`{"matchId": 2}`)},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var matchIDs []int
+	var requestIDs []string
+	c, err := consumer.New(queue, consumer.Config{QueueURL: "queue", UnwrapSNS: true}, consumer.TypedHandler(func(ctx context.Context, e matchEvent, m *consumer.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		matchIDs = append(matchIDs, e.MatchID)
+		requestIDs = append(requestIDs, consumer.RequestID(ctx))
+		if len(matchIDs) == 2 {
+			cancel()
+		}
+		return nil
+	}))
+	assert.Nil(t, err)
+	_ = c.Run(ctx)
+
+	assert.ElementsMatch(t, []int{1, 2}, matchIDs)
+	assert.ElementsMatch(t, []string{"req1", "m2"}, requestIDs)
+}
+
+func TstConsumerWithLocalstack(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	c := test.SetupLocalstack(ctx)
+	ctx = aws.SetCustomAwsEndpoint(ctx, c.URI)
+	defer c.TeardownLocalstack()
+
+	client, err := aws.CreateSqsClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+	queue, err := client.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws_sdk.String("matches")})
+	assert.Nil(t, err)
+
+	for i := 0; i < 15; i++ {
+		_, err := client.SendMessage(ctx, &sqs.SendMessageInput{
+			QueueUrl:    queue.QueueUrl,
+			MessageBody: aws_sdk.String(fmt.Sprintf(`{"matchId": %d}`, i)),
+		})
+		assert.Nil(t, err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	handled := 0
+	consumer, err := consumer.New(client, consumer.Config{QueueURL: aws_sdk.ToString(queue.QueueUrl), WaitTime: time.Second},
+		consumer.TypedHandler(func(ctx context.Context, e matchEvent, m *consumer.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled++
+			if handled == 15 {
+				cancel()
+			}
+			return nil
+		}))
+	assert.Nil(t, err)
+	_ = consumer.Run(runCtx)
+	assert.Equal(t, 15, handled)
+
+	attrs, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []sqs_types.QueueAttributeName{sqs_types.QueueAttributeNameApproximateNumberOfMessagesNotVisible},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "0", attrs.Attributes[string(sqs_types.QueueAttributeNameApproximateNumberOfMessagesNotVisible)])
+}
@@ -0,0 +1,149 @@
+package extended
+
+/*
+Extended client pattern for payloads exceeding SQS message size limit: payload is stored in S3 and message
+carries only pointer to it. Pointer format and size attribute are the same as in Amazon SQS Extended Client Library,
+messages can therefore be exchanged with Java/Python services using the library.
+Offloaded objects are not deleted by consumers, configure lifecycle expiration rule on the bucket instead.
+*/
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
+	"io"
+	"strconv"
+)
+
+const (
+	// MaxMessageSize is max size of SQS message body including message attributes
+	MaxMessageSize = 256 * 1024
+
+	// AttributePayloadSize marks offloaded message, it holds size of original payload
+	AttributePayloadSize = "ExtendedPayloadSize"
+	// legacyAttributePayloadSize is used by older versions of extended client library
+	legacyAttributePayloadSize = "SQSLargePayloadSize"
+
+	pointerClass = "software.amazon.payloadoffloading.PayloadS3Pointer"
+)
+
+// S3Client is subset of *s3.Client used by Store
+type S3Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Pointer references offloaded payload
+type Pointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+// Store offloads payloads to S3 bucket and resolves pointers to them
+type Store struct {
+	client    S3Client
+	bucket    string
+	keyPrefix string
+}
+
+// NewStore creates payload store, use aws.CreateS3Client to create the client. Objects are stored
+// under keyPrefix followed by random UUID.
+func NewStore(client S3Client, bucket string, keyPrefix string) *Store {
+	return &Store{
+		client:    client,
+		bucket:    bucket,
+		keyPrefix: keyPrefix,
+	}
+}
+
+// MessageSize returns size of message as counted by SQS (body, attribute names, data types and values)
+func MessageSize(body string, attributes map[string]sqs_types.MessageAttributeValue) int {
+	size := len(body)
+	for name, attr := range attributes {
+		size += len(name) + len(aws_sdk.ToString(attr.DataType)) + len(aws_sdk.ToString(attr.StringValue)) + len(attr.BinaryValue)
+	}
+	return size
+}
+
+// Offload stores body to S3 and returns pointer message body together with copy of attributes
+// extended with AttributePayloadSize
+func (s *Store) Offload(ctx context.Context, body string, attributes map[string]sqs_types.MessageAttributeValue) (string, map[string]sqs_types.MessageAttributeValue, error) {
+	pointer := Pointer{Bucket: s.bucket, Key: s.keyPrefix + uuid.NewString()}
+	if _, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws_sdk.String(pointer.Bucket),
+		Key:    aws_sdk.String(pointer.Key),
+		Body:   bytes.NewReader([]byte(body)),
+	}); err != nil {
+		return "", nil, fmt.Errorf("cannot offload payload to s3://%s/%s: %w", pointer.Bucket, pointer.Key, err)
+	}
+
+	pointerBody, err := json.Marshal([]any{pointerClass, pointer})
+	if err != nil {
+		return "", nil, err
+	}
+
+	extendedAttributes := make(map[string]sqs_types.MessageAttributeValue, len(attributes)+1)
+	for name, attr := range attributes {
+		extendedAttributes[name] = attr
+	}
+	extendedAttributes[AttributePayloadSize] = sqs_types.MessageAttributeValue{
+		DataType:    aws_sdk.String("Number"),
+		StringValue: aws_sdk.String(strconv.Itoa(len(body))),
+	}
+	return string(pointerBody), extendedAttributes, nil
+}
+
+// IsOffloaded returns true if message with given attributes carries pointer to offloaded payload
+func IsOffloaded(attributes map[string]sqs_types.MessageAttributeValue) bool {
+	_, ok := attributes[AttributePayloadSize]
+	_, legacy := attributes[legacyAttributePayloadSize]
+	return ok || legacy
+}
+
+// ParsePointer parses pointer message body
+func ParsePointer(body string) (*Pointer, error) {
+	var parts []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &parts); err != nil || len(parts) != 2 {
+		return nil, errors.New("invalid payload pointer")
+	}
+
+	var pointer Pointer
+	if err := json.Unmarshal(parts[1], &pointer); err != nil || pointer.Bucket == "" || pointer.Key == "" {
+		return nil, errors.New("invalid payload pointer")
+	}
+	return &pointer, nil
+}
+
+// Resolve replaces body of offloaded message with payload loaded from S3, other messages are left untouched
+func (s *Store) Resolve(ctx context.Context, m *sqs_types.Message) error {
+	if !IsOffloaded(m.MessageAttributes) {
+		return nil
+	}
+
+	pointer, err := ParsePointer(aws_sdk.ToString(m.Body))
+	if err != nil {
+		return fmt.Errorf("cannot resolve message %s: %w", aws_sdk.ToString(m.MessageId), err)
+	}
+
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws_sdk.String(pointer.Bucket),
+		Key:    aws_sdk.String(pointer.Key),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot load payload from s3://%s/%s: %w", pointer.Bucket, pointer.Key, err)
+	}
+	defer out.Body.Close()
+
+	payload, err := io.ReadAll(out.Body)
+	if err != nil {
+		return fmt.Errorf("cannot load payload from s3://%s/%s: %w", pointer.Bucket, pointer.Key, err)
+	}
+	m.Body = aws_sdk.String(string(payload))
+	return nil
+}
@@ -0,0 +1,66 @@
+package extended_test
+
+import (
+	"bytes"
+	"context"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/extended"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeBucket keeps objects in memory
+type fakeBucket map[string][]byte
+
+func (b fakeBucket) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	b[aws_sdk.ToString(params.Key)] = body
+	return &s3.PutObjectOutput{}, err
+}
+
+func (b fakeBucket) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(b[aws_sdk.ToString(params.Key)]))}, nil
+}
+
+func TestOffloadAndResolve(t *testing.T) {
+	ctx := context.Background()
+	bucket := fakeBucket{}
+	store := extended.NewStore(bucket, "payloads", "matches/")
+	payload := strings.Repeat("x", extended.MaxMessageSize+1)
+	attributes := map[string]sqs_types.MessageAttributeValue{
+		"Type": {DataType: aws_sdk.String("String"), StringValue: aws_sdk.String("lineup")},
+	}
+
+	body, offloadedAttributes, err := store.Offload(ctx, payload, attributes)
+	assert.Nil(t, err)
+	assert.Len(t, bucket, 1)
+	assert.Len(t, attributes, 1)
+	assert.True(t, extended.IsOffloaded(offloadedAttributes))
+	assert.Less(t, extended.MessageSize(body, offloadedAttributes), 1024)
+
+	pointer, err := extended.ParsePointer(body)
+	assert.Nil(t, err)
+	assert.Equal(t, "payloads", pointer.Bucket)
+	assert.True(t, strings.HasPrefix(pointer.Key, "matches/"))
+
+	m := &sqs_types.Message{Body: aws_sdk.String(body), MessageAttributes: offloadedAttributes}
+	assert.Nil(t, store.Resolve(ctx, m))
+	assert.Equal(t, payload, aws_sdk.ToString(m.Body))
+
+	plain := &sqs_types.Message{Body: aws_sdk.String("{}")}
+	assert.Nil(t, store.Resolve(ctx, plain))
+	assert.Equal(t, "{}", aws_sdk.ToString(plain.Body))
+}
+
+func TestParsePointer(t *testing.T) {
+	pointer, err := extended.ParsePointer(`["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"b","s3Key":"k"}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, extended.Pointer{Bucket: "b", Key: "k"}, *pointer)
+
+	_, err = extended.ParsePointer(`{"matchId": 1}`)
+	assert.NotNil(t, err)
+}
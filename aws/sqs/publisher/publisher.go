@@ -0,0 +1,389 @@
+package publisher
+
+/*
+SQS publisher: messages published concurrently are coalesced into SendMessageBatch calls (up to 10 messages
+and 256KB per call). Entries failed by SQS are retried with exponential backoff unless SQS reports the failure
+as caused by the sender. Payloads exceeding SQS size limit are offloaded to S3 when PayloadStore is configured
+(see extended package), consumer with the same store resolves them transparently.
+Batches of FIFO queues are sent one after another to keep order of messages within message groups, messages
+of the same group are sent in separate calls (see batch package) so that retries cannot reorder them.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/batch"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/consumer"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/extended"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultFlushInterval      = 20 * time.Millisecond
+	DefaultMaxRetries         = 3
+	DefaultRetryBackoff       = 100 * time.Millisecond
+	DefaultSendTimeout        = 10 * time.Second
+	DefaultMaxBatchesInFlight = 10
+
+	sqsMaxBatchSize = 10
+	fifoQueueSuffix = ".fifo"
+)
+
+var (
+	// ErrPublisherClosed is returned when publishing to closed publisher
+	ErrPublisherClosed = errors.New("publisher closed")
+	// ErrMessageTooLarge is returned (wrapped) for messages exceeding SQS size limit when PayloadStore is not configured
+	ErrMessageTooLarge = errors.New("message too large")
+)
+
+// Client is subset of *sqs.Client used by publisher
+type Client interface {
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// Message is message to be published
+type Message struct {
+	Body       string
+	Attributes map[string]sqs_types.MessageAttributeValue
+	// GroupID is message group ID, required for FIFO queues
+	GroupID string
+	// DeduplicationID is FIFO deduplication ID, may be empty if the queue has content-based deduplication enabled
+	DeduplicationID string
+	// Delay postpones delivery of message, not supported by FIFO queues
+	Delay time.Duration
+}
+
+// Config configures publisher, zero values are replaced with defaults
+type Config struct {
+	QueueURL string
+	// FlushInterval is max time message waits for other messages to be sent together
+	FlushInterval time.Duration
+	// MaxRetries is max number of retries of failed batch entries, negative value disables retries
+	MaxRetries int
+	// RetryBackoff is delay before first retry, it doubles with every further retry
+	RetryBackoff time.Duration
+	// SendTimeout limits sending of single batch including retries
+	SendTimeout time.Duration
+	// MaxBatchesInFlight is max number of concurrently sent batches (standard queues only)
+	MaxBatchesInFlight int
+	// PayloadStore offloads messages exceeding SQS size limit to S3, optional
+	PayloadStore *extended.Store
+}
+
+// Publisher publishes messages to single queue
+type Publisher struct {
+	client   Client
+	cfg      Config
+	fifo     bool
+	requests chan *request
+	inFlight chan struct{}
+	batches  sync.WaitGroup
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type request struct {
+	entry  sqs_types.SendMessageBatchRequestEntry
+	size   int
+	result chan result
+}
+
+type result struct {
+	messageID string
+	err       error
+}
+
+// New creates publisher and starts its batching loop, use aws.CreateSqsClient to create the client.
+// Publisher must be closed with Close.
+func New(client Client, cfg Config) (*Publisher, error) {
+	if cfg.QueueURL == "" {
+		return nil, errors.New("publisher: queue url must be set")
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	} else if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = DefaultMaxRetries
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = DefaultSendTimeout
+	}
+	if cfg.MaxBatchesInFlight <= 0 {
+		cfg.MaxBatchesInFlight = DefaultMaxBatchesInFlight
+	}
+
+	p := &Publisher{
+		client:   client,
+		cfg:      cfg,
+		fifo:     strings.HasSuffix(cfg.QueueURL, fifoQueueSuffix),
+		requests: make(chan *request, sqsMaxBatchSize),
+		inFlight: make(chan struct{}, cfg.MaxBatchesInFlight),
+		done:     make(chan struct{}),
+	}
+	go p.loop()
+	return p, nil
+}
+
+// Publish sends message and returns its SQS message ID. Request ID from ctx (see consumer.WithRequestID)
+// is propagated in consumer.AttributeRequestID attribute unless message already has it.
+func (p *Publisher) Publish(ctx context.Context, m Message) (string, error) {
+	req, err := p.prepare(ctx, m)
+	if err != nil {
+		return "", err
+	}
+	if err := p.enqueue(ctx, req); err != nil {
+		return "", err
+	}
+
+	select {
+	case r := <-req.result:
+		return r.messageID, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// PublishBatch sends messages and returns their SQS message IDs, IDs of failed messages are empty.
+// Returned error joins errors of all failed messages.
+func (p *Publisher) PublishBatch(ctx context.Context, messages []Message) ([]string, error) {
+	ids := make([]string, len(messages))
+	errs := make([]error, len(messages))
+	requests := make([]*request, len(messages))
+	for i, m := range messages {
+		req, err := p.prepare(ctx, m)
+		if err == nil {
+			err = p.enqueue(ctx, req)
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		requests[i] = req
+	}
+
+	for i, req := range requests {
+		if req == nil {
+			continue
+		}
+		select {
+		case r := <-req.result:
+			ids[i], errs[i] = r.messageID, r.err
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+	return ids, errors.Join(errs...)
+}
+
+// Close stops accepting messages and waits until pending messages are sent or ctx is done
+func (p *Publisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.requests)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// prepare validates message, offloads its payload if needed and builds batch entry
+func (p *Publisher) prepare(ctx context.Context, m Message) (*request, error) {
+	if p.fifo && m.GroupID == "" {
+		return nil, errors.New("publisher: message group id is required for fifo queue")
+	}
+	if p.fifo && m.Delay > 0 {
+		return nil, errors.New("publisher: per-message delay is not supported by fifo queue")
+	}
+
+	body, attributes := m.Body, m.Attributes
+	if requestID := consumer.RequestID(ctx); requestID != "" {
+		if _, ok := attributes[consumer.AttributeRequestID]; !ok {
+			attributes = make(map[string]sqs_types.MessageAttributeValue, len(m.Attributes)+1)
+			for name, attr := range m.Attributes {
+				attributes[name] = attr
+			}
+			attributes[consumer.AttributeRequestID] = sqs_types.MessageAttributeValue{
+				DataType:    aws_sdk.String("String"),
+				StringValue: aws_sdk.String(requestID),
+			}
+		}
+	}
+
+	size := extended.MessageSize(body, attributes)
+	if size > extended.MaxMessageSize && p.cfg.PayloadStore != nil {
+		var err error
+		if body, attributes, err = p.cfg.PayloadStore.Offload(ctx, body, attributes); err != nil {
+			return nil, err
+		}
+		size = extended.MessageSize(body, attributes)
+	}
+	if size > extended.MaxMessageSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, size)
+	}
+
+	entry := sqs_types.SendMessageBatchRequestEntry{
+		MessageBody:       aws_sdk.String(body),
+		MessageAttributes: attributes,
+		DelaySeconds:      int32(m.Delay.Seconds()),
+	}
+	if m.GroupID != "" {
+		entry.MessageGroupId = aws_sdk.String(m.GroupID)
+	}
+	if m.DeduplicationID != "" {
+		entry.MessageDeduplicationId = aws_sdk.String(m.DeduplicationID)
+	}
+	return &request{entry: entry, size: size, result: make(chan result, 1)}, nil
+}
+
+func (p *Publisher) enqueue(ctx context.Context, req *request) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrPublisherClosed
+	}
+
+	select {
+	case p.requests <- req:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop collects requests into batches until requests channel is closed
+func (p *Publisher) loop() {
+	defer close(p.done)
+	defer p.batches.Wait()
+
+	var pending []*request
+	var size int
+	var flushC <-chan time.Time
+	flush := func() {
+		if len(pending) > 0 {
+			p.send(pending)
+		}
+		pending, size, flushC = nil, 0, nil
+	}
+
+	for {
+		select {
+		case req, ok := <-p.requests:
+			if !ok {
+				flush()
+				return
+			}
+			if size+req.size > extended.MaxMessageSize {
+				flush()
+			}
+			pending = append(pending, req)
+			size += req.size
+			if len(pending) == 1 {
+				flushC = time.After(p.cfg.FlushInterval)
+			}
+			if len(pending) == sqsMaxBatchSize {
+				flush()
+			}
+		case <-flushC:
+			flush()
+		}
+	}
+}
+
+// send sends batch synchronously for FIFO queues, asynchronously otherwise
+func (p *Publisher) send(batch []*request) {
+	if p.fifo {
+		p.sendBatch(batch)
+		return
+	}
+
+	p.inFlight <- struct{}{}
+	p.batches.Add(1)
+	go func() {
+		defer p.batches.Done()
+		defer func() { <-p.inFlight }()
+		p.sendBatch(batch)
+	}()
+}
+
+// sendBatch sends batch retrying failed entries, every request receives exactly one result
+func (p *Publisher) sendBatch(requests []*request) {
+	// sending is not bound to publishers' contexts, one cancelled publish must not fail others in the batch
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.SendTimeout)
+	defer cancel()
+
+	ids := make([]string, len(requests))
+	errs := make([]error, len(requests))
+	indexes := make([]int, len(requests))
+	for i := range requests {
+		indexes[i] = i
+	}
+
+	policy := batch.Policy{MaxRetries: p.cfg.MaxRetries, Backoff: p.cfg.RetryBackoff, Operation: "send message"}
+	if p.fifo {
+		policy.Group = func(index int) string { return aws_sdk.ToString(requests[index].entry.MessageGroupId) }
+	}
+	batch.Send(ctx, policy, indexes, func(ctx context.Context, indexes []int) (map[int]batch.Result, error) {
+		entries := make([]sqs_types.SendMessageBatchRequestEntry, len(indexes))
+		for i, index := range indexes {
+			entries[i] = requests[index].entry
+			entries[i].Id = aws_sdk.String(strconv.Itoa(index))
+		}
+
+		out, err := p.client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws_sdk.String(p.cfg.QueueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		results := make(map[int]batch.Result, len(indexes))
+		for _, ok := range out.Successful {
+			if i, valid := entryIndex(ok.Id, len(requests)); valid {
+				results[i] = batch.Result{ID: aws_sdk.ToString(ok.MessageId)}
+			}
+		}
+		for _, failed := range out.Failed {
+			i, valid := entryIndex(failed.Id, len(requests))
+			if _, answered := results[i]; !valid || answered {
+				continue
+			}
+			failedErr := fmt.Errorf("%s: %s", aws_sdk.ToString(failed.Code), aws_sdk.ToString(failed.Message))
+			if failed.SenderFault {
+				results[i] = batch.Result{Err: fmt.Errorf("sqs rejected message: %w", failedErr)}
+			} else {
+				results[i] = batch.Result{Err: failedErr, Retry: true}
+			}
+		}
+		return results, nil
+	}, ids, errs)
+
+	for i, req := range requests {
+		req.result <- result{messageID: ids[i], err: errs[i]}
+	}
+}
+
+func entryIndex(id *string, n int) (int, bool) {
+	i, err := strconv.Atoi(aws_sdk.ToString(id))
+	return i, err == nil && i >= 0 && i < n
+}
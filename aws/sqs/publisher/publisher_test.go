@@ -0,0 +1,173 @@
+package publisher_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/consumer"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/extended"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/publisher"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeQueue accepts batches, rejected entries fail permanently and transient ones fail once
+type fakeQueue struct {
+	mu        sync.Mutex
+	batches   [][]sqs_types.SendMessageBatchRequestEntry
+	transient map[string]bool
+	rejected  map[string]bool
+}
+
+func (q *fakeQueue) SendMessageBatch(_ context.Context, params *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.batches = append(q.batches, params.Entries)
+
+	out := &sqs.SendMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		body := aws_sdk.ToString(entry.MessageBody)
+		switch {
+		case q.rejected[body]:
+			out.Failed = append(out.Failed, sqs_types.BatchResultErrorEntry{Id: entry.Id, Code: aws_sdk.String("InvalidMessageContents"), SenderFault: true})
+		case q.transient[body]:
+			delete(q.transient, body)
+			out.Failed = append(out.Failed, sqs_types.BatchResultErrorEntry{Id: entry.Id, Code: aws_sdk.String("InternalError")})
+		default:
+			out.Successful = append(out.Successful, sqs_types.SendMessageBatchResultEntry{Id: entry.Id, MessageId: aws_sdk.String("id-" + body)})
+		}
+	}
+	return out, nil
+}
+
+func TestPublishCoalescesAndRetries(t *testing.T) {
+	ctx := context.Background()
+	queue := &fakeQueue{transient: map[string]bool{"3": true}, rejected: map[string]bool{"7": true}}
+	p, err := publisher.New(queue, publisher.Config{QueueURL: "queue", FlushInterval: 50 * time.Millisecond, RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+
+	messages := make([]publisher.Message, 12)
+	for i := range messages {
+		messages[i] = publisher.Message{Body: fmt.Sprint(i)}
+	}
+	ids, err := p.PublishBatch(ctx, messages)
+	assert.NotNil(t, err)
+	assert.Equal(t, "id-0", ids[0])
+	assert.Equal(t, "id-3", ids[3])
+	assert.Equal(t, "", ids[7])
+	assert.Equal(t, "id-11", ids[11])
+
+	assert.Nil(t, p.Close(ctx))
+	// 10 + 2 messages and retry of transient failure
+	assert.Len(t, queue.batches, 3)
+	assert.Len(t, queue.batches[0], 10)
+
+	_, err = p.Publish(ctx, publisher.Message{Body: "late"})
+	assert.True(t, errors.Is(err, publisher.ErrPublisherClosed))
+}
+
+func TestPublishKeepsOrderOfFifoGroups(t *testing.T) {
+	ctx := context.Background()
+	queue := &fakeQueue{transient: map[string]bool{"a2": true}, rejected: map[string]bool{"b1": true}}
+	p, err := publisher.New(queue, publisher.Config{QueueURL: "https://sqs/000/matches.fifo", FlushInterval: 50 * time.Millisecond, RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+
+	ids, err := p.PublishBatch(ctx, []publisher.Message{
+		{Body: "a1", GroupID: "a"}, {Body: "a2", GroupID: "a"}, {Body: "b1", GroupID: "b"}, {Body: "a3", GroupID: "a"}, {Body: "b2", GroupID: "b"},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"id-a1", "id-a2", "", "id-a3", ""}, ids)
+	assert.Nil(t, p.Close(ctx))
+
+	var sent []string
+	for _, batch := range queue.batches {
+		var bodies []string
+		for _, entry := range batch {
+			bodies = append(bodies, aws_sdk.ToString(entry.MessageBody))
+		}
+		sent = append(sent, strings.Join(bodies, ","))
+	}
+	// a3 waits for retried a2, b2 is not sent after rejected b1
+	assert.Equal(t, []string{"a1,b1", "a2", "a2", "a3"}, sent)
+}
+
+func TestPublishPropagatesRequestID(t *testing.T) {
+	queue := &fakeQueue{}
+	p, err := publisher.New(queue, publisher.Config{QueueURL: "queue"})
+	assert.Nil(t, err)
+	defer p.Close(context.Background())
+
+	_, err = p.Publish(consumer.WithRequestID(context.Background(), "req"), publisher.Message{Body: "m"})
+	assert.Nil(t, err)
+	assert.Equal(t, "req", aws_sdk.ToString(queue.batches[0][0].MessageAttributes[consumer.AttributeRequestID].StringValue))
+}
+
+func TestPublishValidatesFifoAndSize(t *testing.T) {
+	ctx := context.Background()
+	p, err := publisher.New(&fakeQueue{}, publisher.Config{QueueURL: "https://sqs/000/matches.fifo"})
+	assert.Nil(t, err)
+	defer p.Close(ctx)
+
+	_, err = p.Publish(ctx, publisher.Message{Body: "m"})
+	assert.NotNil(t, err)
+	_, err = p.Publish(ctx, publisher.Message{Body: "m", GroupID: "match-1", Delay: time.Second})
+	assert.NotNil(t, err)
+	_, err = p.Publish(ctx, publisher.Message{Body: strings.Repeat("x", extended.MaxMessageSize+1), GroupID: "match-1"})
+	assert.True(t, errors.Is(err, publisher.ErrMessageTooLarge))
+	id, err := p.Publish(ctx, publisher.Message{Body: "m", GroupID: "match-1", DeduplicationID: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "id-m", id)
+}
+
+func TstPublishOffloadsLargePayloads(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	c := test.SetupLocalstack(ctx)
+	ctx = aws.SetCustomAwsEndpoint(ctx, c.URI)
+	defer c.TeardownLocalstack()
+
+	sqsClient, err := aws.CreateSqsClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+	s3Client, err := aws.CreateS3Client(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+	_, err = s3Client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws_sdk.String("payloads")})
+	assert.Nil(t, err)
+	queue, err := sqsClient.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws_sdk.String("lineups")})
+	assert.Nil(t, err)
+
+	store := extended.NewStore(s3Client, "payloads", "lineups/")
+	p, err := publisher.New(sqsClient, publisher.Config{QueueURL: aws_sdk.ToString(queue.QueueUrl), PayloadStore: store})
+	assert.Nil(t, err)
+	payload := strings.Repeat("x", 300*1024)
+	_, err = p.PublishBatch(ctx, []publisher.Message{{Body: payload}, {Body: "small"}})
+	assert.Nil(t, err)
+	assert.Nil(t, p.Close(ctx))
+
+	runCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	var received []string
+	cons, err := consumer.New(sqsClient, consumer.Config{QueueURL: aws_sdk.ToString(queue.QueueUrl), WaitTime: time.Second, PayloadStore: store},
+		func(ctx context.Context, m *consumer.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, aws_sdk.ToString(m.Body))
+			if len(received) == 2 {
+				cancel()
+			}
+			return nil
+		})
+	assert.Nil(t, err)
+	_ = cons.Run(runCtx)
+	assert.ElementsMatch(t, []string{payload, "small"}, received)
+}
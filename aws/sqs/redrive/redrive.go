@@ -0,0 +1,245 @@
+package redrive
+
+/*
+Dead letter queue inspection and redrive. Redrive moves messages from DLQ back to their source queue
+in batches: messages are received from DLQ, sent to target queue and deleted from DLQ only once they were sent.
+Target queue is either given explicitly or taken from consumer.AttributeSourceQueue attribute set by consumer
+when it moved message to DLQ. Messages which were not moved (filtered out, failed) stay invisible
+in DLQ until VisibilityTimeout expires so that single run processes every message at most once.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/consumer"
+	"github.com/rs/zerolog/log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBatchSize         = 10
+	DefaultVisibilityTimeout = 5 * time.Minute
+
+	sqsMaxBatchSize = 10
+	fifoQueueSuffix = ".fifo"
+	receiveWaitTime = 1
+)
+
+// Client is subset of *sqs.Client used by redrive
+type Client interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+	DeleteMessageBatch(ctx context.Context, params *sqs.DeleteMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+	ChangeMessageVisibilityBatch(ctx context.Context, params *sqs.ChangeMessageVisibilityBatchInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error)
+}
+
+// Config configures redrive, zero values are replaced with defaults
+type Config struct {
+	// DeadLetterQueueURL is queue messages are moved from
+	DeadLetterQueueURL string
+	// TargetQueueURL is queue messages are moved to, if empty consumer.AttributeSourceQueue of every message is used
+	TargetQueueURL string
+	// BatchSize is number of messages moved at once (1-10)
+	BatchSize int
+	// MaxMessages limits number of moved messages, zero means all messages
+	MaxMessages int
+	// BatchInterval is pause between batches, use it to throttle load of consumers of target queue
+	BatchInterval time.Duration
+	// VisibilityTimeout is time messages are hidden in DLQ while being moved, it must exceed duration of the whole run
+	VisibilityTimeout time.Duration
+	// Filter selects messages to be moved, all messages are moved if nil
+	Filter func(m *sqs_types.Message) bool
+}
+
+// Result holds numbers of messages processed by redrive
+type Result struct {
+	Moved   int
+	Skipped int
+	Failed  int
+}
+
+// Redrive moves messages from DLQ until it is empty, MaxMessages are moved or ctx is done
+func Redrive(ctx context.Context, client Client, cfg Config) (Result, error) {
+	var result Result
+	if cfg.DeadLetterQueueURL == "" {
+		return result, errors.New("redrive: dead letter queue url must be set")
+	}
+	if cfg.BatchSize <= 0 || cfg.BatchSize > sqsMaxBatchSize {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = DefaultVisibilityTimeout
+	}
+
+	for cfg.MaxMessages <= 0 || result.Moved < cfg.MaxMessages {
+		batchSize := cfg.BatchSize
+		if cfg.MaxMessages > 0 {
+			batchSize = min(batchSize, cfg.MaxMessages-result.Moved)
+		}
+
+		messages, err := receive(ctx, client, cfg.DeadLetterQueueURL, batchSize, cfg.VisibilityTimeout)
+		if err != nil {
+			return result, err
+		}
+		if len(messages) == 0 {
+			return result, nil
+		}
+
+		byTarget := make(map[string][]sqs_types.Message)
+		for i := range messages {
+			m := &messages[i]
+			if cfg.Filter != nil && !cfg.Filter(m) {
+				result.Skipped++
+				continue
+			}
+			target := cfg.TargetQueueURL
+			if target == "" {
+				target = aws_sdk.ToString(m.MessageAttributes[consumer.AttributeSourceQueue].StringValue)
+			}
+			if target == "" {
+				log.Warn().Str("queue", cfg.DeadLetterQueueURL).Str("messageId", aws_sdk.ToString(m.MessageId)).
+					Msg("sqs redrive: message without source queue skipped")
+				result.Skipped++
+				continue
+			}
+			byTarget[target] = append(byTarget[target], *m)
+		}
+
+		for target, targetMessages := range byTarget {
+			moved, err := move(ctx, client, cfg.DeadLetterQueueURL, target, targetMessages)
+			result.Moved += moved
+			result.Failed += len(targetMessages) - moved
+			if err != nil {
+				log.Error().Err(err).Str("queue", cfg.DeadLetterQueueURL).Str("target", target).Msg("sqs redrive: cannot move messages")
+			}
+		}
+
+		if cfg.BatchInterval > 0 {
+			select {
+			case <-ctx.Done():
+				return result, ctx.Err()
+			case <-time.After(cfg.BatchInterval):
+			}
+		}
+	}
+	return result, nil
+}
+
+// Inspect returns up to maxMessages messages of the queue without removing them, messages are made visible
+// again once they are inspected. Receive counts of inspected messages are increased.
+func Inspect(ctx context.Context, client Client, queueURL string, maxMessages int) ([]sqs_types.Message, error) {
+	var inspected []sqs_types.Message
+	seen := make(map[string]bool)
+	defer func() {
+		// messages must become visible also when ctx was cancelled
+		resetCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		resetVisibility(resetCtx, client, queueURL, inspected)
+	}()
+
+	for len(inspected) < maxMessages {
+		messages, err := receive(ctx, client, queueURL, min(sqsMaxBatchSize, maxMessages-len(inspected)), DefaultVisibilityTimeout)
+		if err != nil {
+			return inspected, err
+		}
+		if len(messages) == 0 {
+			break
+		}
+		for _, m := range messages {
+			if !seen[aws_sdk.ToString(m.MessageId)] {
+				seen[aws_sdk.ToString(m.MessageId)] = true
+				inspected = append(inspected, m)
+			}
+		}
+	}
+	return inspected, nil
+}
+
+func receive(ctx context.Context, client Client, queueURL string, maxMessages int, visibilityTimeout time.Duration) ([]sqs_types.Message, error) {
+	out, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              aws_sdk.String(queueURL),
+		MaxNumberOfMessages:   int32(maxMessages),
+		WaitTimeSeconds:       receiveWaitTime,
+		VisibilityTimeout:     int32(visibilityTimeout.Seconds()),
+		MessageAttributeNames: []string{"All"},
+		AttributeNames:        []sqs_types.QueueAttributeName{sqs_types.QueueAttributeNameAll},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot receive messages from %s: %w", queueURL, err)
+	}
+	return out.Messages, nil
+}
+
+// move sends messages to target queue and deletes successfully sent ones from DLQ, returns number of moved messages
+func move(ctx context.Context, client Client, queueURL string, target string, messages []sqs_types.Message) (int, error) {
+	fifo := strings.HasSuffix(target, fifoQueueSuffix)
+	entries := make([]sqs_types.SendMessageBatchRequestEntry, len(messages))
+	for i, m := range messages {
+		entries[i] = sqs_types.SendMessageBatchRequestEntry{
+			Id:                aws_sdk.String(strconv.Itoa(i)),
+			MessageBody:       m.Body,
+			MessageAttributes: m.MessageAttributes,
+		}
+		if fifo {
+			entries[i].MessageGroupId = aws_sdk.String(m.Attributes[string(sqs_types.MessageSystemAttributeNameMessageGroupId)])
+			entries[i].MessageDeduplicationId = m.MessageId
+		}
+	}
+
+	out, err := client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{QueueUrl: aws_sdk.String(target), Entries: entries})
+	if err != nil {
+		return 0, err
+	}
+
+	deletes := make([]sqs_types.DeleteMessageBatchRequestEntry, 0, len(out.Successful))
+	for _, sent := range out.Successful {
+		if i, errParse := strconv.Atoi(aws_sdk.ToString(sent.Id)); errParse == nil && i < len(messages) {
+			deletes = append(deletes, sqs_types.DeleteMessageBatchRequestEntry{Id: sent.Id, ReceiptHandle: messages[i].ReceiptHandle})
+		}
+	}
+	for _, failed := range out.Failed {
+		err = errors.Join(err, fmt.Errorf("%s: %s", aws_sdk.ToString(failed.Code), aws_sdk.ToString(failed.Message)))
+	}
+	if len(deletes) == 0 {
+		return 0, err
+	}
+
+	// message already sent to target must not stay in DLQ, otherwise it would be moved twice
+	deleteCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	deleted, errDelete := client.DeleteMessageBatch(deleteCtx, &sqs.DeleteMessageBatchInput{QueueUrl: aws_sdk.String(queueURL), Entries: deletes})
+	if errDelete != nil {
+		return 0, errors.Join(err, fmt.Errorf("messages sent but not deleted from %s: %w", queueURL, errDelete))
+	}
+	for _, failed := range deleted.Failed {
+		err = errors.Join(err, fmt.Errorf("message sent but not deleted from %s: %s: %s", queueURL, aws_sdk.ToString(failed.Code), aws_sdk.ToString(failed.Message)))
+	}
+	return len(deleted.Successful), err
+}
+
+// resetVisibility makes messages visible again
+func resetVisibility(ctx context.Context, client Client, queueURL string, messages []sqs_types.Message) {
+	for start := 0; start < len(messages); start += sqsMaxBatchSize {
+		end := min(start+sqsMaxBatchSize, len(messages))
+		entries := make([]sqs_types.ChangeMessageVisibilityBatchRequestEntry, 0, end-start)
+		for i, m := range messages[start:end] {
+			entries = append(entries, sqs_types.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws_sdk.String(strconv.Itoa(i)),
+				ReceiptHandle:     m.ReceiptHandle,
+				VisibilityTimeout: 0,
+			})
+		}
+		if _, err := client.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws_sdk.String(queueURL),
+			Entries:  entries,
+		}); err != nil {
+			log.Warn().Err(err).Str("queue", queueURL).Msg("sqs redrive: cannot reset visibility of inspected messages")
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package redrive_test
+
+import (
+	"context"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/consumer"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/redrive"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// fakeQueues keeps messages of queues by url, received messages are invisible until deleted or made visible again
+type fakeQueues struct {
+	visible   map[string][]sqs_types.Message
+	invisible map[string]sqs_types.Message
+}
+
+func newFakeQueues(dlq []sqs_types.Message) *fakeQueues {
+	return &fakeQueues{visible: map[string][]sqs_types.Message{"dlq": dlq}, invisible: map[string]sqs_types.Message{}}
+}
+
+func (q *fakeQueues) ReceiveMessage(_ context.Context, params *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	queue := aws_sdk.ToString(params.QueueUrl)
+	n := min(int(params.MaxNumberOfMessages), len(q.visible[queue]))
+	messages := q.visible[queue][:n]
+	q.visible[queue] = q.visible[queue][n:]
+	for _, m := range messages {
+		q.invisible[aws_sdk.ToString(m.ReceiptHandle)] = m
+	}
+	return &sqs.ReceiveMessageOutput{Messages: messages}, nil
+}
+
+func (q *fakeQueues) SendMessageBatch(_ context.Context, params *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	queue := aws_sdk.ToString(params.QueueUrl)
+	out := &sqs.SendMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		q.visible[queue] = append(q.visible[queue], sqs_types.Message{Body: entry.MessageBody, MessageAttributes: entry.MessageAttributes})
+		out.Successful = append(out.Successful, sqs_types.SendMessageBatchResultEntry{Id: entry.Id})
+	}
+	return out, nil
+}
+
+func (q *fakeQueues) DeleteMessageBatch(_ context.Context, params *sqs.DeleteMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	out := &sqs.DeleteMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		delete(q.invisible, aws_sdk.ToString(entry.ReceiptHandle))
+		out.Successful = append(out.Successful, sqs_types.DeleteMessageBatchResultEntry{Id: entry.Id})
+	}
+	return out, nil
+}
+
+func (q *fakeQueues) ChangeMessageVisibilityBatch(_ context.Context, params *sqs.ChangeMessageVisibilityBatchInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityBatchOutput, error) {
+	queue := aws_sdk.ToString(params.QueueUrl)
+	for _, entry := range params.Entries {
+		q.visible[queue] = append(q.visible[queue], q.invisible[aws_sdk.ToString(entry.ReceiptHandle)])
+		delete(q.invisible, aws_sdk.ToString(entry.ReceiptHandle))
+	}
+	return &sqs.ChangeMessageVisibilityBatchOutput{}, nil
+}
+
+func deadLetters(n int) []sqs_types.Message {
+	messages := make([]sqs_types.Message, n)
+	for i := range messages {
+		source := "matches"
+		if i%2 == 1 {
+			source = "players"
+		}
+		messages[i] = sqs_types.Message{
+			MessageId:     aws_sdk.String(fmt.Sprint("m", i)),
+			ReceiptHandle: aws_sdk.String(fmt.Sprint("r", i)),
+			Body:          aws_sdk.String(fmt.Sprint(i)),
+			MessageAttributes: map[string]sqs_types.MessageAttributeValue{
+				consumer.AttributeSourceQueue: {DataType: aws_sdk.String("String"), StringValue: aws_sdk.String(source)},
+			},
+		}
+	}
+	return messages
+}
+
+func TestRedriveToSourceQueues(t *testing.T) {
+	queues := newFakeQueues(deadLetters(25))
+	result, err := redrive.Redrive(context.Background(), queues, redrive.Config{
+		DeadLetterQueueURL: "dlq",
+		BatchSize:          4,
+		Filter:             func(m *sqs_types.Message) bool { return aws_sdk.ToString(m.Body) != "0" },
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, redrive.Result{Moved: 24, Skipped: 1}, result)
+	assert.Len(t, queues.visible["matches"], 12)
+	assert.Len(t, queues.visible["players"], 12)
+	assert.Len(t, queues.invisible, 1)
+}
+
+func TestRedriveLimitsMessages(t *testing.T) {
+	queues := newFakeQueues(deadLetters(25))
+	result, err := redrive.Redrive(context.Background(), queues, redrive.Config{DeadLetterQueueURL: "dlq", TargetQueueURL: "retry", MaxMessages: 15})
+	assert.Nil(t, err)
+	assert.Equal(t, 15, result.Moved)
+	assert.Len(t, queues.visible["retry"], 15)
+	assert.Len(t, queues.visible["dlq"], 10)
+}
+
+func TestInspectKeepsMessages(t *testing.T) {
+	queues := newFakeQueues(deadLetters(25))
+	messages, err := redrive.Inspect(context.Background(), queues, "dlq", 12)
+	assert.Nil(t, err)
+	assert.Len(t, messages, 12)
+	assert.Len(t, queues.visible["dlq"], 25)
+	assert.Empty(t, queues.invisible)
+}
@@ -0,0 +1,104 @@
+package retry
+
+/*
+Retry policies of SQS consumer: failed message is made visible again after exponential backoff
+(by changing its visibility timeout) instead of after fixed queue visibility timeout. Permanent errors
+(see IsPermanent) are not retried, such messages are moved to dead letter queue right away.
+*/
+
+import (
+	"errors"
+	"fmt"
+	service_errors "github.com/hrsupersport/hrnogomet-backend-kit/errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/messaging"
+	"math"
+	"time"
+)
+
+const (
+	DefaultInitialBackoff = 5 * time.Second
+	DefaultMaxBackoff     = 15 * time.Minute
+	DefaultMultiplier     = 2.0
+
+	// MaxVisibilityTimeout is max visibility timeout supported by SQS
+	MaxVisibilityTimeout = 12 * time.Hour
+)
+
+// ErrPermanent is returned (wrapped) by Permanent
+var ErrPermanent = errors.New("permanent error")
+
+// Permanent marks error as permanent, message failing with it is not retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+// IsPermanent returns true for errors which cannot be fixed by retrying: errors marked with Permanent,
+// poison messages (messaging.ErrPoisonMessage) and bad request, unauthorized, forbidden and not implemented service errors
+func IsPermanent(err error) bool {
+	if errors.Is(err, ErrPermanent) || errors.Is(err, messaging.ErrPoisonMessage) {
+		return true
+	}
+
+	var badRequest *service_errors.ServiceErrorBadRequest
+	var unauthorized *service_errors.ServiceErrorUnauthorized
+	var forbidden *service_errors.ServiceErrorForbidden
+	var notImplemented *service_errors.ServiceErrorNotImplemented
+	return errors.As(err, &badRequest) || errors.As(err, &unauthorized) || errors.As(err, &forbidden) || errors.As(err, &notImplemented)
+}
+
+// Policy defines retries of failed messages, zero values are replaced with defaults
+type Policy struct {
+	// InitialBackoff is delay of first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps delay of retries (max MaxVisibilityTimeout)
+	MaxBackoff time.Duration
+	// Multiplier is growth factor of backoff between subsequent attempts
+	Multiplier float64
+	// MaxAttempts is number of attempts after which message is treated as permanently failed,
+	// zero leaves it to redrive policy of the queue
+	MaxAttempts int
+	// Classifier returns true for permanent errors, IsPermanent by default
+	Classifier func(err error) bool
+}
+
+// Backoff returns delay before next attempt of message which failed given (1-based) attempt
+func (p Policy) Backoff(attempt int) time.Duration {
+	initial, maxBackoff, multiplier := p.InitialBackoff, p.MaxBackoff, p.Multiplier
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+	maxBackoff = min(maxBackoff, MaxVisibilityTimeout)
+	if multiplier < 1 {
+		multiplier = DefaultMultiplier
+	}
+
+	backoff := float64(initial) * math.Pow(multiplier, float64(max(attempt, 1)-1))
+	if backoff >= float64(maxBackoff) {
+		return maxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// MaxDelay returns longest delay produced by Backoff
+func (p Policy) MaxDelay() time.Duration {
+	return p.Backoff(math.MaxInt32)
+}
+
+// IsPermanent classifies error using Classifier
+func (p Policy) IsPermanent(err error) bool {
+	if p.Classifier != nil {
+		return p.Classifier(err)
+	}
+	return IsPermanent(err)
+}
+
+// Exhausted returns true if message failed given (1-based) attempt and should not be retried anymore
+func (p Policy) Exhausted(attempt int) bool {
+	return p.MaxAttempts > 0 && attempt >= p.MaxAttempts
+}
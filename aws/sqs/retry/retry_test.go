@@ -0,0 +1,44 @@
+package retry_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/retry"
+	service_errors "github.com/hrsupersport/hrnogomet-backend-kit/errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/messaging"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := retry.Policy{InitialBackoff: time.Second, MaxBackoff: time.Minute, Multiplier: 3}
+	assert.Equal(t, time.Second, policy.Backoff(0))
+	assert.Equal(t, time.Second, policy.Backoff(1))
+	assert.Equal(t, 3*time.Second, policy.Backoff(2))
+	assert.Equal(t, 27*time.Second, policy.Backoff(4))
+	assert.Equal(t, time.Minute, policy.Backoff(5))
+	assert.Equal(t, time.Minute, policy.MaxDelay())
+
+	defaults := retry.Policy{}
+	assert.Equal(t, retry.DefaultInitialBackoff, defaults.Backoff(1))
+	assert.Equal(t, 2*retry.DefaultInitialBackoff, defaults.Backoff(2))
+	assert.Equal(t, retry.DefaultMaxBackoff, defaults.MaxDelay())
+	assert.False(t, defaults.Exhausted(100))
+	assert.True(t, retry.Policy{MaxAttempts: 3}.Exhausted(3))
+}
+
+func TestIsPermanent(t *testing.T) {
+	assert.True(t, retry.IsPermanent(retry.Permanent(errors.New("invalid"))))
+	assert.True(t, retry.IsPermanent(fmt.Errorf("handler: %w", messaging.ErrPoisonMessage)))
+	assert.True(t, retry.IsPermanent(fmt.Errorf("handler: %w", service_errors.NewServiceErrorBadRequest(nil, "invalid match"))))
+	assert.True(t, retry.IsPermanent(service_errors.NewServiceErrorForbidden(nil, "")))
+	assert.False(t, retry.IsPermanent(service_errors.NewServiceErrorConflict(nil, "")))
+	assert.False(t, retry.IsPermanent(service_errors.NewServiceErrorInternalServerError(nil, "")))
+	assert.False(t, retry.IsPermanent(errors.New("timeout")))
+	assert.Nil(t, retry.Permanent(nil))
+
+	custom := retry.Policy{Classifier: func(err error) bool { return err.Error() == "fatal" }}
+	assert.True(t, custom.IsPermanent(errors.New("fatal")))
+	assert.False(t, custom.IsPermanent(retry.Permanent(errors.New("invalid"))))
+}
@@ -0,0 +1,97 @@
+package main
+
+/*
+Command line DLQ inspection and redrive, e.g.
+
+	go run github.com/hrsupersport/hrnogomet-backend-kit/cmd/sqs-redrive -dlq https://sqs.eu-central-1.amazonaws.com/000000000000/matches-dlq inspect
+	go run github.com/hrsupersport/hrnogomet-backend-kit/cmd/sqs-redrive -dlq <dlq url> -batch-size 5 -interval 1s -max 100 redrive
+
+Commands: inspect, redrive
+*/
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/consumer"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/redrive"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/logging"
+	"github.com/rs/zerolog/log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	region := flag.String("region", constants.AwsDefaultRegion, "aws region")
+	endpoint := flag.String("endpoint", "", "custom aws endpoint, e.g. localstack")
+	dlq := flag.String("dlq", "", "dead letter queue url")
+	target := flag.String("target", "", "target queue url, defaults to source queue recorded in every message")
+	batchSize := flag.Int("batch-size", redrive.DefaultBatchSize, "number of messages moved at once (1-10)")
+	maxMessages := flag.Int("max", 0, "max number of messages to move (redrive) or show (inspect, default 10), 0 means all")
+	interval := flag.Duration("interval", 0, "pause between batches")
+	visibilityTimeout := flag.Duration("visibility-timeout", redrive.DefaultVisibilityTimeout, "time messages are hidden in dlq while being moved")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] inspect|redrive\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	logging.ConfigureDefaultLoggingSetup("")
+
+	if flag.NArg() != 1 || *dlq == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *endpoint != "" {
+		ctx = aws.SetCustomAwsEndpoint(ctx, *endpoint)
+	}
+
+	client, err := aws.CreateSqsClient(ctx, *region)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot create sqs client")
+	}
+
+	switch flag.Arg(0) {
+	case "inspect":
+		if *maxMessages <= 0 {
+			*maxMessages = 10
+		}
+		messages, err := redrive.Inspect(ctx, client, *dlq, *maxMessages)
+		if err != nil {
+			log.Fatal().Err(err).Msg("cannot inspect dead letter queue")
+		}
+		for _, m := range messages {
+			fmt.Printf("%s\treceived: %s\tsource: %s\treason: %s\n\t%s\n",
+				aws_sdk.ToString(m.MessageId),
+				m.Attributes[string(sqs_types.MessageSystemAttributeNameApproximateReceiveCount)],
+				aws_sdk.ToString(m.MessageAttributes[consumer.AttributeSourceQueue].StringValue),
+				aws_sdk.ToString(m.MessageAttributes[consumer.AttributeFailureReason].StringValue),
+				aws_sdk.ToString(m.Body))
+		}
+		fmt.Printf("%d message(s)\n", len(messages))
+	case "redrive":
+		result, err := redrive.Redrive(ctx, client, redrive.Config{
+			DeadLetterQueueURL: *dlq,
+			TargetQueueURL:     *target,
+			BatchSize:          *batchSize,
+			MaxMessages:        *maxMessages,
+			BatchInterval:      *interval,
+			VisibilityTimeout:  *visibilityTimeout,
+		})
+		fmt.Printf("moved: %d, skipped: %d, failed: %d\n", result.Moved, result.Skipped, result.Failed)
+		if err != nil {
+			log.Fatal().Err(err).Msg("redrive failed")
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -2,6 +2,10 @@ package constants
 
 type ContextKeyCustomAwsEndpoint struct{}
 
+type ContextKeyReadOnly struct{}
+
+type ContextKeyRequestID struct{}
+
 const (
 	AwsDefaultRegion = "eu-central-1"
 )
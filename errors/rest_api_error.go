@@ -39,6 +39,18 @@ func TranslateServiceErrorToAPIError(ctx *gin.Context, err error, includeDetails
 		return
 	}
 
+	var target5 *ServiceErrorConflict
+	if eris.As(err, &target5) {
+		ReturnConflictError(ctx, err, includeDetails)
+		return
+	}
+
+	var target6 *ServiceErrorBadRequest
+	if eris.As(err, &target6) {
+		ReturnBadRequestError(ctx, err, includeDetails)
+		return
+	}
+
 	ReturnInternalServerError(ctx, err, includeDetails)
 }
 
@@ -68,6 +80,10 @@ func ReturnNotFoundError(c *gin.Context, err error, includeDetails bool) {
 	c.JSON(http.StatusNotFound, getGinH(err, includeDetails))
 }
 
+func ReturnConflictError(c *gin.Context, err error, includeDetails bool) {
+	c.JSON(http.StatusConflict, getGinH(err, includeDetails))
+}
+
 func ReturnUnauthorizedError(c *gin.Context, err error, includeDetails bool) {
 	c.JSON(http.StatusUnauthorized, getGinH(err, includeDetails))
 }
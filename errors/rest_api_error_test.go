@@ -102,6 +102,28 @@ func TestTranslateToHttpError404_x_x(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
+func TestTranslateToHttpError409(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	serviceError := NewServiceErrorConflict(errorHelper.New("duplicate key value violates unique constraint"), "")
+
+	TranslateServiceErrorToAPIError(c, serviceError, includeErrorDetails)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestTranslateToHttpError400(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	serviceError := NewServiceErrorBadRequest(nil, "invalid cursor")
+
+	TranslateServiceErrorToAPIError(c, serviceError, includeErrorDetails)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
 func TestTranslateToHttpErrorNormalError(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	w := httptest.NewRecorder()
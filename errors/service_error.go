@@ -80,6 +80,23 @@ func (e *ServiceErrorBadRequest) SetNestedError(err error) {
 	e.NestedError = err
 }
 
+type ServiceErrorConflict struct {
+	ErrorText   string
+	NestedError error
+}
+
+func (e *ServiceErrorConflict) Error() string {
+	return e.ErrorText
+}
+
+func (e *ServiceErrorConflict) SetErrorText(text string) {
+	e.ErrorText = text
+}
+
+func (e *ServiceErrorConflict) SetNestedError(err error) {
+	e.NestedError = err
+}
+
 type ServiceErrorNotImplemented struct {
 	ErrorText   string
 	NestedError error
@@ -145,6 +162,10 @@ func NewServiceErrorBadRequest(nestedBackendError error, customMessage string) e
 	return newServiceError(nestedBackendError, customMessage, "SERVICE_ERROR_BAD_REQUEST", &ServiceErrorBadRequest{})
 }
 
+func NewServiceErrorConflict(nestedBackendError error, customMessage string) error {
+	return newServiceError(nestedBackendError, customMessage, "SERVICE_ERROR_CONFLICT", &ServiceErrorConflict{})
+}
+
 func NewServiceErrorNotImplemented(nestedBackendError error, customMessage string) error {
 	return newServiceError(nestedBackendError, customMessage, "SERVICE_ERROR_NOT_IMPLEMENTED", &ServiceErrorNotImplemented{})
 }
@@ -0,0 +1,187 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodb_types "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strconv"
+	"time"
+)
+
+// attributes of idempotency table items, AttributeExpiresAt (epoch seconds) should be configured as table TTL attribute
+const (
+	AttributeKey         = "key"
+	AttributeStatus      = "status"
+	AttributeToken       = "token"
+	AttributeFingerprint = "fingerprint"
+	AttributeResponse    = "response"
+	AttributeExpiresAt   = "expiresAt"
+)
+
+// DynamodbClient is subset of *dynamodb.Client used by DynamodbStore
+type DynamodbClient interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DynamodbStore keeps idempotency records in DynamoDB table with string partition key AttributeKey
+type DynamodbStore struct {
+	client DynamodbClient
+	table  string
+}
+
+// NewDynamodbStore creates store, use aws.CreateDynamodbClient to create the client
+// and CreateDynamodbTable to create the table
+func NewDynamodbStore(client DynamodbClient, table string) *DynamodbStore {
+	return &DynamodbStore{client: client, table: table}
+}
+
+// CreateDynamodbTable creates on-demand idempotency table with TTL enabled on AttributeExpiresAt
+func CreateDynamodbTable(ctx context.Context, client *dynamodb.Client, table string) error {
+	if _, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws_sdk.String(table),
+		BillingMode:          dynamodb_types.BillingModePayPerRequest,
+		AttributeDefinitions: []dynamodb_types.AttributeDefinition{{AttributeName: aws_sdk.String(AttributeKey), AttributeType: dynamodb_types.ScalarAttributeTypeS}},
+		KeySchema:            []dynamodb_types.KeySchemaElement{{AttributeName: aws_sdk.String(AttributeKey), KeyType: dynamodb_types.KeyTypeHash}},
+	}); err != nil {
+		return err
+	}
+
+	if err := dynamodb.NewTableExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws_sdk.String(table)}, time.Minute); err != nil {
+		return err
+	}
+
+	_, err := client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws_sdk.String(table),
+		TimeToLiveSpecification: &dynamodb_types.TimeToLiveSpecification{
+			AttributeName: aws_sdk.String(AttributeExpiresAt),
+			Enabled:       aws_sdk.Bool(true),
+		},
+	})
+	return err
+}
+
+// Claim puts in-progress record if there is no record of the key or the record expired
+// (DynamoDB deletes expired items with delay)
+func (s *DynamodbStore) Claim(ctx context.Context, record Record) (*Record, error) {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws_sdk.String(s.table),
+		Item: map[string]dynamodb_types.AttributeValue{
+			AttributeKey:         &dynamodb_types.AttributeValueMemberS{Value: record.Key},
+			AttributeStatus:      &dynamodb_types.AttributeValueMemberS{Value: string(record.Status)},
+			AttributeToken:       &dynamodb_types.AttributeValueMemberS{Value: record.Token},
+			AttributeFingerprint: &dynamodb_types.AttributeValueMemberS{Value: record.Fingerprint},
+			AttributeExpiresAt:   epochSeconds(record.ExpiresAt),
+		},
+		ConditionExpression:                 aws_sdk.String("attribute_not_exists(#key) OR #expiresAt < :now"),
+		ExpressionAttributeNames:            map[string]string{"#key": AttributeKey, "#expiresAt": AttributeExpiresAt},
+		ExpressionAttributeValues:           map[string]dynamodb_types.AttributeValue{":now": epochSeconds(time.Now())},
+		ReturnValuesOnConditionCheckFailure: dynamodb_types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err == nil {
+		return nil, nil
+	}
+
+	var conditionFailedErr *dynamodb_types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionFailedErr) {
+		return nil, fmt.Errorf("cannot claim idempotency key %s: %w", record.Key, err)
+	}
+	item := conditionFailedErr.Item
+	if item == nil {
+		// older DynamoDB implementations (e.g. localstack) do not return the item
+		out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws_sdk.String(s.table),
+			Key:            map[string]dynamodb_types.AttributeValue{AttributeKey: &dynamodb_types.AttributeValueMemberS{Value: record.Key}},
+			ConsistentRead: aws_sdk.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot read idempotency key %s: %w", record.Key, err)
+		}
+		if out.Item == nil {
+			// released in the meantime
+			return s.Claim(ctx, record)
+		}
+		item = out.Item
+	}
+	return recordFromItem(item)
+}
+
+// Complete stores response and retention expiry of record claimed with given token
+func (s *DynamodbStore) Complete(ctx context.Context, key string, token string, response []byte, expiresAt time.Time) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws_sdk.String(s.table),
+		Key:                      map[string]dynamodb_types.AttributeValue{AttributeKey: &dynamodb_types.AttributeValueMemberS{Value: key}},
+		UpdateExpression:         aws_sdk.String("SET #status = :completed, #response = :response, #expiresAt = :expiresAt"),
+		ConditionExpression:      aws_sdk.String("#token = :token"),
+		ExpressionAttributeNames: map[string]string{"#token": AttributeToken, "#status": AttributeStatus, "#response": AttributeResponse, "#expiresAt": AttributeExpiresAt},
+		ExpressionAttributeValues: map[string]dynamodb_types.AttributeValue{
+			":token":     &dynamodb_types.AttributeValueMemberS{Value: token},
+			":completed": &dynamodb_types.AttributeValueMemberS{Value: string(StatusCompleted)},
+			":response":  &dynamodb_types.AttributeValueMemberB{Value: response},
+			":expiresAt": epochSeconds(expiresAt),
+		},
+	})
+	var conditionFailedErr *dynamodb_types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailedErr) {
+		return fmt.Errorf("cannot complete idempotency key %s: %w", key, ErrClaimLost)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot complete idempotency key %s: %w", key, err)
+	}
+	return nil
+}
+
+// Release deletes record claimed with given token unless it was completed
+func (s *DynamodbStore) Release(ctx context.Context, key string, token string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                aws_sdk.String(s.table),
+		Key:                      map[string]dynamodb_types.AttributeValue{AttributeKey: &dynamodb_types.AttributeValueMemberS{Value: key}},
+		ConditionExpression:      aws_sdk.String("#status = :inProgress AND #token = :token"),
+		ExpressionAttributeNames: map[string]string{"#status": AttributeStatus, "#token": AttributeToken},
+		ExpressionAttributeValues: map[string]dynamodb_types.AttributeValue{
+			":inProgress": &dynamodb_types.AttributeValueMemberS{Value: string(StatusInProgress)},
+			":token":      &dynamodb_types.AttributeValueMemberS{Value: token},
+		},
+	})
+	var conditionFailedErr *dynamodb_types.ConditionalCheckFailedException
+	if err != nil && !errors.As(err, &conditionFailedErr) {
+		return fmt.Errorf("cannot release idempotency key %s: %w", key, err)
+	}
+	return nil
+}
+
+func epochSeconds(t time.Time) *dynamodb_types.AttributeValueMemberN {
+	return &dynamodb_types.AttributeValueMemberN{Value: strconv.FormatInt(t.Unix(), 10)}
+}
+
+func recordFromItem(item map[string]dynamodb_types.AttributeValue) (*Record, error) {
+	record := &Record{}
+	if v, ok := item[AttributeKey].(*dynamodb_types.AttributeValueMemberS); ok {
+		record.Key = v.Value
+	}
+	if v, ok := item[AttributeStatus].(*dynamodb_types.AttributeValueMemberS); ok {
+		record.Status = Status(v.Value)
+	}
+	if v, ok := item[AttributeToken].(*dynamodb_types.AttributeValueMemberS); ok {
+		record.Token = v.Value
+	}
+	if v, ok := item[AttributeFingerprint].(*dynamodb_types.AttributeValueMemberS); ok {
+		record.Fingerprint = v.Value
+	}
+	if v, ok := item[AttributeResponse].(*dynamodb_types.AttributeValueMemberB); ok {
+		record.Response = v.Value
+	}
+	if v, ok := item[AttributeExpiresAt].(*dynamodb_types.AttributeValueMemberN); ok {
+		seconds, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid idempotency record %s: %w", record.Key, err)
+		}
+		record.ExpiresAt = time.Unix(seconds, 0)
+	}
+	return record, nil
+}
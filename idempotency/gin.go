@@ -0,0 +1,185 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	service_errors "github.com/hrsupersport/hrnogomet-backend-kit/errors"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+)
+
+const (
+	// HeaderIdempotencyKey is request header carrying idempotency key
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set on responses replayed from idempotency store
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+	// AuthSubjectKey is gin context key under which authentication middleware stores subject (user or client ID)
+	// of the request, see AuthSubjectKeyScope
+	AuthSubjectKey = "authSubject"
+)
+
+// errServerError releases key of request which failed with 5xx status so that client can retry it
+var errServerError = errors.New("server error response")
+
+// storedResponse is response stored in idempotency record
+type storedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// responseRecorder copies response body written by handlers
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// ginOptions are options of GinMiddleware
+type ginOptions struct {
+	keyScope func(c *gin.Context) string
+}
+
+// GinOption configures GinMiddleware
+type GinOption func(o *ginOptions)
+
+// WithKeyScope sets function returning scope of idempotency keys of request (e.g. caller's user or tenant ID),
+// keys are unique within scope only so that callers cannot replay or block each other's requests.
+// AuthSubjectKeyScope is used by default.
+func WithKeyScope(keyScope func(c *gin.Context) string) GinOption {
+	return func(o *ginOptions) { o.keyScope = keyScope }
+}
+
+// AuthSubjectKeyScope scopes keys by subject stored under AuthSubjectKey by authentication middleware,
+// requests without subject are scoped by their Authorization header (empty scope for anonymous requests)
+func AuthSubjectKeyScope(c *gin.Context) string {
+	if subject := c.GetString(AuthSubjectKey); subject != "" {
+		return subject
+	}
+	if authorization := c.GetHeader("Authorization"); authorization != "" {
+		return "authorization:" + hash([]byte(authorization))
+	}
+	return ""
+}
+
+// GinMiddleware handles POST, PUT, PATCH and DELETE requests with Idempotency-Key header at most once, response
+// of the first request is replayed for repeated ones. Requests without the header are passed through.
+// Key reused for different request (method, path or body) gets 422, key of request still being handled gets 409.
+// Keys are scoped per caller, see WithKeyScope. Responses with 5xx status are not stored.
+func GinMiddleware(g *Guard, opts ...GinOption) gin.HandlerFunc {
+	o := ginOptions{keyScope: AuthSubjectKeyScope}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(HeaderIdempotencyKey)
+		if key == "" || !isUnsafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		// scope is hashed so that keys of different scopes cannot collide
+		key = hash([]byte(o.keyScope(c))) + ":" + key
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			service_errors.ReturnBadRequestError(c, err, false)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		handled := false
+		response, replayed, err := g.Do(c.Request.Context(), key, requestFingerprint(c, body), func(ctx context.Context) ([]byte, error) {
+			handled = true
+			recorder := &responseRecorder{ResponseWriter: c.Writer}
+			c.Writer = recorder
+			c.Next()
+			c.Writer = recorder.ResponseWriter
+
+			if recorder.Status() >= http.StatusInternalServerError {
+				return nil, errServerError
+			}
+			return json.Marshal(storedResponse{
+				Status: recorder.Status(),
+				Header: recorder.Header().Clone(),
+				Body:   recorder.body.Bytes(),
+			})
+		})
+
+		switch {
+		case handled:
+			// response was already written by handlers
+			if err != nil && !errors.Is(err, errServerError) {
+				log.Warn().Err(err).Str("key", key).Msg("idempotency: cannot store response")
+			}
+		case errors.Is(err, ErrFingerprintMismatch):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrInProgress):
+			service_errors.ReturnConflictError(c, err, false)
+			c.Abort()
+		case err != nil:
+			service_errors.ReturnInternalServerError(c, err, false)
+			c.Abort()
+		case replayed:
+			replay(c, response)
+		}
+	}
+}
+
+func replay(c *gin.Context, response []byte) {
+	var stored storedResponse
+	if err := json.Unmarshal(response, &stored); err != nil {
+		service_errors.ReturnInternalServerError(c, err, false)
+		c.Abort()
+		return
+	}
+
+	for name, values := range stored.Header {
+		c.Writer.Header()[name] = values
+	}
+	c.Header(HeaderIdempotentReplayed, "true")
+	c.Writer.WriteHeader(stored.Status)
+	_, _ = c.Writer.Write(stored.Body)
+	c.Abort()
+}
+
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// requestFingerprint hashes method, path and body of request
+func requestFingerprint(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(c.Request.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
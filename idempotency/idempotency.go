@@ -0,0 +1,129 @@
+package idempotency
+
+/*
+Idempotency guard: operation identified by idempotency key (e.g. message or envelope ID, Idempotency-Key header)
+is run at most once within TTL, repeated calls get stored response of the first call. Before the operation runs
+its key is claimed by conditional write creating in-progress record, concurrent duplicates therefore get
+ErrInProgress instead of running the operation twice. In-progress record expires after LockTTL so that keys
+of crashed processes can be claimed again, failed operations release their keys right away. Record is completed
+or released only by the call holding its claim (see Record.Token), call outliving LockTTL cannot overwrite record
+of the call which claimed the key after it.
+Records are kept in DynamoDB (see DynamodbStore) or postgres (see PostgresStore).
+*/
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+const (
+	DefaultLockTTL = 5 * time.Minute
+	DefaultTTL     = 24 * time.Hour
+)
+
+var (
+	// ErrInProgress is returned when the same key is being processed by another call
+	ErrInProgress = errors.New("idempotency key is being processed")
+	// ErrFingerprintMismatch is returned when key is reused for different request
+	ErrFingerprintMismatch = errors.New("idempotency key reused with different request")
+	// ErrClaimLost is returned (wrapped) by Store.Complete when claim expired and key was claimed by another call
+	ErrClaimLost = errors.New("idempotency key claim lost")
+)
+
+// Status is state of idempotency record
+type Status string
+
+const (
+	StatusInProgress Status = "IN_PROGRESS"
+	StatusCompleted  Status = "COMPLETED"
+)
+
+// Record is stored state of single idempotency key
+type Record struct {
+	Key    string
+	Status Status
+	// Token identifies claim, only the call which claimed the key can complete or release it
+	Token       string
+	Fingerprint string
+	Response    []byte
+	// ExpiresAt is expiry of in-progress lock or of completed record
+	ExpiresAt time.Time
+}
+
+// Store persists idempotency records
+type Store interface {
+	// Claim creates in-progress record unless unexpired record of the same key exists, existing record is returned then
+	Claim(ctx context.Context, record Record) (*Record, error)
+	// Complete marks record completed storing response of the operation if it is still claimed with given token,
+	// error wrapping ErrClaimLost is returned otherwise
+	Complete(ctx context.Context, key string, token string, response []byte, expiresAt time.Time) error
+	// Release deletes in-progress record so that key can be claimed again, record claimed with other token is kept
+	Release(ctx context.Context, key string, token string) error
+}
+
+// Config configures guard, zero values are replaced with defaults
+type Config struct {
+	// LockTTL is max duration of operation, key of operation running longer can be claimed by another call
+	LockTTL time.Duration
+	// TTL is retention of completed records, duplicates arriving later are processed again
+	TTL time.Duration
+}
+
+// Guard runs operations at most once per idempotency key
+type Guard struct {
+	store Store
+	cfg   Config
+}
+
+// New creates guard storing records in given store
+func New(store Store, cfg Config) *Guard {
+	if cfg.LockTTL <= 0 {
+		cfg.LockTTL = DefaultLockTTL
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	return &Guard{store: store, cfg: cfg}
+}
+
+// Do runs fn unless key was already processed, in which case stored response is returned with replayed set to true.
+// Fingerprint identifies request (e.g. hash of payload), key reused with different fingerprint fails
+// with ErrFingerprintMismatch. Key of failed fn is released and error of fn is returned.
+func (g *Guard) Do(ctx context.Context, key string, fingerprint string, fn func(ctx context.Context) ([]byte, error)) (response []byte, replayed bool, err error) {
+	token := uuid.NewString()
+	existing, err := g.store.Claim(ctx, Record{
+		Key:         key,
+		Status:      StatusInProgress,
+		Token:       token,
+		Fingerprint: fingerprint,
+		ExpiresAt:   time.Now().Add(g.cfg.LockTTL),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		if existing.Fingerprint != fingerprint {
+			return nil, false, ErrFingerprintMismatch
+		}
+		if existing.Status != StatusCompleted {
+			return nil, false, ErrInProgress
+		}
+		return existing.Response, true, nil
+	}
+
+	response, err = fn(ctx)
+	// record must be updated also when ctx was cancelled, otherwise key stays locked until LockTTL expires
+	storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err != nil {
+		return nil, false, errors.Join(err, g.store.Release(storeCtx, key, token))
+	}
+	// operation already succeeded, failing it now would only make caller retry it
+	if err := g.store.Complete(storeCtx, key, token, response, time.Now().Add(g.cfg.TTL)); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("idempotency: cannot complete record, duplicates may be processed after lock expires")
+	}
+	return response, false, nil
+}
@@ -0,0 +1,282 @@
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/gin-gonic/gin"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/consumer"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/idempotency"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps records in memory
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]idempotency.Record
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: make(map[string]idempotency.Record)}
+}
+
+func (s *memoryStore) Claim(_ context.Context, record idempotency.Record) (*idempotency.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.records[record.Key]; ok && existing.ExpiresAt.After(time.Now()) {
+		return &existing, nil
+	}
+	s.records[record.Key] = record
+	return nil, nil
+}
+
+func (s *memoryStore) Complete(_ context.Context, key string, token string, response []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	if !ok || record.Token != token {
+		return idempotency.ErrClaimLost
+	}
+	record.Status, record.Response, record.ExpiresAt = idempotency.StatusCompleted, response, expiresAt
+	s.records[key] = record
+	return nil
+}
+
+func (s *memoryStore) Release(_ context.Context, key string, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[key]; ok && record.Token == token && record.Status == idempotency.StatusInProgress {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+func TestGuardRunsOnce(t *testing.T) {
+	ctx := context.Background()
+	guard := idempotency.New(newMemoryStore(), idempotency.Config{})
+
+	calls := 0
+	fn := func(ctx context.Context) ([]byte, error) {
+		calls++
+		return []byte("done"), nil
+	}
+	response, replayed, err := guard.Do(ctx, "k", "f", fn)
+	assert.Nil(t, err)
+	assert.False(t, replayed)
+	assert.Equal(t, "done", string(response))
+
+	response, replayed, err = guard.Do(ctx, "k", "f", fn)
+	assert.Nil(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, "done", string(response))
+	assert.Equal(t, 1, calls)
+
+	_, _, err = guard.Do(ctx, "k", "other", fn)
+	assert.True(t, errors.Is(err, idempotency.ErrFingerprintMismatch))
+}
+
+func TestGuardRejectsConcurrentDuplicateAndReleasesFailedKey(t *testing.T) {
+	ctx := context.Background()
+	guard := idempotency.New(newMemoryStore(), idempotency.Config{})
+	handlerErr := errors.New("db down")
+
+	_, _, err := guard.Do(ctx, "k", "", func(ctx context.Context) ([]byte, error) {
+		_, _, err := guard.Do(ctx, "k", "", func(ctx context.Context) ([]byte, error) { return nil, nil })
+		assert.True(t, errors.Is(err, idempotency.ErrInProgress))
+		return nil, handlerErr
+	})
+	assert.True(t, errors.Is(err, handlerErr))
+
+	_, replayed, err := guard.Do(ctx, "k", "", func(ctx context.Context) ([]byte, error) { return nil, nil })
+	assert.Nil(t, err)
+	assert.False(t, replayed)
+}
+
+func TestGuardDoesNotOverwriteRecordOfReclaimedKey(t *testing.T) {
+	ctx := context.Background()
+	guard := idempotency.New(newMemoryStore(), idempotency.Config{LockTTL: time.Millisecond})
+
+	_, _, err := guard.Do(ctx, "k", "", func(ctx context.Context) ([]byte, error) {
+		// operation outlives its claim, duplicate claims the key and completes first
+		time.Sleep(5 * time.Millisecond)
+		_, replayed, err := guard.Do(ctx, "k", "", func(ctx context.Context) ([]byte, error) { return []byte("second"), nil })
+		assert.Nil(t, err)
+		assert.False(t, replayed)
+		return []byte("first"), nil
+	})
+	assert.Nil(t, err)
+
+	response, replayed, err := guard.Do(ctx, "k", "", func(ctx context.Context) ([]byte, error) { return nil, nil })
+	assert.Nil(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, "second", string(response))
+}
+
+func TestMessageHandlerSkipsDuplicates(t *testing.T) {
+	guard := idempotency.New(newMemoryStore(), idempotency.Config{})
+	handled := 0
+	handler := idempotency.MessageHandler(guard, idempotency.MessageID, func(ctx context.Context, m *consumer.Message) error {
+		handled++
+		return nil
+	})
+
+	m := &consumer.Message{MessageId: aws_sdk.String("m1")}
+	assert.Nil(t, handler(context.Background(), m))
+	assert.Nil(t, handler(context.Background(), m))
+	assert.Equal(t, 1, handled)
+}
+
+func TestGinMiddlewareReplaysResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	created := 0
+	router := gin.New()
+	router.Use(idempotency.GinMiddleware(idempotency.New(newMemoryStore(), idempotency.Config{})))
+	router.POST("/matches", func(c *gin.Context) {
+		created++
+		c.Header("Location", fmt.Sprint("/matches/", created))
+		c.JSON(http.StatusCreated, gin.H{"id": created})
+	})
+	router.POST("/failing", func(c *gin.Context) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "db down"})
+	})
+
+	post := func(path string, key string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(idempotency.HeaderIdempotencyKey, key)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := post("/matches", "k1", `{"home":"Dinamo"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	replayed := post("/matches", "k1", `{"home":"Dinamo"}`)
+	assert.Equal(t, http.StatusCreated, replayed.Code)
+	assert.Equal(t, first.Body.String(), replayed.Body.String())
+	assert.Equal(t, "/matches/1", replayed.Header().Get("Location"))
+	assert.Equal(t, "true", replayed.Header().Get(idempotency.HeaderIdempotentReplayed))
+	assert.Equal(t, 1, created)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, post("/matches", "k1", `{"home":"Hajduk"}`).Code)
+	assert.Equal(t, http.StatusCreated, post("/matches", "k2", `{"home":"Hajduk"}`).Code)
+	assert.Equal(t, 2, created)
+
+	// 5xx responses are not stored
+	assert.Equal(t, http.StatusServiceUnavailable, post("/failing", "k3", "").Code)
+	assert.Empty(t, post("/failing", "k3", "").Header().Get(idempotency.HeaderIdempotentReplayed))
+}
+
+func testStore(t *testing.T, store idempotency.Store) {
+	ctx := context.Background()
+	record := idempotency.Record{Key: "k", Status: idempotency.StatusInProgress, Token: "t1", Fingerprint: "f", ExpiresAt: time.Now().Add(time.Minute)}
+
+	existing, err := store.Claim(ctx, record)
+	assert.Nil(t, err)
+	assert.Nil(t, existing)
+	existing, err = store.Claim(ctx, record)
+	assert.Nil(t, err)
+	assert.Equal(t, idempotency.StatusInProgress, existing.Status)
+
+	// only the claimer can complete or release the record
+	assert.Nil(t, store.Release(ctx, "k", "other"))
+	err = store.Complete(ctx, "k", "other", []byte("other"), time.Now().Add(time.Hour))
+	assert.True(t, errors.Is(err, idempotency.ErrClaimLost))
+	assert.Nil(t, store.Complete(ctx, "k", "t1", []byte("done"), time.Now().Add(time.Hour)))
+	assert.Nil(t, store.Release(ctx, "k", "t1"))
+	existing, err = store.Claim(ctx, record)
+	assert.Nil(t, err)
+	assert.Equal(t, idempotency.StatusCompleted, existing.Status)
+	assert.Equal(t, "done", string(existing.Response))
+
+	expired := idempotency.Record{Key: "expired", Status: idempotency.StatusInProgress, Token: "t1", ExpiresAt: time.Now().Add(-time.Minute)}
+	_, err = store.Claim(ctx, expired)
+	assert.Nil(t, err)
+	reclaimed := expired
+	reclaimed.Token = "t2"
+	existing, err = store.Claim(ctx, reclaimed)
+	assert.Nil(t, err)
+	assert.Nil(t, existing)
+
+	// call whose claim expired cannot overwrite or release record of the call which reclaimed the key
+	err = store.Complete(ctx, "expired", "t1", []byte("late"), time.Now().Add(time.Hour))
+	assert.True(t, errors.Is(err, idempotency.ErrClaimLost))
+	assert.Nil(t, store.Release(ctx, "expired", "t1"))
+	assert.Nil(t, store.Complete(ctx, "expired", "t2", []byte("done"), time.Now().Add(-time.Minute)))
+}
+
+func TestGinMiddlewareScopesKeysPerCaller(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	created := 0
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(idempotency.AuthSubjectKey, c.GetHeader("X-User"))
+	})
+	router.Use(idempotency.GinMiddleware(idempotency.New(newMemoryStore(), idempotency.Config{})))
+	router.POST("/bets", func(c *gin.Context) {
+		created++
+		c.JSON(http.StatusCreated, gin.H{"id": created})
+	})
+
+	post := func(user string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/bets", strings.NewReader(body))
+		req.Header.Set(idempotency.HeaderIdempotencyKey, "k1")
+		req.Header.Set("X-User", user)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, post("ana", `{"stake":10}`).Code)
+	// the same key of another caller neither replays nor conflicts with the first caller's request
+	other := post("ivo", `{"stake":20}`)
+	assert.Equal(t, http.StatusCreated, other.Code)
+	assert.Empty(t, other.Header().Get(idempotency.HeaderIdempotentReplayed))
+	assert.Equal(t, "true", post("ana", `{"stake":10}`).Header().Get(idempotency.HeaderIdempotentReplayed))
+	assert.Equal(t, 2, created)
+}
+
+func TstDynamodbStore(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	c := test.SetupLocalstack(ctx)
+	ctx = aws.SetCustomAwsEndpoint(ctx, c.URI)
+	defer c.TeardownLocalstack()
+
+	client, err := aws.CreateDynamodbClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+	assert.Nil(t, idempotency.CreateDynamodbTable(ctx, client, "idempotency"))
+	testStore(t, idempotency.NewDynamodbStore(client, "idempotency"))
+}
+
+func TstPostgresStore(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pg := test.SetupPostgresDB(ctx, "user", "test", "testdb")
+	defer pg.TeardownPostgresDB()
+
+	db, err := postgres.NewPostgresDBFromUri(ctx, pg.URI)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	store := idempotency.NewPostgresStore(db, "")
+	_, err = db.Exec(ctx, store.Schema())
+	assert.Nil(t, err)
+	testStore(t, store)
+
+	deleted, err := store.DeleteExpired(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
@@ -0,0 +1,41 @@
+package idempotency
+
+import (
+	"context"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/consumer"
+	"github.com/hrsupersport/hrnogomet-backend-kit/messaging"
+)
+
+// MessageKeyFunc returns idempotency key of message, messages with empty key are handled without guard
+type MessageKeyFunc func(m *consumer.Message) string
+
+// MessageID uses SQS message ID as key, it deduplicates redeliveries of the same message
+func MessageID(m *consumer.Message) string {
+	return aws_sdk.ToString(m.MessageId)
+}
+
+// EnvelopeID uses ID of messaging envelope as key, it deduplicates also messages published repeatedly
+// (e.g. by retrying publisher or outbox relay)
+func EnvelopeID(m *consumer.Message) string {
+	if env, err := messaging.UnmarshalEnvelope([]byte(aws_sdk.ToString(m.Body))); err != nil {
+		return ""
+	} else {
+		return env.ID
+	}
+}
+
+// MessageHandler wraps handler so that messages with the same key are handled once. Duplicates of messages being
+// handled fail with ErrInProgress so that consumer retries them later, duplicates of handled messages are acknowledged.
+func MessageHandler(g *Guard, key MessageKeyFunc, next consumer.Handler) consumer.Handler {
+	return func(ctx context.Context, m *consumer.Message) error {
+		k := key(m)
+		if k == "" {
+			return next(ctx, m)
+		}
+		_, _, err := g.Do(ctx, k, "", func(ctx context.Context) ([]byte, error) {
+			return nil, next(ctx, m)
+		})
+		return err
+	}
+}
@@ -0,0 +1,96 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// DefaultPostgresTable is name of idempotency table used by NewPostgresStore when table is empty
+const DefaultPostgresTable = "idempotency_keys"
+
+// PostgresStore keeps idempotency records in postgres table, see Schema. Expired records are not deleted
+// automatically, call DeleteExpired periodically.
+type PostgresStore struct {
+	q     postgres.Querier
+	table string
+}
+
+// NewPostgresStore creates store, q is typically *postgres.DB
+func NewPostgresStore(q postgres.Querier, table string) *PostgresStore {
+	if table == "" {
+		table = DefaultPostgresTable
+	}
+	return &PostgresStore{q: q, table: pgx.Identifier{table}.Sanitize()}
+}
+
+// Schema returns DDL creating idempotency table, use it in your migration scripts or tests
+func (s *PostgresStore) Schema() string {
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	key TEXT PRIMARY KEY,
+	status TEXT NOT NULL,
+	token TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	response BYTEA NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);`, s.table)
+}
+
+// Claim inserts in-progress record, existing record is replaced only if it expired
+func (s *PostgresStore) Claim(ctx context.Context, record Record) (*Record, error) {
+	tag, err := s.q.Exec(ctx, fmt.Sprintf(`INSERT INTO %s AS t (key, status, token, fingerprint, response, expires_at)
+		VALUES (@key, @status, @token, @fingerprint, NULL, @expiresAt)
+		ON CONFLICT (key) DO UPDATE SET status = EXCLUDED.status, token = EXCLUDED.token, fingerprint = EXCLUDED.fingerprint, response = NULL, expires_at = EXCLUDED.expires_at
+		WHERE t.expires_at < now()`, s.table),
+		postgres.NamedArgs{"key": record.Key, "status": string(record.Status), "token": record.Token, "fingerprint": record.Fingerprint, "expiresAt": record.ExpiresAt})
+	if err != nil {
+		return nil, fmt.Errorf("cannot claim idempotency key %s: %w", record.Key, postgres.TranslateError(err))
+	}
+	if tag.RowsAffected() == 1 {
+		return nil, nil
+	}
+
+	existing := &Record{Key: record.Key}
+	var status string
+	err = s.q.QueryRow(ctx, fmt.Sprintf(`SELECT status, token, fingerprint, response, expires_at FROM %s WHERE key = $1`, s.table), record.Key).
+		Scan(&status, &existing.Token, &existing.Fingerprint, &existing.Response, &existing.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// released in the meantime
+		return s.Claim(ctx, record)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read idempotency key %s: %w", record.Key, postgres.TranslateError(err))
+	}
+	existing.Status = Status(status)
+	return existing, nil
+}
+
+// Complete stores response and retention expiry of record claimed with given token
+func (s *PostgresStore) Complete(ctx context.Context, key string, token string, response []byte, expiresAt time.Time) error {
+	tag, err := s.q.Exec(ctx, fmt.Sprintf(`UPDATE %s SET status = $3, response = $4, expires_at = $5 WHERE key = $1 AND token = $2`, s.table),
+		key, token, string(StatusCompleted), response, expiresAt)
+	if err != nil {
+		return fmt.Errorf("cannot complete idempotency key %s: %w", key, postgres.TranslateError(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("cannot complete idempotency key %s: %w", key, ErrClaimLost)
+	}
+	return nil
+}
+
+// Release deletes record claimed with given token unless it was completed
+func (s *PostgresStore) Release(ctx context.Context, key string, token string) error {
+	if _, err := s.q.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE key = $1 AND token = $2 AND status = $3`, s.table),
+		key, token, string(StatusInProgress)); err != nil {
+		return fmt.Errorf("cannot release idempotency key %s: %w", key, postgres.TranslateError(err))
+	}
+	return nil
+}
+
+// DeleteExpired deletes expired records and returns their number
+func (s *PostgresStore) DeleteExpired(ctx context.Context) (int64, error) {
+	return postgres.Exec(ctx, s.q, fmt.Sprintf(`DELETE FROM %s WHERE expires_at < now()`, s.table))
+}
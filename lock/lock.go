@@ -0,0 +1,110 @@
+package lock
+
+/*
+Backend neutral distributed lock interfaces and errors implemented by dynamodb (dist_lock package)
+and postgres (pg_lock package) lock backends, so that callers can switch between them.
+*/
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrLockNotGranted is returned (wrapped) by all lock backends when lock cannot be acquired in time
+	ErrLockNotGranted = errors.New("lock not granted")
+	// ErrStaleFencingToken is returned (wrapped) when write is rejected because newer lock holder already wrote to resource
+	ErrStaleFencingToken = errors.New("stale fencing token")
+)
+
+// DistributedLock is held distributed lock, implemented by all lock backends
+type DistributedLock interface {
+	ReleaseLock() error
+}
+
+// Locker acquires distributed locks, implemented by dynamodb (see dist_lock package) and postgres (see pg_lock package) backends
+type Locker interface {
+	// Acquire waits until lock is acquired or ctx is done
+	Acquire(ctx context.Context, key string) (Lock, error)
+	// TryAcquire makes single attempt, error wrapping ErrLockNotGranted is returned if lock is held by someone else
+	TryAcquire(ctx context.Context, key string) (Lock, error)
+}
+
+// Lock is held distributed lock. Work guarded by the lock should use Context() (or watch Lost()) so that it stops
+// once lock is lost, e.g. because heartbeats failed and lease expired or connection holding the lock died.
+type Lock interface {
+	DistributedLock
+	// Key returns name of the lock
+	Key() string
+	// Release releases the lock, Context() is cancelled afterwards
+	Release(ctx context.Context) error
+	// Lost returns channel closed when lock is lost (not when it is released)
+	Lost() <-chan struct{}
+	// Context returns context cancelled when lock is lost or released
+	Context() context.Context
+}
+
+// FencedLock is lock carrying fencing token, see dist_lock fencing tokens
+type FencedLock interface {
+	Lock
+	// FencingToken returns token issued on acquisition, zero if tokens are not enabled
+	FencingToken() int64
+}
+
+// LockState implements lost/released signalling shared by lock backends
+type LockState struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	lost     chan struct{}
+	lostOnce sync.Once
+	released atomic.Bool
+}
+
+// NewLockState creates state of newly acquired lock, its context keeps values (but not cancellation) of parent
+func NewLockState(parent context.Context) *LockState {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	return &LockState{
+		ctx:    ctx,
+		cancel: cancel,
+		lost:   make(chan struct{}),
+	}
+}
+
+// Lost returns channel closed by MarkLost
+func (s *LockState) Lost() <-chan struct{} {
+	return s.lost
+}
+
+// Context returns context cancelled by MarkLost or MarkReleased
+func (s *LockState) Context() context.Context {
+	return s.ctx
+}
+
+// IsLost returns true once MarkLost was called
+func (s *LockState) IsLost() bool {
+	select {
+	case <-s.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+// MarkLost signals lock loss, can be called repeatedly, has no effect once lock is released
+func (s *LockState) MarkLost() {
+	if s.released.Load() {
+		return
+	}
+	s.lostOnce.Do(func() {
+		close(s.lost)
+	})
+	s.cancel()
+}
+
+// MarkReleased cancels lock context, backends call it before releasing the lock so that release is not reported as loss
+func (s *LockState) MarkReleased() {
+	s.released.Store(true)
+	s.cancel()
+}
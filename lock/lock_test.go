@@ -0,0 +1,35 @@
+package lock_test
+
+import (
+	"context"
+	"github.com/hrsupersport/hrnogomet-backend-kit/lock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type ctxKey struct{}
+
+func TestLockStateLost(t *testing.T) {
+	parent, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "v"))
+	state := lock.NewLockState(parent)
+
+	// acquisition context does not bound lock context
+	cancel()
+	assert.Nil(t, state.Context().Err())
+	assert.Equal(t, "v", state.Context().Value(ctxKey{}))
+
+	state.MarkLost()
+	state.MarkLost()
+	assert.True(t, state.IsLost())
+	assert.NotNil(t, state.Context().Err())
+	<-state.Lost()
+}
+
+func TestLockStateReleased(t *testing.T) {
+	state := lock.NewLockState(context.Background())
+
+	state.MarkReleased()
+	state.MarkLost()
+	assert.False(t, state.IsLost())
+	assert.NotNil(t, state.Context().Err())
+}
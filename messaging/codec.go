@@ -0,0 +1,62 @@
+package messaging
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Codec encodes and decodes envelope payloads
+type Codec interface {
+	// ContentType identifies codec in envelope, it must be unique among codecs registered in Registry
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	// Unmarshal decodes data into v which is pointer to payload type
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// JSON encodes payloads with encoding/json
+	JSON Codec = jsonCodec{}
+	// Protobuf encodes payloads which are proto.Message
+	Protobuf Codec = protobufCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	}
+	return nil, fmt.Errorf("protobuf codec: %T is not proto.Message", v)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	return fmt.Errorf("protobuf codec: %T is not proto.Message", v)
+}
@@ -0,0 +1,136 @@
+package messaging
+
+/*
+Messaging envelope: every event travels wrapped in Envelope carrying its type, schema version, unique ID,
+time of occurrence and correlation ID. Payload is encoded by pluggable Codec (JSON, protobuf), envelope
+itself is always JSON so that it can be inspected by any consumer. Registry routes incoming envelopes
+to handlers registered for their type and version, older versions are upcasted to the version handler
+expects. Messages which can never be processed (malformed envelope, unknown type, undecodable payload)
+fail with error wrapping ErrPoisonMessage, they should not be retried.
+
+Use with SQS consumer:
+
+	consumer.New(client, cfg, func(ctx context.Context, m *consumer.Message) error {
+		return registry.Handle(ctx, []byte(aws_sdk.ToString(m.Body)))
+	})
+*/
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"time"
+)
+
+// ErrPoisonMessage is returned (wrapped) for messages which cannot be decoded or routed
+var ErrPoisonMessage = errors.New("poison message")
+
+// Envelope wraps encoded event payload with its metadata
+type Envelope struct {
+	ID            string
+	Type          string
+	Version       int
+	OccurredAt    time.Time
+	CorrelationID string
+	// ContentType identifies codec of payload
+	ContentType string
+	Payload     []byte
+}
+
+// envelopeJSON is wire format of envelope, JSON payloads are embedded as is, other payloads as base64 strings
+type envelopeJSON struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	Version       int             `json:"version"`
+	OccurredAt    time.Time       `json:"occurredAt"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	ContentType   string          `json:"contentType"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// NewEnvelope encodes payload with given codec. Correlation ID is taken from request ID stored in ctx
+// (see consumer.WithRequestID), handlers called by Registry have it set to correlation ID of handled message.
+func NewEnvelope(ctx context.Context, eventType string, version int, codec Codec, payload any) (*Envelope, error) {
+	if eventType == "" || version < 1 {
+		return nil, errors.New("messaging: event type must be set and version must be positive")
+	}
+
+	data, err := codec.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode %s v%d: %w", eventType, version, err)
+	}
+
+	return &Envelope{
+		ID:            uuid.NewString(),
+		Type:          eventType,
+		Version:       version,
+		OccurredAt:    time.Now().UTC(),
+		CorrelationID: correlationID(ctx),
+		ContentType:   codec.ContentType(),
+		Payload:       data,
+	}, nil
+}
+
+// Marshal encodes envelope to its wire format
+func (e *Envelope) Marshal() ([]byte, error) {
+	payload := json.RawMessage(e.Payload)
+	if e.ContentType != ContentTypeJSON {
+		data, err := json.Marshal(e.Payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = data
+	}
+
+	return json.Marshal(envelopeJSON{
+		ID:            e.ID,
+		Type:          e.Type,
+		Version:       e.Version,
+		OccurredAt:    e.OccurredAt,
+		CorrelationID: e.CorrelationID,
+		ContentType:   e.ContentType,
+		Payload:       payload,
+	})
+}
+
+// UnmarshalEnvelope decodes envelope from its wire format, returned error wraps ErrPoisonMessage
+func UnmarshalEnvelope(data []byte) (*Envelope, error) {
+	var wire envelopeJSON
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, wrapPoison(fmt.Errorf("malformed envelope: %w", err))
+	}
+	if wire.Type == "" || wire.Version < 1 {
+		return nil, wrapPoison(errors.New("envelope without type or version"))
+	}
+
+	e := &Envelope{
+		ID:            wire.ID,
+		Type:          wire.Type,
+		Version:       wire.Version,
+		OccurredAt:    wire.OccurredAt,
+		CorrelationID: wire.CorrelationID,
+		ContentType:   wire.ContentType,
+		Payload:       wire.Payload,
+	}
+	if e.ContentType != ContentTypeJSON {
+		if err := json.Unmarshal(wire.Payload, &e.Payload); err != nil {
+			return nil, wrapPoison(fmt.Errorf("malformed %s payload: %w", e.ContentType, err))
+		}
+	}
+	return e, nil
+}
+
+func correlationID(ctx context.Context) string {
+	if val, ok := ctx.Value(constants.ContextKeyRequestID{}).(string); ok {
+		return val
+	}
+	return ""
+}
+
+// wrapPoison makes err match ErrPoisonMessage
+func wrapPoison(err error) error {
+	return fmt.Errorf("%w: %w", ErrPoisonMessage, err)
+}
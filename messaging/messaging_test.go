@@ -0,0 +1,98 @@
+package messaging_test
+
+import (
+	"context"
+	"errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/messaging"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+type goalScored struct {
+	MatchID int    `json:"matchId"`
+	Scorer  string `json:"scorer"`
+	Minute  int    `json:"minute"`
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	ctx := context.WithValue(context.Background(), constants.ContextKeyRequestID{}, "req")
+	for _, codec := range []messaging.Codec{messaging.JSON, messaging.Protobuf} {
+		var payload any = goalScored{MatchID: 1, Scorer: "Modric", Minute: 90}
+		if codec == messaging.Protobuf {
+			payload = wrapperspb.String("Modric")
+		}
+
+		env, err := messaging.NewEnvelope(ctx, "GoalScored", 2, codec, payload)
+		assert.Nil(t, err)
+		assert.Equal(t, "req", env.CorrelationID)
+
+		data, err := env.Marshal()
+		assert.Nil(t, err)
+		decoded, err := messaging.UnmarshalEnvelope(data)
+		assert.Nil(t, err)
+		assert.Equal(t, env.ID, decoded.ID)
+		assert.Equal(t, env.Payload, []byte(decoded.Payload))
+		assert.True(t, env.OccurredAt.Equal(decoded.OccurredAt))
+	}
+}
+
+func TestRegistryRoutesAndUpcasts(t *testing.T) {
+	ctx := context.Background()
+	registry := messaging.NewRegistry()
+
+	var handled []goalScored
+	assert.Nil(t, messaging.Register(registry, "GoalScored", 2, func(ctx context.Context, env *messaging.Envelope, payload goalScored) error {
+		assert.Equal(t, "corr", ctx.Value(constants.ContextKeyRequestID{}))
+		handled = append(handled, payload)
+		return nil
+	}))
+	assert.NotNil(t, messaging.Register(registry, "GoalScored", 2, func(ctx context.Context, env *messaging.Envelope, payload goalScored) error {
+		return nil
+	}))
+	// v1 named scorer "player"
+	assert.Nil(t, registry.RegisterUpcaster("GoalScored", 1, messaging.JSONUpcaster(func(payload map[string]any) error {
+		payload["scorer"] = payload["player"]
+		delete(payload, "player")
+		return nil
+	})))
+
+	v1 := []byte(`{"id":"1","type":"GoalScored","version":1,"correlationId":"corr","contentType":"application/json","payload":{"matchId":7,"player":"Suker","minute":12}}`)
+	assert.Nil(t, registry.Handle(ctx, v1))
+	assert.Equal(t, []goalScored{{MatchID: 7, Scorer: "Suker", Minute: 12}}, handled)
+
+	var protoHandled string
+	assert.Nil(t, messaging.Register(registry, "PlayerRenamed", 1, func(ctx context.Context, env *messaging.Envelope, payload *wrapperspb.StringValue) error {
+		protoHandled = payload.GetValue()
+		return nil
+	}))
+	env, err := messaging.NewEnvelope(ctx, "PlayerRenamed", 1, messaging.Protobuf, wrapperspb.String("Boban"))
+	assert.Nil(t, err)
+	assert.Nil(t, registry.Dispatch(ctx, env))
+	assert.Equal(t, "Boban", protoHandled)
+}
+
+func TestPoisonMessages(t *testing.T) {
+	ctx := context.Background()
+	registry := messaging.NewRegistry()
+	handlerErr := errors.New("db down")
+	assert.Nil(t, messaging.Register(registry, "GoalScored", 1, func(ctx context.Context, env *messaging.Envelope, payload goalScored) error {
+		return handlerErr
+	}))
+
+	for _, data := range []string{
+		`not json`,
+		`{"id":"1","version":1,"contentType":"application/json","payload":{}}`,
+		`{"id":"1","type":"MatchStarted","version":1,"contentType":"application/json","payload":{}}`,
+		`{"id":"1","type":"GoalScored","version":3,"contentType":"application/json","payload":{}}`,
+		`{"id":"1","type":"GoalScored","version":1,"contentType":"application/xml","payload":"PGdvYWwvPg=="}`,
+		`{"id":"1","type":"GoalScored","version":1,"contentType":"application/json","payload":{"matchId":"seven"}}`,
+	} {
+		err := registry.Handle(ctx, []byte(data))
+		assert.True(t, errors.Is(err, messaging.ErrPoisonMessage), data)
+	}
+
+	err := registry.Handle(ctx, []byte(`{"id":"1","type":"GoalScored","version":1,"contentType":"application/json","payload":{"matchId":1}}`))
+	assert.Equal(t, handlerErr, err)
+}
@@ -0,0 +1,169 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"reflect"
+	"sync"
+)
+
+// Upcaster converts encoded payload of one version to the next version, it works with payload encoded
+// by codec of the message (see JSONUpcaster for JSON payloads)
+type Upcaster func(payload []byte) ([]byte, error)
+
+// JSONUpcaster creates upcaster modifying decoded JSON object in place, e.g. renaming or defaulting fields
+func JSONUpcaster(fn func(payload map[string]any) error) Upcaster {
+	return func(payload []byte) ([]byte, error) {
+		var decoded map[string]any
+		if err := json.Unmarshal(payload, &decoded); err != nil {
+			return nil, err
+		}
+		if err := fn(decoded); err != nil {
+			return nil, err
+		}
+		return json.Marshal(decoded)
+	}
+}
+
+type route struct {
+	eventType string
+	version   int
+}
+
+type handlerFunc func(ctx context.Context, env *Envelope, codec Codec) error
+
+// Registry routes envelopes to handlers by type and version
+type Registry struct {
+	mu        sync.RWMutex
+	codecs    map[string]Codec
+	handlers  map[route]handlerFunc
+	upcasters map[route]Upcaster
+}
+
+// NewRegistry creates registry with JSON and Protobuf codecs
+func NewRegistry() *Registry {
+	return &Registry{
+		codecs: map[string]Codec{
+			ContentTypeJSON:     JSON,
+			ContentTypeProtobuf: Protobuf,
+		},
+		handlers:  make(map[route]handlerFunc),
+		upcasters: make(map[route]Upcaster),
+	}
+}
+
+// RegisterCodec adds codec (or replaces codec with the same content type)
+func (r *Registry) RegisterCodec(codec Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs[codec.ContentType()] = codec
+}
+
+// Register registers handler of given event type and version, payload is decoded into T by codec of the message
+// (use pointer to generated struct for protobuf payloads). Envelopes of older versions are upcasted to the nearest
+// version having handler, see RegisterUpcaster.
+func Register[T any](r *Registry, eventType string, version int, handler func(ctx context.Context, env *Envelope, payload T) error) error {
+	if eventType == "" || version < 1 {
+		return fmt.Errorf("messaging: invalid route %s v%d", eventType, version)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := route{eventType: eventType, version: version}
+	if _, ok := r.handlers[key]; ok {
+		return fmt.Errorf("messaging: handler of %s v%d already registered", eventType, version)
+	}
+	r.handlers[key] = func(ctx context.Context, env *Envelope, codec Codec) error {
+		payload, err := decodePayload[T](codec, env.Payload)
+		if err != nil {
+			return wrapPoison(fmt.Errorf("cannot decode %s v%d payload of message %s: %w", env.Type, env.Version, env.ID, err))
+		}
+		return handler(ctx, env, payload)
+	}
+	return nil
+}
+
+// RegisterUpcaster registers upcaster converting payloads of given event type from fromVersion to fromVersion+1
+func (r *Registry) RegisterUpcaster(eventType string, fromVersion int, upcaster Upcaster) error {
+	if eventType == "" || fromVersion < 1 {
+		return fmt.Errorf("messaging: invalid upcaster route %s v%d", eventType, fromVersion)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := route{eventType: eventType, version: fromVersion}
+	if _, ok := r.upcasters[key]; ok {
+		return fmt.Errorf("messaging: upcaster of %s v%d already registered", eventType, fromVersion)
+	}
+	r.upcasters[key] = upcaster
+	return nil
+}
+
+// Handle decodes envelope from its wire format and dispatches it
+func (r *Registry) Handle(ctx context.Context, data []byte) error {
+	env, err := UnmarshalEnvelope(data)
+	if err != nil {
+		return err
+	}
+	return r.Dispatch(ctx, env)
+}
+
+// Dispatch upcasts envelope if needed and calls its handler with correlation ID of envelope stored in ctx
+// as request ID. Errors of routing, upcasting and decoding wrap ErrPoisonMessage, handler errors are returned as is.
+func (r *Registry) Dispatch(ctx context.Context, env *Envelope) error {
+	handler, codec, upcasted, err := r.resolve(env)
+	if err != nil {
+		return err
+	}
+
+	if env.CorrelationID != "" {
+		ctx = context.WithValue(ctx, constants.ContextKeyRequestID{}, env.CorrelationID)
+	}
+	return handler(ctx, upcasted, codec)
+}
+
+// resolve finds codec and handler of envelope, upcasting it until version with handler is reached
+func (r *Registry) resolve(env *Envelope) (handlerFunc, Codec, *Envelope, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	codec, ok := r.codecs[env.ContentType]
+	if !ok {
+		return nil, nil, nil, wrapPoison(fmt.Errorf("unsupported content type %q of message %s", env.ContentType, env.ID))
+	}
+
+	upcasted := *env
+	for {
+		if handler, ok := r.handlers[route{eventType: upcasted.Type, version: upcasted.Version}]; ok {
+			return handler, codec, &upcasted, nil
+		}
+
+		upcaster, ok := r.upcasters[route{eventType: upcasted.Type, version: upcasted.Version}]
+		if !ok {
+			return nil, nil, nil, wrapPoison(fmt.Errorf("no handler of %s v%d (message %s)", env.Type, env.Version, env.ID))
+		}
+		payload, err := upcaster(upcasted.Payload)
+		if err != nil {
+			return nil, nil, nil, wrapPoison(fmt.Errorf("cannot upcast %s v%d of message %s: %w", upcasted.Type, upcasted.Version, env.ID, err))
+		}
+		upcasted.Payload = payload
+		upcasted.Version++
+	}
+}
+
+// decodePayload decodes payload into T, for pointer types new value is allocated
+func decodePayload[T any](codec Codec, data []byte) (T, error) {
+	var payload T
+	if t := reflect.TypeOf(payload); t != nil && t.Kind() == reflect.Pointer {
+		ptr := reflect.New(t.Elem())
+		if err := codec.Unmarshal(data, ptr.Interface()); err != nil {
+			return payload, err
+		}
+		return ptr.Interface().(T), nil
+	}
+
+	err := codec.Unmarshal(data, &payload)
+	return payload, err
+}
@@ -0,0 +1,133 @@
+package outbox
+
+/*
+Transactional outbox: domain events are inserted into outbox table within the same postgres transaction
+as business data (see Outbox.Insert) so that either both are persisted or none. Relay (see Relay.Run) then
+reads unsent events (FOR UPDATE SKIP LOCKED so that multiple replicas can run relay concurrently),
+publishes them (e.g. to SQS, see SqsPublisher) and marks them as sent. Failed events are retried with
+exponential backoff, events failing MaxAttempts times are marked as failed (poison) and skipped.
+Events of the same message group (FIFO queues) are published one after another in order of insertion, event is
+not published until preceding event of its group is sent or marked as failed.
+Relay is woken up via LISTEN/NOTIFY when new events are committed, polling is used as fallback.
+*/
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	DefaultTable   = "outbox"
+	DefaultChannel = "outbox_events"
+)
+
+// Config holds outbox table and notification channel names
+type Config struct {
+	// Table is name of outbox table, DefaultTable if empty
+	Table string
+	// Channel is postgres notification channel used to wake up relay, DefaultChannel if empty
+	Channel string
+}
+
+func (c Config) table() string {
+	if c.Table == "" {
+		return DefaultTable
+	}
+	return c.Table
+}
+
+func (c Config) channel() string {
+	if c.Channel == "" {
+		return DefaultChannel
+	}
+	return c.Channel
+}
+
+// Event represents single message to be published
+type Event struct {
+	// Destination is target of the message, e.g. SQS queue url
+	Destination string
+	// Type is event type, published as message attribute (see AttributeEventType)
+	Type string
+	// Payload is message body
+	Payload string
+	// Attributes are published as string message attributes
+	Attributes map[string]string
+	// GroupID and DeduplicationID are used for FIFO queues only
+	GroupID         string
+	DeduplicationID string
+}
+
+// Outbox inserts events into outbox table
+type Outbox struct {
+	cfg Config
+}
+
+func New(cfg Config) *Outbox {
+	return &Outbox{cfg: cfg}
+}
+
+// Schema returns DDL creating outbox table, use it in your migration scripts or tests
+func (o *Outbox) Schema() string {
+	table := pgx.Identifier{o.cfg.table()}.Sanitize()
+	index := pgx.Identifier{o.cfg.table() + "_pending_idx"}.Sanitize()
+	groupIndex := pgx.Identifier{o.cfg.table() + "_pending_group_idx"}.Sanitize()
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGSERIAL PRIMARY KEY,
+	destination TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	attributes JSONB NOT NULL DEFAULT '{}',
+	group_id TEXT NULL,
+	deduplication_id TEXT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_error TEXT NULL,
+	sent_at TIMESTAMPTZ NULL,
+	failed_at TIMESTAMPTZ NULL
+);
+CREATE INDEX IF NOT EXISTS %s ON %s (next_attempt_at, id) WHERE sent_at IS NULL AND failed_at IS NULL;
+CREATE INDEX IF NOT EXISTS %s ON %s (destination, group_id, id) WHERE group_id IS NOT NULL AND sent_at IS NULL AND failed_at IS NULL;`,
+		table, index, table, groupIndex, table)
+}
+
+// Insert stores events into outbox table within caller's transaction and notifies relay.
+// Notification is delivered only once transaction commits.
+func (o *Outbox) Insert(ctx context.Context, tx pgx.Tx, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	sql := fmt.Sprintf(`INSERT INTO %s (destination, event_type, payload, attributes, group_id, deduplication_id)
+		VALUES (@destination, @eventType, @payload, @attributes, NULLIF(@groupID, ''), NULLIF(@deduplicationID, ''))`,
+		pgx.Identifier{o.cfg.table()}.Sanitize())
+
+	batch := &pgx.Batch{}
+	for _, e := range events {
+		if e.Destination == "" || e.Type == "" {
+			return errors.New("outbox: event destination and type must be set")
+		}
+		attributes := e.Attributes
+		if attributes == nil {
+			attributes = map[string]string{}
+		}
+		batch.Queue(sql, postgres.NamedArgs{
+			"destination":     e.Destination,
+			"eventType":       e.Type,
+			"payload":         e.Payload,
+			"attributes":      attributes,
+			"groupID":         e.GroupID,
+			"deduplicationID": e.DeduplicationID,
+		})
+	}
+	batch.Queue("SELECT pg_notify($1, '')", o.cfg.channel())
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return postgres.TranslateError(err)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
+	"github.com/hrsupersport/hrnogomet-backend-kit/logging"
+	"github.com/hrsupersport/hrnogomet-backend-kit/outbox"
+	"github.com/hrsupersport/hrnogomet-backend-kit/test"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 1*time.Second, outbox.Backoff(1, time.Second, time.Minute))
+	assert.Equal(t, 2*time.Second, outbox.Backoff(2, time.Second, time.Minute))
+	assert.Equal(t, 8*time.Second, outbox.Backoff(4, time.Second, time.Minute))
+	assert.Equal(t, time.Minute, outbox.Backoff(10, time.Second, time.Minute))
+	assert.Equal(t, time.Minute, outbox.Backoff(1000, time.Second, time.Minute))
+}
+
+func TestSchema(t *testing.T) {
+	schema := outbox.New(outbox.Config{Table: "player_outbox"}).Schema()
+	assert.Contains(t, schema, `CREATE TABLE IF NOT EXISTS "player_outbox"`)
+	assert.Contains(t, schema, `"player_outbox_pending_idx"`)
+}
+
+// fakeQueue accepts batches up to 256KB, rejected messages fail and dropped ones are missing in the response
+type fakeQueue struct {
+	batches  [][]string
+	rejected map[string]bool
+	dropped  map[string]bool
+}
+
+func (f *fakeQueue) SendMessageBatch(_ context.Context, params *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	var bodies []string
+	size := 0
+	for _, entry := range params.Entries {
+		bodies = append(bodies, aws_sdk.ToString(entry.MessageBody))
+		size += len(aws_sdk.ToString(entry.MessageBody))
+	}
+	f.batches = append(f.batches, bodies)
+	if size > 256*1024 {
+		return nil, errors.New("AWS.SimpleQueueService.BatchRequestTooLong")
+	}
+
+	out := &sqs.SendMessageBatchOutput{}
+	for _, entry := range params.Entries {
+		body := aws_sdk.ToString(entry.MessageBody)
+		switch {
+		case f.rejected[body]:
+			out.Failed = append(out.Failed, sqs_types.BatchResultErrorEntry{Id: aws_sdk.String("unknown"), Code: aws_sdk.String("InvalidParameterValue")})
+		case f.dropped[body]:
+		default:
+			out.Successful = append(out.Successful, sqs_types.SendMessageBatchResultEntry{Id: entry.Id, MessageId: aws_sdk.String("id-" + body)})
+		}
+	}
+	return out, nil
+}
+
+func TestSqsPublisherSplitsBatchesBySize(t *testing.T) {
+	queue := &fakeQueue{}
+	messages := make([]outbox.Message, 10)
+	for i := range messages {
+		messages[i] = outbox.Message{ID: int64(i + 1), Event: outbox.Event{Destination: "queue", Type: "PlayerCreated", Payload: strings.Repeat("x", 30*1024)}}
+	}
+
+	failed := outbox.NewSqsPublisher(queue).Publish(context.Background(), messages)
+	assert.Empty(t, failed)
+	assert.Len(t, queue.batches, 2)
+	assert.Len(t, queue.batches[0], 8)
+	assert.Len(t, queue.batches[1], 2)
+}
+
+func TestSqsPublisherFailsUnconfirmedMessages(t *testing.T) {
+	queue := &fakeQueue{rejected: map[string]bool{"2": true}, dropped: map[string]bool{"3": true}}
+	var messages []outbox.Message
+	for i := 1; i <= 4; i++ {
+		messages = append(messages, outbox.Message{ID: int64(i), Event: outbox.Event{Destination: "queue", Type: "PlayerCreated", Payload: fmt.Sprint(i)}})
+	}
+
+	failed := outbox.NewSqsPublisher(queue).Publish(context.Background(), messages)
+	assert.Len(t, failed, 2)
+	assert.NotNil(t, failed[2])
+	assert.NotNil(t, failed[3])
+}
+
+func TestSqsPublisherKeepsOrderOfFifoGroups(t *testing.T) {
+	queue := &fakeQueue{dropped: map[string]bool{"a1": true}}
+	messages := []outbox.Message{
+		{ID: 1, Event: outbox.Event{Destination: "queue.fifo", Type: "MatchUpdated", Payload: "a1", GroupID: "a"}},
+		{ID: 2, Event: outbox.Event{Destination: "queue.fifo", Type: "MatchUpdated", Payload: "b1", GroupID: "b"}},
+		{ID: 3, Event: outbox.Event{Destination: "queue.fifo", Type: "MatchUpdated", Payload: "a2", GroupID: "a"}},
+		{ID: 4, Event: outbox.Event{Destination: "queue.fifo", Type: "MatchUpdated", Payload: "b2", GroupID: "b"}},
+	}
+
+	failed := outbox.NewSqsPublisher(queue).Publish(context.Background(), messages)
+	assert.Len(t, failed, 2)
+	assert.NotNil(t, failed[1])
+	assert.NotNil(t, failed[3])
+	// a2 is not sent after failed a1
+	assert.Equal(t, [][]string{{"a1", "b1"}, {"b2"}}, queue.batches)
+}
+
+// failingPublisher fails messages with given payloads
+type failingPublisher struct {
+	failing   map[string]bool
+	published []string
+}
+
+func (p *failingPublisher) Publish(_ context.Context, messages []outbox.Message) map[int64]error {
+	failed := make(map[int64]error)
+	for _, m := range messages {
+		p.published = append(p.published, m.Payload)
+		if p.failing[m.Payload] {
+			failed[m.ID] = errors.New("unavailable")
+		}
+	}
+	return failed
+}
+
+func TstRelayKeepsOrderOfGroups(t *testing.T) {
+	t.Helper()
+	logging.ConfigureDefaultLoggingSetup("")
+	ctx := context.Background()
+
+	pg := test.SetupPostgresDB(ctx, "user", "test", "testdb")
+	defer pg.TeardownPostgresDB()
+
+	db, err := postgres.NewPostgresDBFromUri(ctx, pg.URI)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	o := outbox.New(outbox.Config{})
+	_, err = db.Exec(ctx, o.Schema())
+	assert.Nil(t, err)
+
+	err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		return o.Insert(ctx, tx,
+			outbox.Event{Destination: "queue.fifo", Type: "MatchUpdated", Payload: "a1", GroupID: "a"},
+			outbox.Event{Destination: "queue.fifo", Type: "MatchUpdated", Payload: "a2", GroupID: "a"},
+			outbox.Event{Destination: "queue.fifo", Type: "MatchUpdated", Payload: "b1", GroupID: "b"},
+			outbox.Event{Destination: "queue.fifo", Type: "MatchUpdated", Payload: "b2", GroupID: "b"},
+		)
+	})
+	assert.Nil(t, err)
+
+	publisher := &failingPublisher{failing: map[string]bool{"a1": true}}
+	relay := outbox.NewRelay(db, publisher, outbox.RelayConfig{MinBackoff: time.Hour})
+	assert.Nil(t, relay.ProcessPending(ctx))
+
+	// a2 waits for retry of a1, b2 is published once b1 is sent
+	assert.Equal(t, []string{"a1", "b1", "b2"}, publisher.published)
+}
+
+func TstOutboxRelayToSqs(t *testing.T) {
+	t.Helper()
+	logging.ConfigureDefaultLoggingSetup("")
+	ctx := context.Background()
+
+	pg := test.SetupPostgresDB(ctx, "user", "test", "testdb")
+	defer pg.TeardownPostgresDB()
+	ls := test.SetupLocalstack(ctx)
+	defer ls.TeardownLocalstack()
+	ctx = aws.SetCustomAwsEndpoint(ctx, ls.URI)
+
+	db, err := postgres.NewPostgresDBFromUri(ctx, pg.URI)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	sqsClient, err := aws.CreateSqsClient(ctx, constants.AwsDefaultRegion)
+	assert.Nil(t, err)
+	queue, err := sqsClient.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws_sdk.String("outbox-test")})
+	assert.Nil(t, err)
+
+	o := outbox.New(outbox.Config{})
+	_, err = db.Exec(ctx, o.Schema())
+	assert.Nil(t, err)
+
+	err = pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		return o.Insert(ctx, tx,
+			outbox.Event{Destination: *queue.QueueUrl, Type: "PlayerCreated", Payload: `{"id":1}`},
+			outbox.Event{Destination: *queue.QueueUrl, Type: "PlayerCreated", Payload: `{"id":2}`},
+		)
+	})
+	assert.Nil(t, err)
+
+	relay := outbox.NewRelay(db, outbox.NewSqsPublisher(sqsClient), outbox.RelayConfig{})
+	assert.Nil(t, relay.ProcessPending(ctx))
+
+	out, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            queue.QueueUrl,
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     1,
+	})
+	assert.Nil(t, err)
+	assert.Len(t, out.Messages, 2)
+
+	var pending int
+	err = db.QueryRow(ctx, "SELECT count(*) FROM outbox WHERE sent_at IS NULL").Scan(&pending)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pending)
+}
@@ -0,0 +1,256 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/postgres"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"time"
+)
+
+const (
+	DefaultBatchSize    = 100
+	DefaultPollInterval = 5 * time.Second
+	DefaultMaxAttempts  = 10
+	DefaultMinBackoff   = 1 * time.Second
+	DefaultMaxBackoff   = 5 * time.Minute
+)
+
+// RelayConfig configures relay worker, zero values are replaced with defaults
+type RelayConfig struct {
+	Config
+	// BatchSize is max number of events read and published in single transaction
+	BatchSize int
+	// PollInterval is max time between two polls of outbox table (when no notification arrives)
+	PollInterval time.Duration
+	// MaxAttempts is number of failed publish attempts after which event is marked as failed (poison)
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound exponential backoff between retries of failed events
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// DisableListen switches off LISTEN/NOTIFY, relay then relies on polling only
+	DisableListen bool
+}
+
+// Relay reads pending events from outbox table and publishes them
+type Relay struct {
+	db        *postgres.DB
+	publisher Publisher
+	listener  *pgxpool.Conn
+	cfg       RelayConfig
+}
+
+// NewRelay creates new relay, start it with Run
+func NewRelay(db *postgres.DB, publisher Publisher, cfg RelayConfig) *Relay {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultMinBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+
+	return &Relay{
+		db:        db,
+		publisher: publisher,
+		cfg:       cfg,
+	}
+}
+
+// Run processes outbox until ctx is cancelled, ctx.Err() is returned then. Relay is not safe for concurrent use,
+// run one relay per replica, replicas do not block each other thanks to FOR UPDATE SKIP LOCKED
+func (r *Relay) Run(ctx context.Context) error {
+	defer r.closeListener()
+
+	for {
+		if err := r.ProcessPending(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("outbox relay: cannot process pending events")
+		}
+
+		if err := r.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// ProcessPending publishes all events which are due, batch by batch. Returns once no due events are left.
+func (r *Relay) ProcessPending(ctx context.Context) error {
+	for {
+		processed, sentInGroups, err := r.processBatch(ctx)
+		if err != nil {
+			return err
+		}
+		// events following sent events of their message groups became due
+		if processed < r.cfg.BatchSize && sentInGroups == 0 {
+			return nil
+		}
+	}
+}
+
+// wait blocks until notification arrives on outbox channel or poll interval elapses.
+// Notifications are received on dedicated connection which stays subscribed for whole Run, i.e. notifications
+// sent while relay is processing are buffered on the connection and wake up relay immediately afterwards.
+func (r *Relay) wait(ctx context.Context) error {
+	if !r.cfg.DisableListen {
+		err := r.waitForNotification(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Warn().Err(err).Msg("outbox relay: cannot listen for notifications, falling back to polling")
+		r.closeListener()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(r.cfg.PollInterval):
+		return nil
+	}
+}
+
+func (r *Relay) waitForNotification(ctx context.Context) error {
+	if r.listener == nil {
+		conn, err := r.db.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{r.cfg.channel()}.Sanitize()); err != nil {
+			conn.Release()
+			return err
+		}
+		r.listener = conn
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, r.cfg.PollInterval)
+	defer cancel()
+
+	if _, err := r.listener.Conn().WaitForNotification(waitCtx); err != nil && !errors.Is(waitCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
+
+// closeListener closes listening connection, it is not returned to the pool since it would remain subscribed
+func (r *Relay) closeListener() {
+	if r.listener == nil {
+		return
+	}
+	_ = r.listener.Conn().Close(context.Background())
+	r.listener.Release()
+	r.listener = nil
+}
+
+// processBatch publishes next batch of due events. Events of message group (FIFO queues) are selected only when
+// all preceding events of the group are sent (or failed permanently), i.e. one by one and by one relay at a time.
+// Returns number of processed events and number of sent events which belong to a message group.
+func (r *Relay) processBatch(ctx context.Context) (int, int, error) {
+	table := pgx.Identifier{r.cfg.table()}.Sanitize()
+	processed, sentInGroups := 0, 0
+
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT id, destination, event_type, payload, attributes,
+				COALESCE(group_id, ''), COALESCE(deduplication_id, ''), attempts
+			FROM %s t
+			WHERE sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= now()
+				AND NOT EXISTS (SELECT 1 FROM %s o
+					WHERE o.destination = t.destination AND o.group_id = t.group_id AND o.id < t.id
+						AND o.sent_at IS NULL AND o.failed_at IS NULL)
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED`, table, table), r.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		messages, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Message, error) {
+			var m Message
+			err := row.Scan(&m.ID, &m.Destination, &m.Type, &m.Payload, &m.Attributes, &m.GroupID, &m.DeduplicationID, &m.Attempts)
+			return m, err
+		})
+		if err != nil {
+			return err
+		}
+		processed = len(messages)
+		if processed == 0 {
+			return nil
+		}
+
+		failed := r.publisher.Publish(ctx, messages)
+
+		sent := make([]int64, 0, len(messages))
+		for _, m := range messages {
+			if _, ok := failed[m.ID]; !ok {
+				sent = append(sent, m.ID)
+				if m.GroupID != "" {
+					sentInGroups++
+				}
+			}
+		}
+
+		if len(sent) > 0 {
+			if _, err := tx.Exec(ctx, fmt.Sprintf("UPDATE %s SET sent_at = now(), attempts = attempts + 1 WHERE id = ANY($1)", table), sent); err != nil {
+				return err
+			}
+		}
+
+		for _, m := range messages {
+			publishErr, ok := failed[m.ID]
+			if !ok {
+				continue
+			}
+			if err := r.markFailedAttempt(ctx, tx, table, m, publishErr); err != nil {
+				return err
+			}
+		}
+
+		log.Debug().Int("sent", len(sent)).Int("failed", len(failed)).Msg("outbox relay: batch processed")
+		return nil
+	})
+
+	return processed, sentInGroups, err
+}
+
+func (r *Relay) markFailedAttempt(ctx context.Context, tx pgx.Tx, table string, m Message, publishErr error) error {
+	attempts := m.Attempts + 1
+	if attempts >= r.cfg.MaxAttempts {
+		log.Error().Err(publishErr).Int64("id", m.ID).Str("type", m.Type).Int("attempts", attempts).Msg("outbox relay: giving up on event, marking as failed")
+		_, err := tx.Exec(ctx, fmt.Sprintf("UPDATE %s SET attempts = $2, last_error = $3, failed_at = now() WHERE id = $1", table),
+			m.ID, attempts, publishErr.Error())
+		return err
+	}
+
+	backoff := Backoff(attempts, r.cfg.MinBackoff, r.cfg.MaxBackoff)
+	log.Warn().Err(publishErr).Int64("id", m.ID).Str("type", m.Type).Int("attempts", attempts).Dur("backoff", backoff).Msg("outbox relay: cannot publish event, will retry")
+	_, err := tx.Exec(ctx, fmt.Sprintf("UPDATE %s SET attempts = $2, last_error = $3, next_attempt_at = now() + make_interval(secs => $4) WHERE id = $1", table),
+		m.ID, attempts, publishErr.Error(), backoff.Seconds())
+	return err
+}
+
+// Backoff returns exponential backoff for given attempt (1 based): minBackoff, 2*minBackoff, 4*minBackoff, ... capped at maxBackoff
+func Backoff(attempt int, minBackoff time.Duration, maxBackoff time.Duration) time.Duration {
+	backoff := minBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff || backoff <= 0 {
+			return maxBackoff
+		}
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
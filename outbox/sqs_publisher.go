@@ -0,0 +1,159 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/batch"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws/sqs/extended"
+	"strconv"
+	"strings"
+)
+
+const (
+	// AttributeEventType is name of message attribute holding Event.Type
+	AttributeEventType = "EventType"
+
+	sqsMaxBatchSize = 10
+	fifoQueueSuffix = ".fifo"
+)
+
+// Message is pending outbox row handed over to Publisher
+type Message struct {
+	Event
+	ID       int64
+	Attempts int
+}
+
+// Publisher publishes messages read from outbox table. Returned map holds errors of messages
+// which were not published (keyed by Message.ID), all other messages are considered published.
+type Publisher interface {
+	Publish(ctx context.Context, messages []Message) map[int64]error
+}
+
+// SqsClient is subset of *sqs.Client used by SqsPublisher
+type SqsClient interface {
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// SqsPublisher publishes outbox messages to SQS queues (Event.Destination is queue url) using SendMessageBatch
+// calls of up to 10 messages and 256KB. Failed messages are not retried, relay retries them in later batches.
+// Messages of the same group of FIFO queue are sent in separate calls, messages following failed message of their
+// group fail too so that they are not delivered out of order.
+type SqsPublisher struct {
+	client SqsClient
+}
+
+// NewSqsPublisher creates new SQS publisher, use aws.CreateSqsClient to create the client
+func NewSqsPublisher(client SqsClient) *SqsPublisher {
+	return &SqsPublisher{client: client}
+}
+
+func (p *SqsPublisher) Publish(ctx context.Context, messages []Message) map[int64]error {
+	failed := make(map[int64]error)
+
+	byQueue := make(map[string][]Message)
+	for _, m := range messages {
+		byQueue[m.Destination] = append(byQueue[m.Destination], m)
+	}
+
+	for queueURL, queueMessages := range byQueue {
+		p.sendBatch(ctx, queueURL, queueMessages, failed)
+	}
+
+	return failed
+}
+
+// sendBatch sends messages to the queue, messages are considered sent only when SQS reports them as successful
+func (p *SqsPublisher) sendBatch(ctx context.Context, queueURL string, messages []Message, failed map[int64]error) {
+	entries := make([]sqs_types.SendMessageBatchRequestEntry, len(messages))
+	sizes := make([]int, len(messages))
+	indexes := make([]int, len(messages))
+	for i, m := range messages {
+		entries[i] = toBatchEntry(m)
+		entries[i].Id = aws_sdk.String(strconv.Itoa(i))
+		sizes[i] = extended.MessageSize(m.Payload, entries[i].MessageAttributes)
+		indexes[i] = i
+	}
+
+	ids := make([]string, len(messages))
+	errs := make([]error, len(messages))
+	policy := batch.Policy{
+		Operation:  "send message",
+		MaxEntries: sqsMaxBatchSize,
+		MaxBytes:   extended.MaxMessageSize,
+		Size:       func(index int) int { return sizes[index] },
+	}
+	if strings.HasSuffix(queueURL, fifoQueueSuffix) {
+		policy.Group = func(index int) string { return messages[index].GroupID }
+	}
+	batch.Send(ctx, policy, indexes, func(ctx context.Context, indexes []int) (map[int]batch.Result, error) {
+		requestEntries := make([]sqs_types.SendMessageBatchRequestEntry, len(indexes))
+		for i, index := range indexes {
+			requestEntries[i] = entries[index]
+		}
+
+		out, err := p.client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws_sdk.String(queueURL),
+			Entries:  requestEntries,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		results := make(map[int]batch.Result, len(indexes))
+		for _, entry := range out.Successful {
+			if i, valid := entryIndex(entry.Id, len(messages)); valid {
+				results[i] = batch.Result{ID: aws_sdk.ToString(entry.MessageId)}
+			}
+		}
+		for _, entry := range out.Failed {
+			i, valid := entryIndex(entry.Id, len(messages))
+			if _, answered := results[i]; !valid || answered {
+				continue
+			}
+			results[i] = batch.Result{Err: fmt.Errorf("sqs: %s: %s", aws_sdk.ToString(entry.Code), aws_sdk.ToString(entry.Message))}
+		}
+		return results, nil
+	}, ids, errs)
+
+	for i, m := range messages {
+		if errs[i] != nil {
+			failed[m.ID] = errs[i]
+		}
+	}
+}
+
+func entryIndex(id *string, n int) (int, bool) {
+	i, err := strconv.Atoi(aws_sdk.ToString(id))
+	return i, err == nil && i >= 0 && i < n
+}
+
+func toBatchEntry(m Message) sqs_types.SendMessageBatchRequestEntry {
+	attributes := map[string]sqs_types.MessageAttributeValue{
+		AttributeEventType: {
+			DataType:    aws_sdk.String("String"),
+			StringValue: aws_sdk.String(m.Type),
+		},
+	}
+	for k, v := range m.Attributes {
+		attributes[k] = sqs_types.MessageAttributeValue{
+			DataType:    aws_sdk.String("String"),
+			StringValue: aws_sdk.String(v),
+		}
+	}
+
+	entry := sqs_types.SendMessageBatchRequestEntry{
+		MessageBody:       aws_sdk.String(m.Payload),
+		MessageAttributes: attributes,
+	}
+	if m.GroupID != "" {
+		entry.MessageGroupId = aws_sdk.String(m.GroupID)
+	}
+	if m.DeduplicationID != "" {
+		entry.MessageDeduplicationId = aws_sdk.String(m.DeduplicationID)
+	}
+	return entry
+}
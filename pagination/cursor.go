@@ -0,0 +1,101 @@
+package pagination
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	service_errors "github.com/hrsupersport/hrnogomet-backend-kit/errors"
+	"strings"
+)
+
+// Cursor holds position within sorted result set used by keyset pagination
+type Cursor struct {
+	// Values holds values of sort columns of boundary row
+	Values []any `json:"v"`
+	// Sort holds sort signature (see SortSignature) cursor was created for
+	Sort string `json:"s"`
+	// Backward is true for cursors pointing to previous page
+	Backward bool `json:"b,omitempty"`
+}
+
+// CursorCodec encodes cursors into opaque url safe tokens signed with HMAC-SHA256
+// so that clients cannot tamper with them (e.g. to inject arbitrary values into queries)
+type CursorCodec struct {
+	secret []byte
+}
+
+// NewCursorCodec creates new codec, secret should be long random value shared by all replicas of the service
+func NewCursorCodec(secret []byte) (*CursorCodec, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("NewCursorCodec: secret must not be empty")
+	}
+	return &CursorCodec{secret: secret}, nil
+}
+
+// Encode serializes and signs cursor, format is base64url(json).base64url(hmac)
+func (c *CursorCodec) Encode(cursor *Cursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload)), nil
+}
+
+// Decode verifies signature and deserializes cursor. ServiceErrorBadRequest is returned for any invalid cursor.
+// JSON numbers are decoded as int64 if possible, float64 otherwise. Timestamps travel as RFC3339 strings
+// which is fine since postgres parses them when compared with timestamp columns.
+func (c *CursorCodec) Decode(token string) (*Cursor, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, invalidCursorError(nil)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, invalidCursorError(err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, invalidCursorError(err)
+	}
+
+	if !hmac.Equal(signature, c.sign(payload)) {
+		return nil, invalidCursorError(errors.New("signature mismatch"))
+	}
+
+	var cursor Cursor
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cursor); err != nil {
+		return nil, invalidCursorError(err)
+	}
+
+	for i, v := range cursor.Values {
+		if n, ok := v.(json.Number); ok {
+			if i64, err := n.Int64(); err == nil {
+				cursor.Values[i] = i64
+			} else if f64, err := n.Float64(); err == nil {
+				cursor.Values[i] = f64
+			} else {
+				return nil, invalidCursorError(err)
+			}
+		}
+	}
+
+	return &cursor, nil
+}
+
+func (c *CursorCodec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func invalidCursorError(err error) error {
+	return service_errors.NewServiceErrorBadRequest(err, "invalid cursor")
+}
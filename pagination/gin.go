@@ -0,0 +1,166 @@
+package pagination
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	service_errors "github.com/hrsupersport/hrnogomet-backend-kit/errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	QueryParamLimit  = "limit"
+	QueryParamCursor = "cursor"
+	QueryParamSort   = "sort"
+	QueryParamOffset = "offset"
+)
+
+// Params configures parsing of pagination query parameters for single endpoint
+type Params struct {
+	// DefaultLimit is used when limit query parameter is missing, pagination.DefaultLimit if zero
+	DefaultLimit int
+	// MaxLimit caps limit query parameter, pagination.MaxLimit if zero
+	MaxLimit int
+	// AllowedSort maps sort query parameter names to database columns, e.g. "createdAt" => "created_at"
+	AllowedSort map[string]string
+	// DefaultSort is used when sort query parameter is missing
+	DefaultSort []SortField
+	// TieBreaker is unique column appended to sort fields (unless already present) so that keyset ordering is total,
+	// typically primary key column
+	TieBreaker string
+}
+
+// ParseKeysetRequest parses limit/cursor/sort query parameters, e.g. ?limit=50&sort=-createdAt&cursor=eyJ2Ij...
+// ServiceErrorBadRequest is returned for invalid values, including cursor issued for different sorting
+func ParseKeysetRequest(c *gin.Context, codec *CursorCodec, params Params) (*PageRequest, error) {
+	req, err := parseCommon(c, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if token := c.Query(QueryParamCursor); token != "" {
+		cursor, err := codec.Decode(token)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != SortSignature(req.Sort) || len(cursor.Values) != len(req.Sort) {
+			return nil, service_errors.NewServiceErrorBadRequest(nil, "cursor does not match requested sort")
+		}
+		req.Cursor = cursor
+	}
+
+	return req, nil
+}
+
+// ParseOffsetRequest parses limit/offset/sort query parameters, e.g. ?limit=50&offset=100&sort=name
+func ParseOffsetRequest(c *gin.Context, params Params) (*PageRequest, error) {
+	req, err := parseCommon(c, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if value := c.Query(QueryParamOffset); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return nil, service_errors.NewServiceErrorBadRequest(err, "invalid offset")
+		}
+		req.Offset = offset
+	}
+
+	return req, nil
+}
+
+func parseCommon(c *gin.Context, params Params) (*PageRequest, error) {
+	defaultLimit := params.DefaultLimit
+	if defaultLimit <= 0 {
+		defaultLimit = DefaultLimit
+	}
+	maxLimit := params.MaxLimit
+	if maxLimit <= 0 {
+		maxLimit = MaxLimit
+	}
+
+	req := &PageRequest{Limit: defaultLimit}
+
+	if value := c.Query(QueryParamLimit); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return nil, service_errors.NewServiceErrorBadRequest(err, "invalid limit")
+		}
+		if limit > maxLimit {
+			limit = maxLimit
+		}
+		req.Limit = limit
+	}
+
+	sort, err := parseSort(c.Query(QueryParamSort), params)
+	if err != nil {
+		return nil, err
+	}
+	req.Sort = sort
+
+	return req, nil
+}
+
+func parseSort(value string, params Params) ([]SortField, error) {
+	var sort []SortField
+	if value == "" {
+		sort = append(sort, params.DefaultSort...)
+	} else {
+		for _, part := range strings.Split(value, ",") {
+			desc := strings.HasPrefix(part, "-")
+			name := strings.TrimPrefix(part, "-")
+			column, ok := params.AllowedSort[name]
+			if !ok {
+				return nil, service_errors.NewServiceErrorBadRequest(nil, fmt.Sprintf("unsupported sort field '%s'", name))
+			}
+			sort = append(sort, SortField{Column: column, Desc: desc})
+		}
+	}
+
+	if params.TieBreaker != "" {
+		for _, s := range sort {
+			if s.Column == params.TieBreaker {
+				return sort, nil
+			}
+		}
+		// tie breaker follows direction of last sort field so that row value comparison can be used for typical cases
+		desc := len(sort) > 0 && sort[len(sort)-1].Desc
+		sort = append(sort, SortField{Column: params.TieBreaker, Desc: desc})
+	}
+
+	return sort, nil
+}
+
+// SetLinks fills page.NextLink/page.PrevLink with links derived from current request url (path + query)
+// and sets RFC 8288 Link response header, e.g. Link: </players?cursor=...&limit=20>; rel="next"
+func SetLinks[T any](c *gin.Context, page *Page[T]) {
+	var links []string
+
+	if page.Next != "" {
+		page.NextLink = pageLink(c, page, page.Next)
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, page.NextLink))
+	}
+
+	if page.Prev != "" {
+		page.PrevLink = pageLink(c, page, page.Prev)
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, page.PrevLink))
+	}
+
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+}
+
+func pageLink[T any](c *gin.Context, page *Page[T], position string) string {
+	u := *c.Request.URL
+	query := u.Query()
+	query.Set(QueryParamLimit, strconv.Itoa(page.Limit))
+	if page.keyset {
+		query.Set(QueryParamCursor, position)
+	} else {
+		query.Set(QueryParamOffset, position)
+	}
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
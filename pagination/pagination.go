@@ -0,0 +1,140 @@
+package pagination
+
+/*
+Common pagination toolkit shared by repositories (see postgres.KeysetQuery, postgres.OffsetQuery)
+and REST API handlers (see ParseKeysetRequest, ParseOffsetRequest, SetLinks).
+
+Keyset pagination: client gets opaque signed cursor (next/prev) with each page and sends it back in 'cursor'
+query parameter. Cursor holds values of sort columns of last (first) row of returned page.
+Offset pagination: classic limit/offset, fine for small tables and admin UIs.
+*/
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// SortField represents single column used for sorting, e.g. '-created_at' => {Column: "created_at", Desc: true}
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+func (s SortField) String() string {
+	if s.Desc {
+		return "-" + s.Column
+	}
+	return s.Column
+}
+
+// PageRequest holds parsed pagination parameters of single list request
+type PageRequest struct {
+	Limit int
+	// Offset is used by offset pagination only
+	Offset int
+	// Cursor is used by keyset pagination only, nil means first page
+	Cursor *Cursor
+	// Sort holds sort columns, for keyset pagination last column must be unique (typically primary key)
+	Sort []SortField
+}
+
+// Backward returns true if page preceding the cursor is requested (i.e. prev link was followed)
+func (r *PageRequest) Backward() bool {
+	return r.Cursor != nil && r.Cursor.Backward
+}
+
+// SortSignature returns canonical representation of sort fields, e.g. '-created_at,id'
+// Signature is stored in cursor so that cursor cannot be reused with different sorting
+func SortSignature(sort []SortField) string {
+	parts := make([]string, 0, len(sort))
+	for _, s := range sort {
+		parts = append(parts, s.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// Page is generic page of items returned from list endpoints
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// Next and Prev hold opaque cursors (keyset pagination) or offsets (offset pagination)
+	// of next/previous page, empty string if there is no such page
+	Next string `json:"-"`
+	Prev string `json:"-"`
+	// NextLink and PrevLink hold links to next/previous page, see SetLinks
+	NextLink string `json:"next,omitempty"`
+	PrevLink string `json:"prev,omitempty"`
+	// Offset pagination only
+	Offset int `json:"offset,omitempty"`
+	Limit  int `json:"limit"`
+	keyset bool
+}
+
+// NewKeysetPage builds page from items fetched by postgres.QueryKeysetPage (in requested order, at most req.Limit items).
+// hasMore signals that there are more items in the direction of pagination.
+// cursorValues must return values of sort columns (in req.Sort order) for given item.
+func NewKeysetPage[T any](items []T, hasMore bool, req *PageRequest, codec *CursorCodec, cursorValues func(T) []any) (*Page[T], error) {
+	page := &Page[T]{
+		Items:  items,
+		Limit:  req.Limit,
+		keyset: true,
+	}
+	if len(items) == 0 {
+		return page, nil
+	}
+
+	signature := SortSignature(req.Sort)
+	// when paging forward there is next page only if more items were found, previous page exists if we came from cursor
+	// when paging backward it is the other way round
+	hasNext := hasMore
+	hasPrev := req.Cursor != nil
+	if req.Backward() {
+		hasNext, hasPrev = true, hasMore
+	}
+
+	if hasNext {
+		next, err := codec.Encode(&Cursor{Values: cursorValues(items[len(items)-1]), Sort: signature})
+		if err != nil {
+			return nil, err
+		}
+		page.Next = next
+	}
+
+	if hasPrev {
+		prev, err := codec.Encode(&Cursor{Values: cursorValues(items[0]), Sort: signature, Backward: true})
+		if err != nil {
+			return nil, err
+		}
+		page.Prev = prev
+	}
+
+	return page, nil
+}
+
+// NewOffsetPage builds page from items fetched by postgres.OffsetQuery with req.Limit+1 rows limit
+func NewOffsetPage[T any](items []T, req *PageRequest) *Page[T] {
+	page := &Page[T]{
+		Items:  items,
+		Offset: req.Offset,
+		Limit:  req.Limit,
+	}
+
+	if len(items) > req.Limit {
+		page.Items = items[:req.Limit]
+		page.Next = strconv.Itoa(req.Offset + req.Limit)
+	}
+
+	if req.Offset > 0 {
+		prevOffset := req.Offset - req.Limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		page.Prev = strconv.Itoa(prevOffset)
+	}
+
+	return page
+}
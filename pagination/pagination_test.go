@@ -0,0 +1,116 @@
+package pagination_test
+
+import (
+	"github.com/gin-gonic/gin"
+	service_errors "github.com/hrsupersport/hrnogomet-backend-kit/errors"
+	"github.com/hrsupersport/hrnogomet-backend-kit/pagination"
+	"github.com/rotisserie/eris"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+type player struct {
+	ID   int64
+	Name string
+}
+
+var params = pagination.Params{
+	AllowedSort: map[string]string{"name": "name"},
+	DefaultSort: []pagination.SortField{{Column: "name"}},
+	TieBreaker:  "id",
+}
+
+func newCodec(t *testing.T) *pagination.CursorCodec {
+	t.Helper()
+	codec, err := pagination.NewCursorCodec([]byte("secret"))
+	assert.Nil(t, err)
+	return codec
+}
+
+func newGinContext(target string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", target, nil)
+	return c
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	codec := newCodec(t)
+
+	token, err := codec.Encode(&pagination.Cursor{Values: []any{"Luka", int64(10)}, Sort: "name,id"})
+	assert.Nil(t, err)
+
+	cursor, err := codec.Decode(token)
+	assert.Nil(t, err)
+	assert.Equal(t, []any{"Luka", int64(10)}, cursor.Values)
+	assert.Equal(t, "name,id", cursor.Sort)
+	assert.False(t, cursor.Backward)
+}
+
+func TestCursorTampered(t *testing.T) {
+	codec := newCodec(t)
+	otherCodec, _ := pagination.NewCursorCodec([]byte("other"))
+
+	token, _ := otherCodec.Encode(&pagination.Cursor{Values: []any{int64(10)}, Sort: "id"})
+
+	for _, invalid := range []string{token, "garbage", "a.b"} {
+		_, err := codec.Decode(invalid)
+		var target *service_errors.ServiceErrorBadRequest
+		assert.True(t, eris.As(err, &target), invalid)
+	}
+}
+
+func TestParseKeysetRequest(t *testing.T) {
+	codec := newCodec(t)
+	token, _ := codec.Encode(&pagination.Cursor{Values: []any{"Luka", int64(10)}, Sort: "-name,-id"})
+
+	req, err := pagination.ParseKeysetRequest(newGinContext("/players?limit=500&sort=-name&cursor="+token), codec, params)
+	assert.Nil(t, err)
+	assert.Equal(t, pagination.MaxLimit, req.Limit)
+	assert.Equal(t, []pagination.SortField{{Column: "name", Desc: true}, {Column: "id", Desc: true}}, req.Sort)
+	assert.NotNil(t, req.Cursor)
+
+	// same cursor must not be usable with different sorting
+	_, err = pagination.ParseKeysetRequest(newGinContext("/players?sort=name&cursor="+token), codec, params)
+	var target *service_errors.ServiceErrorBadRequest
+	assert.True(t, eris.As(err, &target))
+
+	_, err = pagination.ParseKeysetRequest(newGinContext("/players?sort=password"), codec, params)
+	assert.True(t, eris.As(err, &target))
+}
+
+func TestKeysetPageLinks(t *testing.T) {
+	codec := newCodec(t)
+	c := newGinContext("/players?limit=2")
+	req, err := pagination.ParseKeysetRequest(c, codec, params)
+	assert.Nil(t, err)
+
+	page, err := pagination.NewKeysetPage([]player{{1, "Ante"}, {2, "Luka"}}, true, req, codec, func(p player) []any {
+		return []any{p.Name, p.ID}
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, page.Next)
+	assert.Empty(t, page.Prev)
+
+	pagination.SetLinks(c, page)
+	assert.Contains(t, page.NextLink, "/players?cursor=")
+	assert.Contains(t, c.Writer.Header().Get("Link"), `rel="next"`)
+
+	cursor, err := codec.Decode(page.Next)
+	assert.Nil(t, err)
+	assert.Equal(t, []any{"Luka", int64(2)}, cursor.Values)
+}
+
+func TestOffsetPageLinks(t *testing.T) {
+	c := newGinContext("/players?limit=2&offset=2")
+	req, err := pagination.ParseOffsetRequest(c, params)
+	assert.Nil(t, err)
+
+	page := pagination.NewOffsetPage([]player{{3, "Ivan"}, {4, "Mario"}, {5, "Zvonimir"}}, req)
+	assert.Len(t, page.Items, 2)
+
+	pagination.SetLinks(c, page)
+	assert.Equal(t, "/players?limit=2&offset=4", page.NextLink)
+	assert.Equal(t, "/players?limit=2&offset=0", page.PrevLink)
+}
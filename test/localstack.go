@@ -3,9 +3,17 @@ package test
 import (
 	"context"
 	"fmt"
+	aws_sdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqs_types "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/hrsupersport/hrnogomet-backend-kit/aws"
+	"github.com/hrsupersport/hrnogomet-backend-kit/constants"
 	"github.com/rs/zerolog/log"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -64,3 +72,66 @@ func (l *LocalstackContainer) TeardownLocalstack() {
 		log.Error().Err(err).Msg("cannot close localstack")
 	}
 }
+
+// CreateSqsQueue creates queue in localstack and returns its URL and ARN
+func (l *LocalstackContainer) CreateSqsQueue(ctx context.Context, name string) (string, string, error) {
+	client, err := aws.CreateSqsClient(aws.SetCustomAwsEndpoint(ctx, l.URI), constants.AwsDefaultRegion)
+	if err != nil {
+		return "", "", err
+	}
+
+	input := &sqs.CreateQueueInput{QueueName: aws_sdk.String(name)}
+	if strings.HasSuffix(name, ".fifo") {
+		input.Attributes = map[string]string{string(sqs_types.QueueAttributeNameFifoQueue): "true"}
+	}
+	queue, err := client.CreateQueue(ctx, input)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot create queue %s: %w", name, err)
+	}
+
+	attributes, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       queue.QueueUrl,
+		AttributeNames: []sqs_types.QueueAttributeName{sqs_types.QueueAttributeNameQueueArn},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("cannot get arn of queue %s: %w", name, err)
+	}
+	return aws_sdk.ToString(queue.QueueUrl), attributes.Attributes[string(sqs_types.QueueAttributeNameQueueArn)], nil
+}
+
+// CreateSnsTopic creates topic in localstack and returns its ARN
+func (l *LocalstackContainer) CreateSnsTopic(ctx context.Context, name string) (string, error) {
+	client, err := aws.CreateSnsClient(aws.SetCustomAwsEndpoint(ctx, l.URI), constants.AwsDefaultRegion)
+	if err != nil {
+		return "", err
+	}
+
+	input := &sns.CreateTopicInput{Name: aws_sdk.String(name)}
+	if strings.HasSuffix(name, ".fifo") {
+		input.Attributes = map[string]string{"FifoTopic": "true"}
+	}
+	if topic, err := client.CreateTopic(ctx, input); err != nil {
+		return "", fmt.Errorf("cannot create topic %s: %w", name, err)
+	} else {
+		return aws_sdk.ToString(topic.TopicArn), nil
+	}
+}
+
+// SubscribeQueue subscribes queue to topic in localstack, raw enables raw message delivery
+func (l *LocalstackContainer) SubscribeQueue(ctx context.Context, topicARN string, queueARN string, raw bool) error {
+	client, err := aws.CreateSnsClient(aws.SetCustomAwsEndpoint(ctx, l.URI), constants.AwsDefaultRegion)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn:   aws_sdk.String(topicARN),
+		Protocol:   aws_sdk.String("sqs"),
+		Endpoint:   aws_sdk.String(queueARN),
+		Attributes: map[string]string{"RawMessageDelivery": strconv.FormatBool(raw)},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot subscribe queue %s to topic %s: %w", queueARN, topicARN, err)
+	}
+	return nil
+}
@@ -4,13 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"embed"
-	"errors"
 	"fmt"
 	"time"
 
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/hrsupersport/hrnogomet-backend-kit/adapter/repository/migrations"
 	"github.com/rs/zerolog/log"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
@@ -141,34 +138,32 @@ func (p *PostgresDBContainer) Cleanup() {
 }
 
 // InitMigratePostgres is used to apply db migration scripts from embedded file system to given postgres database
-func InitMigratePostgres(conn string, migrations embed.FS, migrationTable *string) {
-	source, err := iofs.New(migrations, "migrations")
-	if err != nil {
-		log.Fatal().Err(err).Msg("cannot open migrations")
-	}
+func InitMigratePostgres(conn string, migrationsFS embed.FS, migrationTable *string) {
+	initMigrate(migrations.DriverPostgres, conn, migrationsFS, migrationTable)
+}
 
-	var uri string
+func initMigrate(driver migrations.Driver, conn string, migrationsFS embed.FS, migrationTable *string) {
+	cfg := migrations.Config{
+		Driver:      driver,
+		DatabaseURL: conn,
+		Source:      migrationsFS,
+	}
 	if migrationTable != nil {
-		// see https://github.com/golang-migrate/migrate/blob/master/database/postgres/README.md
-		uri = fmt.Sprintf("%s&x-migrations-table=%s", conn, *migrationTable)
-	} else {
-		uri = conn
+		cfg.MigrationsTable = *migrationTable
 	}
 
-	m, err := migrate.NewWithSourceInstance("iofs", source, uri)
+	m, err := migrations.New(cfg)
 	if err != nil {
 		log.Fatal().Err(err).Msg("cannot open source migrations")
 	}
 
-	defer func(m *migrate.Migrate) {
-		err, _ := m.Close()
-		if err != nil {
+	defer func(m *migrations.Migrator) {
+		if err := m.Close(); err != nil {
 			log.Fatal().Err(err).Msg("cannot close migration")
 		}
 	}(m)
 
-	err = m.Up()
-	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+	if err := m.Up(context.Background()); err != nil {
 		log.Fatal().Err(err).Msg("cannot migrate")
 	}
 }